@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// defaultConfigFile is read from the working directory when --config is not given, if it exists.
+const defaultConfigFile = ".idiff.yaml"
+
+// Output formats a config file may select.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+var configFile string
+
+// config is a project's iDiff configuration, holding the defaults of flags it would otherwise
+// pass on every run.  Flags given on the command line override it.
+type config struct {
+	// Differs names the differs, or plugins, run when no differ flags are given.
+	Differs []string      `yaml:"differs"`
+	Output  outputConfig  `yaml:"output"`
+	Filters filtersConfig `yaml:"filters"`
+	Policy  policyConfig  `yaml:"policy"`
+	Cache   cacheConfig   `yaml:"cache"`
+}
+
+type outputConfig struct {
+	// Format is text or json.
+	Format string `yaml:"format"`
+}
+
+type filtersConfig struct {
+	ExcludePaths   []string `yaml:"excludePaths"`
+	IgnorePackages []string `yaml:"ignorePackages"`
+}
+
+type policyConfig struct {
+	MaxSizeIncrease int64    `yaml:"maxSizeIncrease"`
+	DeniedPackages  []string `yaml:"deniedPackages"`
+}
+
+// cacheConfig configures the image cache of the serve command.
+type cacheConfig struct {
+	Dir    string `yaml:"dir"`
+	Images *int   `yaml:"images"`
+}
+
+// loadConfig reads and validates the config file at path.  A missing file is only an error if
+// it is required, otherwise the empty config is returned.
+func loadConfig(path string, required bool) (config, error) {
+	var c config
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("Could not read config file %s: %s", path, err)
+	}
+	if err := parseConfig(contents, &c); err != nil {
+		return c, fmt.Errorf("Invalid config file %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// parseConfig decodes and validates the contents of a config file.
+func parseConfig(contents []byte, c *config) error {
+	var node interface{}
+	if err := yaml.Unmarshal(contents, &node); err != nil {
+		return err
+	}
+	if err := checkConfigKeys(node, reflect.TypeOf(*c), ""); err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(contents, c); err != nil {
+		return err
+	}
+
+	if c.Output.Format != "" && c.Output.Format != formatText && c.Output.Format != formatJSON {
+		return fmt.Errorf("Unknown output format %q, expected %s or %s", c.Output.Format, formatText, formatJSON)
+	}
+	if c.Policy.MaxSizeIncrease < 0 {
+		return fmt.Errorf("policy.maxSizeIncrease must not be negative, got %d", c.Policy.MaxSizeIncrease)
+	}
+	if c.Cache.Images != nil && *c.Cache.Images < 0 {
+		return fmt.Errorf("cache.images must not be negative, got %d", *c.Cache.Images)
+	}
+	return nil
+}
+
+// checkConfigKeys rejects any key of the decoded YAML which is not a field of the config type,
+// so that a misspelt setting is not silently ignored.
+func checkConfigKeys(node interface{}, t reflect.Type, prefix string) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	mapping, ok := node.(map[interface{}]interface{})
+	if !ok {
+		if node == nil {
+			return nil
+		}
+		return fmt.Errorf("%s must be a mapping", strings.TrimSuffix(prefix, "."))
+	}
+
+	fields := map[string]reflect.Type{}
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		fields[name] = t.Field(i).Type
+		names = append(names, name)
+	}
+	keys := []string{}
+	for key := range mapping {
+		keys = append(keys, fmt.Sprint(key))
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fieldType, known := fields[key]
+		if !known {
+			return fmt.Errorf("Unknown key %s%s, expected one of: %s", prefix, key, strings.Join(names, ", "))
+		}
+		if err := checkConfigKeys(mapping[key], fieldType, prefix+key+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigFile sets each flag of the command which was not given on the command line to its
+// value in the config file, if the file sets it.
+func applyConfigFile(cmd *cobra.Command, args []string) error {
+	path, required := configFile, true
+	if path == "" {
+		path, required = defaultConfigFile, false
+	}
+	c, err := loadConfig(path, required)
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cmd.Flags(), c); err != nil {
+		return err
+	}
+	return filters.Validate()
+}
+
+// flagSetting holds the values a config sets a flag to, in the order they are set.
+type flagSetting struct {
+	flag   string
+	values []string
+}
+
+// applyConfig sets the flags the config sets, unless they were given on the command line.
+// The config's differs are only used if no differ or plugin was selected by flags.
+func applyConfig(flags *pflag.FlagSet, c config) error {
+	settings := []flagSetting{
+		{"exclude-path", c.Filters.ExcludePaths},
+		{"ignore-package", c.Filters.IgnorePackages},
+		{"deny-package", c.Policy.DeniedPackages},
+	}
+	if c.Output.Format != "" {
+		settings = append(settings, flagSetting{"json", []string{strconv.FormatBool(c.Output.Format == formatJSON)}})
+	}
+	if c.Policy.MaxSizeIncrease != 0 {
+		settings = append(settings, flagSetting{"max-size-increase", []string{strconv.FormatInt(c.Policy.MaxSizeIncrease, 10)}})
+	}
+	if c.Cache.Dir != "" {
+		settings = append(settings, flagSetting{"work-dir", []string{c.Cache.Dir}})
+	}
+	if c.Cache.Images != nil {
+		settings = append(settings, flagSetting{"cache-images", []string{strconv.Itoa(*c.Cache.Images)}})
+	}
+	if !differFlagsChanged(flags) {
+		configPlugins := []string{}
+		for _, name := range c.Differs {
+			if _, registered := diffFlagMap[name]; registered {
+				settings = append(settings, flagSetting{name, []string{"true"}})
+			} else {
+				configPlugins = append(configPlugins, name)
+			}
+		}
+		settings = append(settings, flagSetting{"plugin", configPlugins})
+	}
+
+	for _, setting := range settings {
+		flag := flags.Lookup(setting.flag)
+		// Settings for flags of other commands, such as those of serve's cache, do not apply.
+		if flag == nil || flag.Changed {
+			continue
+		}
+		for _, value := range setting.values {
+			if err := flags.Set(setting.flag, value); err != nil {
+				return fmt.Errorf("Invalid config value %q for --%s: %s", value, setting.flag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// differFlagsChanged reports whether any differ or plugin was selected on the command line.
+func differFlagsChanged(flags *pflag.FlagSet) bool {
+	for name := range diffFlagMap {
+		if flag := flags.Lookup(name); flag != nil && flag.Changed {
+			return true
+		}
+	}
+	flag := flags.Lookup("plugin")
+	return flag != nil && flag.Changed
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const testConfig = `
+differs: [apt, file, custom]
+output:
+  format: json
+filters:
+  excludePaths: [var/lib/apt/lists]
+  ignorePackages: [tzdata]
+policy:
+  maxSizeIncrease: 1048576
+  deniedPackages: [telnet]
+cache:
+  dir: /var/cache/idiff
+  images: 0
+`
+
+func TestParseConfig(t *testing.T) {
+	var c config
+	if err := parseConfig([]byte(testConfig), &c); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(c.Differs, []string{"apt", "file", "custom"}) || c.Output.Format != formatJSON {
+		t.Errorf("Expected differs and output format to be read but got %+v", c)
+	}
+	if c.Policy.MaxSizeIncrease != 1048576 || c.Cache.Images == nil || *c.Cache.Images != 0 {
+		t.Errorf("Expected policy and cache to be read but got %+v", c)
+	}
+
+	for contents, expected := range map[string]string{
+		"differ: [apt]":                      "Unknown key differ, expected one of: differs, output, filters, policy, cache",
+		"filters:\n  excludePath: [tmp]":     "Unknown key filters.excludePath, expected one of: excludePaths, ignorePackages",
+		"output: json":                       "output must be a mapping",
+		"output:\n  format: xml":             `Unknown output format "xml"`,
+		"policy:\n  maxSizeIncrease: big":    "cannot unmarshal",
+		"policy:\n  maxSizeIncrease: -1":     "must not be negative",
+		"cache:\n  images: -2":               "must not be negative",
+		"differs: [apt\n":                    "yaml:",
+		"filters:\n  ignorePackages: tzdata": "cannot unmarshal",
+	} {
+		var c config
+		if err := parseConfig([]byte(contents), &c); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q for config %q but got: %v", expected, contents, err)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, defaultConfigFile)
+	if c, err := loadConfig(path, false); err != nil || !reflect.DeepEqual(c, config{}) {
+		t.Errorf("Expected a missing optional config to be empty but got %+v, %v", c, err)
+	}
+	if _, err := loadConfig(path, true); err == nil {
+		t.Errorf("Expected error for a missing config given with --config but got none")
+	}
+	if err := ioutil.WriteFile(path, []byte("polcy: {}"), 0644); err != nil {
+		t.Fatalf("Could not write config: %s", err)
+	}
+	if _, err := loadConfig(path, false); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Expected error naming the invalid config %s but got: %v", path, err)
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	var c config
+	if err := parseConfig([]byte(testConfig), &c); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	newFlags := func() (*pflag.FlagSet, map[string]*bool, *[]string, *[]string, *bool) {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		differFlags := map[string]*bool{}
+		for name := range diffFlagMap {
+			differFlags[name] = flags.Bool(name, false, "")
+		}
+		testPlugins := flags.StringSlice("plugin", []string{}, "")
+		excludePaths := flags.StringSlice("exclude-path", []string{}, "")
+		testJSON := flags.Bool("json", false, "")
+		flags.Int64("max-size-increase", 0, "")
+		flags.StringSlice("ignore-package", []string{}, "")
+		flags.StringSlice("deny-package", []string{}, "")
+		return flags, differFlags, testPlugins, excludePaths, testJSON
+	}
+
+	// Without flags on the command line the config sets them all, skipping serve's cache flags.
+	flags, differFlags, testPlugins, excludePaths, testJSON := newFlags()
+	if err := applyConfig(flags, c); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if !*differFlags["apt"] || !*differFlags["file"] || *differFlags["pip"] || !reflect.DeepEqual(*testPlugins, []string{"custom"}) {
+		t.Errorf("Expected config to select apt, file and the custom plugin but got plugins %v", *testPlugins)
+	}
+	if !*testJSON || !reflect.DeepEqual(*excludePaths, []string{"var/lib/apt/lists"}) {
+		t.Errorf("Expected config to set --json and --exclude-path but got %t and %v", *testJSON, *excludePaths)
+	}
+
+	// Flags given on the command line override the config, and any differ flag overrides its differs.
+	flags, differFlags, testPlugins, excludePaths, testJSON = newFlags()
+	if err := flags.Parse([]string{"--pip", "--json=false", "--exclude-path", "tmp"}); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if err := applyConfig(flags, c); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if *differFlags["apt"] || *differFlags["file"] || !*differFlags["pip"] || len(*testPlugins) != 0 {
+		t.Errorf("Expected only the pip differ given on the command line to be selected but got plugins %v", *testPlugins)
+	}
+	if *testJSON || !reflect.DeepEqual(*excludePaths, []string{"tmp"}) {
+		t.Errorf("Expected command line --json and --exclude-path to be kept but got %t and %v", *testJSON, *excludePaths)
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/differs"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/spf13/cobra"
+)
+
+var DiffersCmd = &cobra.Command{
+	Use:   "differs",
+	Short: "Inspect the available differs.",
+}
+
+var DiffersListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "List the available differs.",
+	Long:          `Lists the registered differs with the flags selecting them, whether they run when no differs are selected, whether they can analyze a single image and the name of their results, followed by the differ plugins found in --plugins-dir and on PATH.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("differs list takes no arguments.")
+		}
+		listing := getDifferListing()
+		if json {
+			if err := utils.JSONify(listing); err != nil {
+				return err
+			}
+			fmt.Println()
+			return nil
+		}
+		return listing.OutputText()
+	},
+}
+
+// getDifferListing describes the registered differs and the discovered plugins.
+func getDifferListing() utils.DifferListing {
+	listing := utils.DifferListing{Differs: []utils.DifferDescription{}}
+	for _, info := range differs.Registered() {
+		flag := "--" + info.Name
+		if info.Shorthand != "" {
+			flag = "-" + info.Shorthand + ", " + flag
+		}
+		_, analyzer := info.Differ.(differs.Analyzer)
+		listing.Differs = append(listing.Differs, utils.DifferDescription{
+			Name:        info.Name,
+			Flag:        flag,
+			Default:     info.Default,
+			Analyzer:    analyzer,
+			DiffType:    info.DiffType,
+			Description: info.Description,
+		})
+	}
+	plugins := differs.DiscoverPlugins(getPluginDirs())
+	for _, name := range sortedKeys(plugins) {
+		plugin := plugins[name]
+		listing.Differs = append(listing.Differs, utils.DifferDescription{
+			Name:        name,
+			Flag:        "--plugin " + name,
+			DiffType:    plugin.DiffType(),
+			Description: "differ plugin " + plugin.Path,
+		})
+	}
+	return listing
+}
+
+func sortedKeys(plugins map[string]differs.PluginDiffer) []string {
+	names := []string{}
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	DiffersCmd.AddCommand(DiffersListCmd)
+	RootCmd.AddCommand(DiffersCmd)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+// defaultPlatforms are the platforms compared when none are given.
+var defaultPlatforms = []string{"linux/amd64", "linux/arm64"}
+
+var PlatformsCmd = &cobra.Command{
+	Use:           "platforms [image] [platform1 platform2]",
+	Short:         "Compare two platforms of a multi-arch image.",
+	Long:          `Compares two platforms, given as os/arch[/variant], of an image pulled from a manifest list or read from an OCI image index, using the specified differs as for two images.  The linux/amd64 and linux/arm64 images are compared by default, to catch package skew between architectures.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		platforms, err := checkPlatformsArgs(args)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnInterrupt(cancel)
+
+		opts := getDiffOptions()
+		glog.Infof("Starting diff on platforms %s and %s of image %s, using differs: %s", platforms[0], platforms[1], args[0], opts.Differs)
+		comparison, err := idiff.DiffPlatforms(ctx, idiff.ImageSource(args[0]), platforms[0], platforms[1], opts)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			glog.Info("Removing image file system directories from system")
+			if err := comparison.Cleanup(); err != nil {
+				glog.Error(err)
+			}
+		}()
+
+		return outputComparison(comparison)
+	},
+}
+
+// checkPlatformsArgs returns the platforms to compare, which follow the image if given.
+func checkPlatformsArgs(args []string) ([]string, error) {
+	switch len(args) {
+	case 1:
+		return defaultPlatforms, nil
+	case 3:
+		return args[1:], nil
+	}
+	return nil, errors.New("Should have an image and optionally two platforms as arguments: [IMAGE] [PLATFORM1 PLATFORM2].")
+}
+
+func init() {
+	RootCmd.AddCommand(PlatformsCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var ReproCmd = &cobra.Command{
+	Use:           "repro [image1] [image2]",
+	Short:         "Check that two builds of an image are reproducible.",
+	Long:          `Compares the file contents and metadata of two builds of the same Dockerfile, ignoring modification times, Python bytecode timestamps, /var/lib/apt/lists, the ordering of /etc/ld.so.cache and gzip headers.  Exits with a non-zero status if any file differs.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if validArgs, err := validateArgs(args); !validArgs {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnInterrupt(cancel)
+
+		glog.Infof("Starting reproducibility check on images %s and %s", args[0], args[1])
+		comparison, err := idiff.Repro(ctx, idiff.ImageSource(args[0]), idiff.ImageSource(args[1]), getDiffOptions())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			glog.Info("Removing image file system directories from system")
+			if err := comparison.Cleanup(); err != nil {
+				glog.Error(err)
+			}
+		}()
+
+		result, ok := comparison.Results["ReproDiffer"].(*utils.ReproDiffResult)
+		if !ok {
+			return fmt.Errorf("Could not check reproducibility of %s and %s", args[0], args[1])
+		}
+		if !quiet {
+			if json {
+				err = utils.JSONify([]utils.DiffResult{result.GetStruct()})
+			} else {
+				err = result.OutputText("ReproDiffer")
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		if len(result.Diff.Files) > 0 {
+			if exitCodeSet() {
+				exitStatus = exitDifferent
+				return nil
+			}
+			return fmt.Errorf("%d files are not reproducible", len(result.Diff.Files))
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ReproCmd)
+}
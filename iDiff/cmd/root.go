@@ -2,14 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	goflag "flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"sort"
-	"sync"
+	"strings"
+	"syscall"
 
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/differs"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -18,118 +22,219 @@ import (
 
 var json bool
 var eng bool
+var exitCode bool
+var quiet bool
 
-var apt bool
-var node bool
-var file bool
-var history bool
-var pip bool
+var showContent bool
+var byPackage bool
+var certExpiryDays int
+var extractLimits = utils.DefaultExtractLimits
+var tarImage string
+var platform string
+var contentOpts = differs.DefaultContentOptions
 
-var diffFlagMap = map[string]*bool{
-	"apt":     &apt,
-	"node":    &node,
-	"file":    &file,
-	"history": &history,
-	"pip":     &pip,
-}
+var pluginsDir string
+var plugins []string
 
-var RootCmd = &cobra.Command{
-	Use:   "[image1] [image2]",
-	Short: "Compare two images.",
-	Long:  `Compares two images using the specifed differs as indicated via flags (see iDiff documentation for available differs).`,
-	Run: func(cmd *cobra.Command, args []string) {
-		if validArgs, err := validateArgs(args); !validArgs {
-			glog.Error(err.Error())
-			os.Exit(1)
-		}
+var filters utils.DiffFilters
+var policy idiff.Policy
+
+// Exit statuses reported with --exit-code, as by git diff.
+const (
+	exitIdentical = 0
+	exitDifferent = 1
+	exitError     = 2
+)
 
-		utils.SetDockerEngine(eng)
+// exitStatus is the status a command which succeeded exits with when --exit-code is set.
+var exitStatus = exitIdentical
 
-		img1Arg := args[0]
-		img2Arg := args[1]
-		diffArgs := []string{}
-		allDiffers := getAllDiffers()
-		for _, name := range allDiffers {
-			if *diffFlagMap[name] == true {
-				diffArgs = append(diffArgs, name)
+// diffFlagMap holds the flag selecting each registered differ by the differ's name.
+var diffFlagMap = map[string]*bool{}
+
+var RootCmd = &cobra.Command{
+	Use:               "[image1] [image2]",
+	Short:             "Compare two images.",
+	Long:              `Compares two images using the specifed differs as indicated via flags (see "iDiff differs list" for available differs). A container given as container://<id or name> on its own is compared with the image it was created from. Defaults for the flags are read from .idiff.yaml in the working directory, or from the file given by --config.`,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	PersistentPreRunE: applyConfigFile,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnInterrupt(cancel)
+
+		if len(args) == 1 && utils.CheckContainer(args[0]) {
+			// A container on its own is diffed against the image it was created from.
+			image, err := idiff.ContainerImage(ctx, idiff.ImageSource(args[0]))
+			if err != nil {
+				return err
 			}
+			args = append(args, string(image))
 		}
-		// If no differs are specified, perform all diffs as the default
-		if len(diffArgs) == 0 {
-			diffArgs = allDiffers
+		if validArgs, err := validateArgs(args); !validArgs {
+			return err
 		}
 
-		var wg sync.WaitGroup
-		wg.Add(2)
+		img1Arg := args[0]
+		img2Arg := args[1]
 
-		glog.Infof("Starting diff on images %s and %s, using differs: %s", img1Arg, img2Arg, diffArgs)
+		opts := getDiffOptions()
+		glog.Infof("Starting diff on images %s and %s, using differs: %s", img1Arg, img2Arg, opts.Differs)
 
-		var image1, image2 utils.Image
-		var err error
-		go func() {
-			defer wg.Done()
-			image1, err = utils.ImagePrepper{img1Arg}.GetImage()
-			if err != nil {
-				glog.Error(err.Error())
-				os.Exit(1)
+		comparison, err := idiff.Diff(ctx, idiff.ImageSource(img1Arg), idiff.ImageSource(img2Arg), opts)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			glog.Info("Removing image file system directories from system")
+			if err := comparison.Cleanup(); err != nil {
+				glog.Error(err)
 			}
 		}()
 
-		go func() {
-			defer wg.Done()
-			image2, err = utils.ImagePrepper{img2Arg}.GetImage()
-			if err != nil {
-				glog.Error(err.Error())
-				os.Exit(1)
-			}
-		}()
+		return outputComparison(comparison)
+	},
+}
+
+// DiffCmd diffs two images given without a command.  This version of cobra rejects arguments
+// to a root command with subcommands, so Execute runs such diffs as this hidden command.
+var DiffCmd = &cobra.Command{
+	Use:           "diff [image1] [image2]",
+	Short:         RootCmd.Short,
+	Long:          RootCmd.Long,
+	Hidden:        true,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// Execute runs the command named by the process's arguments, or diffs the images they name otherwise.
+func Execute() error {
+	return execute(os.Args[1:])
+}
+
+func execute(args []string) error {
+	if _, _, err := RootCmd.Find(args); err != nil {
+		args = append([]string{DiffCmd.Name()}, args...)
+	}
+	RootCmd.SetArgs(args)
+	return RootCmd.Execute()
+}
 
-		diffTypes, err := differs.GetDiffers(diffArgs)
+// ExitStatus returns the status to exit with once a command has returned err.  With --exit-code
+// or --quiet it is 0 if the images are identical, 1 if they differ and 2 on any error, including
+// a differ failing.  Otherwise errors exit with 1 and differences are not reported.
+func ExitStatus(err error) int {
+	if !exitCodeSet() {
 		if err != nil {
-			glog.Error(err.Error())
-			os.Exit(1)
+			return 1
 		}
-		wg.Wait()
-
-		req := differs.DiffRequest{image1, image2, diffTypes}
-		if diffs, err := req.GetDiff(); err == nil {
-			// Outputs diff results in alphabetical order by differ name
-			diffTypes := []string{}
-			for name := range diffs {
-				diffTypes = append(diffTypes, name)
-			}
-			sort.Strings(diffTypes)
-			glog.Info("Retrieving diffs")
-			diffResults := []utils.DiffResult{}
-			for _, diffType := range diffTypes {
-				diff := diffs[diffType]
-				if json {
-					diffResults = append(diffResults, diff.GetStruct())
-				} else {
-					err = diff.OutputText(diffType)
-					if err != nil {
-						glog.Error(err)
-					}
-				}
-			}
-			if json {
-				err = utils.JSONify(diffResults)
-				if err != nil {
-					glog.Error(err)
-				}
-			}
-			fmt.Println()
-			glog.Info("Removing image file system directories from system")
-			errMsg := remove(image1.FSPath, true)
-			errMsg += remove(image2.FSPath, true)
-			if errMsg != "" {
-				glog.Error(errMsg)
-			}
-		} else {
-			glog.Error(err.Error())
-			os.Exit(1)
+		return 0
+	}
+	if err != nil {
+		return exitError
+	}
+	return exitStatus
+}
+
+// exitCodeSet reports whether differences are reported by the exit status, which --quiet implies.
+func exitCodeSet() bool {
+	return exitCode || quiet
+}
+
+// outputComparison prints the results of a comparison in alphabetical order by differ name,
+// followed by their summary, as text or as JSON, unless --quiet is set.  It records whether the
+// images differ for the exit status, and returns an error if the comparison violates the policy.
+func outputComparison(comparison *idiff.Comparison) error {
+	if len(comparison.Skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped differs which need an image file system, as an image was sourced from an SBOM: %s\n", strings.Join(comparison.Skipped, ", "))
+	}
+	if len(comparison.Errors) > 0 {
+		exitStatus = exitError
+	} else if !comparison.Identical() {
+		exitStatus = exitDifferent
+	}
+	if !quiet {
+		printComparison(comparison)
+	}
+	return checkPolicy(comparison)
+}
+
+func printComparison(comparison *idiff.Comparison) {
+	diffs := comparison.Results
+	diffTypes := []string{}
+	for name := range diffs {
+		diffTypes = append(diffTypes, name)
+	}
+	sort.Strings(diffTypes)
+	glog.Info("Retrieving diffs")
+	diffResults := []utils.DiffResult{}
+	for _, diffType := range diffTypes {
+		diff := diffs[diffType]
+		if json {
+			diffResults = append(diffResults, diff.GetStruct())
+		} else if err := diff.OutputText(diffType); err != nil {
+			glog.Error(err)
 		}
-	},
+	}
+	summary := comparison.Summary()
+	if json {
+		if err := utils.JSONify(utils.ComparisonOutput{Summary: summary, Diffs: diffResults}); err != nil {
+			glog.Error(err)
+		}
+	} else if err := summary.OutputText(); err != nil {
+		glog.Error(err)
+	}
+	fmt.Println()
+}
+
+// checkPolicy returns an error listing the ways in which the comparison violates the policy.
+func checkPolicy(comparison *idiff.Comparison) error {
+	violations, err := policy.Check(comparison)
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Policy violations:\n  %s", strings.Join(violations, "\n  "))
+}
+
+// cancelOnInterrupt calls cancel when the process receives an interrupt so that
+// in-flight image preparation stops and extracted files are removed.
+func cancelOnInterrupt(cancel context.CancelFunc) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		glog.Info("Interrupted, cancelling diff")
+		cancel()
+	}()
+}
+
+// getDiffOptions builds the library options selected by the command line flags.
+func getDiffOptions() idiff.Options {
+	diffArgs := []string{}
+	allDiffers := getAllDiffers()
+	for _, name := range allDiffers {
+		if *diffFlagMap[name] == true {
+			diffArgs = append(diffArgs, name)
+		}
+	}
+	diffArgs = append(diffArgs, plugins...)
+
+	opts := idiff.Options{Differs: diffArgs, Engine: eng, PluginDirs: getPluginDirs(), FileByPackage: byPackage, CertExpiryDays: &certExpiryDays, ExtractLimits: extractLimits, TarImage: tarImage, Platform: platform, Filters: filters}
+	if showContent {
+		opts.FileContent = &contentOpts
+	}
+	return opts
+}
+
+func getPluginDirs() []string {
+	if pluginsDir == "" {
+		return nil
+	}
+	return []string{pluginsDir}
 }
 
 func getAllDiffers() []string {
@@ -169,57 +274,53 @@ func checkArgNum(args []string) (bool, error) {
 	}
 }
 
-func checkImage(arg string) bool {
-	if !utils.CheckImageID(arg) && !utils.CheckImageURL(arg) && !utils.CheckTar(arg) {
-		return false
+// checkImage returns why the argument cannot be read as an image source, if it cannot.
+func checkImage(arg string) error {
+	if _, err := utils.ParseImageSource(arg); err != nil {
+		return fmt.Errorf("Argument %s is not a valid image source: %s", arg, err)
 	}
-	return true
+	return nil
 }
 
 func checkArgType(args []string) (bool, error) {
 	var buffer bytes.Buffer
-	valid := true
-	if !checkImage(args[0]) {
-		valid = false
-		errMessage := fmt.Sprintf("Argument %s is not an image ID, URL, or tar\n", args[0])
-		buffer.WriteString(errMessage)
-	}
-	if !checkImage(args[1]) {
-		valid = false
-		errMessage := fmt.Sprintf("Argument %s is not an image ID, URL, or tar\n", args[1])
-		buffer.WriteString(errMessage)
-	}
-	if !valid {
+	for _, arg := range args {
+		if err := checkImage(arg); err != nil {
+			buffer.WriteString(err.Error() + "\n")
+		}
+	}
+	if buffer.Len() > 0 {
 		return false, errors.New(buffer.String())
 	}
 	return true, nil
 }
 
-func remove(path string, dir bool) string {
-	var errStr string
-	if path == "" {
-		return ""
-	}
-
-	var err error
-	if dir {
-		err = os.RemoveAll(path)
-	} else {
-		err = os.Remove(path)
-	}
-	if err != nil {
-		errStr = "\nUnable to remove " + path
-	}
-	return errStr
-}
-
 func init() {
 	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
-	RootCmd.Flags().BoolVarP(&json, "json", "j", false, "JSON Output defines if the diff should be returned in a human readable format (false) or a JSON (true).")
-	RootCmd.Flags().BoolVarP(&eng, "eng", "e", false, "By default the docker calls are shelled out locally, set this flag to use the Docker Engine Client (version compatibility required).")
-	RootCmd.Flags().BoolVarP(&pip, "pip", "p", false, "Set this flag to use the pip differ.")
-	RootCmd.Flags().BoolVarP(&node, "node", "n", false, "Set this flag to use the node differ.")
-	RootCmd.Flags().BoolVarP(&apt, "apt", "a", false, "Set this flag to use the apt differ.")
-	RootCmd.Flags().BoolVarP(&file, "file", "f", false, "Set this flag to use the file differ.")
-	RootCmd.Flags().BoolVarP(&history, "history", "d", false, "Set this flag to use the dockerfile history differ.")
+	DiffCmd.RunE = RootCmd.RunE
+	RootCmd.AddCommand(DiffCmd)
+	RootCmd.PersistentFlags().StringVar(&configFile, "config", "", fmt.Sprintf("Config file setting the defaults of flags, %s in the working directory if it exists.", defaultConfigFile))
+	RootCmd.PersistentFlags().BoolVarP(&json, "json", "j", false, "JSON Output defines if the diff should be returned in a human readable format (false) or a JSON (true).")
+	RootCmd.PersistentFlags().BoolVarP(&eng, "eng", "e", false, "By default the docker calls are shelled out locally, set this flag to use the Docker Engine Client (version compatibility required).")
+	RootCmd.PersistentFlags().BoolVar(&exitCode, "exit-code", false, "Exit with 1 if the images differ, 0 if they are identical and 2 on any error, including a differ failing.")
+	RootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Print no report, only exit with the status of --exit-code, which this implies.")
+	for _, info := range differs.Registered() {
+		diffFlagMap[info.Name] = RootCmd.PersistentFlags().BoolP(info.Name, info.Shorthand, false, fmt.Sprintf("Set this flag to use the %s.", info.Description))
+	}
+	RootCmd.PersistentFlags().IntVar(&certExpiryDays, "cert-expiry-days", differs.DefaultCertExpiryDays, "Report certificates in the second image which expire within this many days.")
+	RootCmd.PersistentFlags().BoolVar(&showContent, "show-content", false, "Show unified diffs of modified text files in the file differ output.")
+	RootCmd.PersistentFlags().BoolVar(&byPackage, "by-package", false, "Group the file differ's changes by the dpkg or apk package owning each file.")
+	RootCmd.PersistentFlags().StringSliceVar(&contentOpts.Paths, "content-path", contentOpts.Paths, "Directory within the images whose modified files have their content shown. May be repeated.")
+	RootCmd.PersistentFlags().Int64Var(&contentOpts.MaxFileSize, "content-max-file-size", contentOpts.MaxFileSize, "Largest file, in bytes, whose content is shown.")
+	RootCmd.PersistentFlags().Int64Var(&contentOpts.MaxTotalSize, "content-max-total-size", contentOpts.MaxTotalSize, "Limit, in bytes, on the combined size of all content diffs shown.")
+	RootCmd.PersistentFlags().Int64Var(&extractLimits.MaxSize, "max-extract-size", extractLimits.MaxSize, "Most bytes of file content extracted from each image and its layers.")
+	RootCmd.PersistentFlags().IntVar(&extractLimits.MaxEntries, "max-extract-entries", extractLimits.MaxEntries, "Most tar entries extracted from each image and its layers.")
+	RootCmd.PersistentFlags().StringVar(&tarImage, "tar-image", "", "Repo tag or ID of the image read from tars saved with several images, unless given as <tar>#<image>.")
+	RootCmd.PersistentFlags().StringVar(&platform, "platform", "", "Platform, as os/arch[/variant], of the images pulled from manifest lists or read from OCI image indexes.")
+	RootCmd.PersistentFlags().StringVar(&pluginsDir, "plugins-dir", "", "Directory searched before PATH for differ plugins (executables named idiff-differ-<name>).")
+	RootCmd.PersistentFlags().StringSliceVar(&plugins, "plugin", []string{}, "Use the named differ plugin. May be repeated.")
+	RootCmd.PersistentFlags().StringSliceVar(&filters.ExcludePaths, "exclude-path", []string{}, "Glob pattern of files, or directories, within the images whose changes are not reported. May be repeated.")
+	RootCmd.PersistentFlags().StringSliceVar(&filters.IgnorePackages, "ignore-package", []string{}, "Glob pattern of package names whose changes are not reported. May be repeated.")
+	RootCmd.PersistentFlags().Int64Var(&policy.MaxSizeIncrease, "max-size-increase", 0, "Fail if the second image is larger than the first by more than this many bytes.")
+	RootCmd.PersistentFlags().StringSliceVar(&policy.DeniedPackages, "deny-package", []string{}, "Fail if the second image adds a package whose name matches this glob pattern. May be repeated.")
 }
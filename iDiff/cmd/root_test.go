@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/differs"
 )
 
 type testpair struct {
@@ -22,6 +25,8 @@ var argTypeTests = []testpair{
 	{[]string{"123456789012", "123456789012"}, true},
 	{[]string{"?!badDiffer71", "123456789012"}, false},
 	{[]string{"123456789012", "gcr.io/repo/image"}, true},
+	{[]string{"container://web", "123456789012"}, true},
+	{[]string{"container://", "123456789012"}, false},
 }
 
 func TestArgNum(t *testing.T) {
@@ -49,3 +54,55 @@ func TestArgType(t *testing.T) {
 		}
 	}
 }
+
+func TestExecuteImages(t *testing.T) {
+	defer RootCmd.PersistentFlags().Set("file", "false")
+	// The images are diffed even though the root command has subcommands.
+	if err := execute([]string{"../utils/testTars/la-croix1.tar", "../utils/testTars/la-croix2.tar", "-f"}); err != nil {
+		t.Errorf("Got unexpected error diffing images: %s", err)
+	}
+	if err := execute([]string{"?!bad", "../utils/testTars/la-croix2.tar"}); err == nil {
+		t.Errorf("Expected error for invalid image but got none")
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	defer func() { exitCode, quiet, exitStatus = false, false, exitIdentical }()
+	for _, test := range []struct {
+		exitCode, quiet bool
+		status          int
+		err             error
+		expected        int
+	}{
+		{false, false, exitDifferent, nil, 0},
+		{false, false, exitIdentical, errors.New("failed"), 1},
+		{true, false, exitIdentical, nil, 0},
+		{true, false, exitDifferent, nil, 1},
+		{true, false, exitError, nil, 2},
+		{true, false, exitDifferent, errors.New("failed"), 2},
+		{false, true, exitDifferent, nil, 1},
+	} {
+		exitCode, quiet, exitStatus = test.exitCode, test.quiet, test.status
+		if actual := ExitStatus(test.err); actual != test.expected {
+			t.Errorf("Expected exit status %d with --exit-code=%t, --quiet=%t, status %d and error %v but got: %d",
+				test.expected, test.exitCode, test.quiet, test.status, test.err, actual)
+		}
+	}
+}
+
+func TestDiffFlags(t *testing.T) {
+	for _, info := range differs.Registered() {
+		flag := RootCmd.PersistentFlags().Lookup(info.Name)
+		if flag == nil {
+			t.Errorf("Expected a flag for differ %s", info.Name)
+			continue
+		}
+		if flag.Shorthand != info.Shorthand {
+			t.Errorf("Expected flag of differ %s to have shorthand %q but got %q", info.Name, info.Shorthand, flag.Shorthand)
+		}
+	}
+	listing := getDifferListing()
+	if len(listing.Differs) < len(differs.Registered()) {
+		t.Errorf("Expected every registered differ to be listed but got: %v", listing.Differs)
+	}
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var sbomFormat string
+
+var SBOMCmd = &cobra.Command{
+	Use:           "sbom [image]",
+	Short:         "Export a software bill of materials for an image.",
+	Long:          `Lists the apt, pip and node packages installed in an image, with their package URLs, versions and declared licenses, as an SPDX or CycloneDX JSON document.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Should have one image as argument: [IMAGE].")
+		}
+		if err := checkImage(args[0]); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnInterrupt(cancel)
+
+		glog.Infof("Generating %s SBOM for image %s", sbomFormat, args[0])
+		sbom, err := idiff.SBOM(ctx, idiff.ImageSource(args[0]), sbomFormat, getDiffOptions())
+		if err != nil {
+			return err
+		}
+		if err := utils.JSONify(sbom); err != nil {
+			return err
+		}
+		fmt.Println()
+		return nil
+	},
+}
+
+func init() {
+	SBOMCmd.Flags().StringVar(&sbomFormat, "format", utils.SPDXJSON, fmt.Sprintf("SBOM format, %s or %s.", utils.SPDXJSON, utils.CycloneDXJSON))
+	RootCmd.AddCommand(SBOMCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var SeriesCmd = &cobra.Command{
+	Use:           "series [image1] [image2] ... [imageN]",
+	Short:         "Compare a series of images.",
+	Long:          `Diffs each consecutive pair in a series of images and reports how packages, size and history changed across the series, as Markdown or as JSON (--json).`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkSeriesArgs(args); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnInterrupt(cancel)
+
+		opts := getDiffOptions()
+		sources := []idiff.ImageSource{}
+		for _, arg := range args {
+			sources = append(sources, idiff.ImageSource(arg))
+		}
+		glog.Infof("Starting diff on series of images %s, using differs: %s", args, opts.Differs)
+
+		series, err := idiff.DiffSeries(ctx, sources, opts)
+		if err != nil {
+			return err
+		}
+
+		report := series.Report()
+		if json {
+			err = utils.JSONify(report)
+		} else {
+			err = utils.MarkdownOutput(report, utils.SeriesMarkdownOutput)
+		}
+		if err != nil {
+			return err
+		}
+		if len(report.Failures) > 0 {
+			return fmt.Errorf("%d of the %d diffs in the series failed", len(report.Failures), len(sources)-1)
+		}
+		return nil
+	},
+}
+
+func checkSeriesArgs(args []string) error {
+	if len(args) < 2 {
+		return errors.New("Too few arguments. Should have at least two images as arguments: [IMAGE1] [IMAGE2] ... [IMAGEN].")
+	}
+	var buffer bytes.Buffer
+	for _, arg := range args {
+		if err := checkImage(arg); err != nil {
+			buffer.WriteString(err.Error() + "\n")
+		}
+	}
+	if buffer.Len() > 0 {
+		return errors.New(buffer.String())
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(SeriesCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/server"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var serveAddr string
+var serveWorkDir string
+var serveConfig = server.Config{
+	Workers:     server.DefaultWorkers,
+	QueueSize:   server.DefaultQueueSize,
+	CacheImages: server.DefaultCacheImages,
+	Retention:   server.DefaultRetention,
+}
+
+var ServeCmd = &cobra.Command{
+	Use:           "serve",
+	Short:         "Serve a REST API to diff and analyze images.",
+	Long:          `Runs iDiff as an HTTP service.  Diff and analyze jobs are submitted with POST /jobs, their status is polled with GET /jobs/<id> and their results are fetched as JSON or HTML from GET /jobs/<id>/result?format=json|html.  Jobs run a few at a time from a bounded queue, each in a workspace which is removed once it finishes, and images used by several jobs are only extracted once.  Jobs which do not name their differs use those selected by the flags, or all differs.  Jobs may only read images pulled from registries, or the files beneath --local-root, and never the images or containers of the local Docker daemon.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("serve takes no arguments.")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnInterrupt(cancel)
+
+		config := serveConfig
+		config.Options = getDiffOptions()
+		config.Options.WorkDir = serveWorkDir
+		srv, err := server.New(config)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			glog.Info("Removing cached image file system directories from system")
+			if err := srv.Close(); err != nil {
+				glog.Error(err)
+			}
+		}()
+
+		httpServer := &http.Server{Addr: serveAddr, Handler: srv}
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancelShutdown()
+			httpServer.Shutdown(shutdownCtx)
+		}()
+		glog.Infof("Serving the iDiff API on %s", serveAddr)
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	ServeCmd.Flags().StringVar(&serveAddr, "addr", "localhost:8080", "Address to listen on.  The API has no authentication, so take care before listening on other interfaces.")
+	ServeCmd.Flags().StringVar(&serveConfig.LocalRoot, "local-root", "", "Directory jobs may read image tars, OCI layouts, SBOMs and root file systems from.  Otherwise jobs may only use images pulled from registries.")
+	ServeCmd.Flags().StringVar(&serveWorkDir, "work-dir", "", "Directory job workspaces and cached images are created under, the system temp directory by default.")
+	ServeCmd.Flags().IntVar(&serveConfig.Workers, "workers", serveConfig.Workers, "Number of jobs run at once.")
+	ServeCmd.Flags().IntVar(&serveConfig.QueueSize, "queue-size", serveConfig.QueueSize, "Number of jobs which may wait to run before further jobs are rejected.")
+	ServeCmd.Flags().IntVar(&serveConfig.CacheImages, "cache-images", serveConfig.CacheImages, "Number of extracted images kept for later jobs once no job uses them.")
+	ServeCmd.Flags().DurationVar(&serveConfig.Retention, "retention", serveConfig.Retention, "How long the results of finished jobs are kept.")
+	RootCmd.AddCommand(ServeCmd)
+}
@@ -3,12 +3,27 @@ package differs
 import (
 	"bufio"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
 	"github.com/golang/glog"
 )
 
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "apt",
+		Shorthand:   "a",
+		Description: "apt differ",
+		Default:     true,
+		DiffType:    "AptDiffer",
+		Result:      utils.PackageDiffResult{},
+		Template:    utils.SingleVersionOutput,
+		Differ:      AptDiffer{},
+	})
+}
+
 type AptDiffer struct {
 }
 
@@ -18,6 +33,11 @@ func (d AptDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
 	return diff, err
 }
 
+// Analyze lists the packages installed by apt-get in the image.
+func (d AptDiffer) Analyze(image utils.Image) (utils.AnalyzeResult, error) {
+	return singleVersionAnalysis(image, d)
+}
+
 func (d AptDiffer) getPackages(path string) (map[string]utils.PackageInfo, error) {
 	packages := make(map[string]utils.PackageInfo)
 	layerStems, err := utils.BuildLayerTargets(path, "layer/var/lib/dpkg/status")
@@ -25,27 +45,40 @@ func (d AptDiffer) getPackages(path string) (map[string]utils.PackageInfo, error
 		return packages, err
 	}
 	for _, statusFile := range layerStems {
-		if _, err := os.Stat(statusFile); err != nil {
-			// status file does not exist in this layer
-			continue
-		}
-		if file, err := os.Open(statusFile); err == nil {
-			// make sure it gets closed
-			defer file.Close()
-
-			// create a new scanner and read the file line by line
-			scanner := bufio.NewScanner(file)
-			var currPackage string
-			for scanner.Scan() {
-				currPackage = parseLine(scanner.Text(), currPackage, packages)
-			}
-		} else {
+		if err := readStatusFile(statusFile, packages); err != nil {
 			return packages, err
 		}
 	}
 	return packages, nil
 }
 
+// getLayerPackages lists the packages in the dpkg status file of a single layer.
+func (d AptDiffer) getLayerPackages(pathToLayer string) (map[string]utils.PackageInfo, error) {
+	packages := make(map[string]utils.PackageInfo)
+	err := readStatusFile(filepath.Join(pathToLayer, "layer/var/lib/dpkg/status"), packages)
+	return packages, err
+}
+
+func readStatusFile(statusFile string, packages map[string]utils.PackageInfo) error {
+	if _, err := os.Stat(statusFile); err != nil {
+		// status file does not exist in this layer
+		return nil
+	}
+	file, err := os.Open(statusFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// create a new scanner and read the file line by line
+	scanner := bufio.NewScanner(file)
+	var currPackage string
+	for scanner.Scan() {
+		currPackage = parseLine(scanner.Text(), currPackage, packages)
+	}
+	return nil
+}
+
 func parseLine(text string, currPackage string, packages map[string]utils.PackageInfo) string {
 	line := strings.Split(text, ": ")
 	if len(line) == 2 {
@@ -74,7 +107,12 @@ func parseLine(text string, currPackage string, packages map[string]utils.Packag
 			if !ok {
 				currPackageInfo = utils.PackageInfo{}
 			}
-			currPackageInfo.Size = value
+			// dpkg records installed sizes in KiB.
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				glog.Warningf("Invalid Installed-Size %q for package %s", value, currPackage)
+			}
+			currPackageInfo.Size = size * 1024
 			packages[currPackage] = currPackageInfo
 			return currPackage
 		default:
@@ -83,3 +121,8 @@ func parseLine(text string, currPackage string, packages map[string]utils.Packag
 	}
 	return currPackage
 }
+
+// sbomPackageType is the package URL type of the packages the differ compares.
+func (d AptDiffer) sbomPackageType() string {
+	return "deb"
+}
@@ -48,20 +48,28 @@ func TestParseLine(t *testing.T) {
 			expected:    map[string]utils.PackageInfo{"La-Croix": {Version: "Lime extra_lime"}},
 		},
 		{
-			descrip:     "Size line",
+			descrip:     "Size line in KiB",
+			line:        "Installed-Size: 12",
+			packages:    map[string]utils.PackageInfo{},
+			currPackage: "La-Croix",
+			expPackage:  "La-Croix",
+			expected:    map[string]utils.PackageInfo{"La-Croix": {Size: 12288}},
+		},
+		{
+			descrip:     "Invalid size line",
 			line:        "Installed-Size: 12floz",
 			packages:    map[string]utils.PackageInfo{},
 			currPackage: "La-Croix",
 			expPackage:  "La-Croix",
-			expected:    map[string]utils.PackageInfo{"La-Croix": {Size: "12floz"}},
+			expected:    map[string]utils.PackageInfo{"La-Croix": {}},
 		},
 		{
 			descrip:     "Pre-existing PackageInfo struct",
-			line:        "Installed-Size: 12floz",
+			line:        "Installed-Size: 12",
 			packages:    map[string]utils.PackageInfo{"La-Croix": {Version: "Lime"}},
 			currPackage: "La-Croix",
 			expPackage:  "La-Croix",
-			expected:    map[string]utils.PackageInfo{"La-Croix": {Version: "Lime", Size: "12floz"}},
+			expected:    map[string]utils.PackageInfo{"La-Croix": {Version: "Lime", Size: 12288}},
 		},
 	}
 
@@ -71,7 +79,7 @@ func TestParseLine(t *testing.T) {
 			t.Errorf("Expected current package to be: %s, but got: %s.", test.expPackage, currPackage)
 		}
 		if !reflect.DeepEqual(test.packages, test.expected) {
-			t.Errorf("Expected: %s but got: %s", test.expected, test.packages)
+			t.Errorf("Expected: %v but got: %v", test.expected, test.packages)
 		}
 	}
 }
@@ -123,7 +131,7 @@ func TestGetAptPackages(t *testing.T) {
 			t.Errorf("Expected error but got none.")
 		}
 		if !reflect.DeepEqual(packages, test.expected) {
-			t.Errorf("Expected: %s but got: %s", test.expected, packages)
+			t.Errorf("Expected: %v but got: %v", test.expected, packages)
 		}
 	}
 }
@@ -0,0 +1,179 @@
+package differs
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+// DefaultCertExpiryDays is how far ahead the certs differ checks certificates for expiry by default.
+const DefaultCertExpiryDays = 30
+
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "certs",
+		Shorthand:   "c",
+		Description: "CA certificate differ",
+		Default:     true,
+		DiffType:    "CertsDiffer",
+		Result:      utils.CertDiffResult{},
+		Template:    utils.CertOutput,
+		Differ:      CertsDiffer{ExpiryDays: DefaultCertExpiryDays},
+	})
+}
+
+// CertsDiffer compares the trusted CA certificates of two images.
+type CertsDiffer struct {
+	// ExpiryDays is how far ahead the second image's certificates are checked for expiry.
+	// Only certificates which have already expired are reported if it is zero.
+	ExpiryDays int
+}
+
+// certBundles are the CA bundles of Debian and Alpine based images.  Certificates anywhere
+// under certDirs, where RPM based images keep theirs, are also read.
+var certBundles = []string{"/etc/ssl/certs/ca-certificates.crt"}
+var certDirs = []string{"/etc/pki"}
+
+// CertsDiff reports the CA certificates added and removed between two images, and those of
+// the second image which have expired or are about to.
+func (d CertsDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
+	diff, err := d.getCertDiff(image1, image2, time.Now())
+	return &utils.CertDiffResult{DiffType: "CertsDiffer", Diff: diff}, err
+}
+
+func (d CertsDiffer) getCertDiff(image1, image2 utils.Image, now time.Time) (utils.CertDiff, error) {
+	diff := utils.CertDiff{
+		Image1:     image1.Source,
+		Image2:     image2.Source,
+		ExpiryDays: d.ExpiryDays,
+		Added:      []utils.CertInfo{},
+		Removed:    []utils.CertInfo{},
+		Expiring:   []utils.CertInfo{},
+	}
+
+	if d.ExpiryDays < 0 {
+		return diff, fmt.Errorf("Invalid certificate expiry of %d days", d.ExpiryDays)
+	}
+
+	files1, err := utils.GetImageFiles(image1.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image1.Source, err)
+	}
+	files2, err := utils.GetImageFiles(image2.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image2.Source, err)
+	}
+	certs1 := getCerts(files1)
+	certs2 := getCerts(files2)
+
+	for fingerprint, cert := range certs2 {
+		if _, ok := certs1[fingerprint]; !ok {
+			diff.Added = append(diff.Added, cert)
+		}
+	}
+	for fingerprint, cert := range certs1 {
+		if _, ok := certs2[fingerprint]; !ok {
+			diff.Removed = append(diff.Removed, cert)
+		}
+	}
+	deadline := now.AddDate(0, 0, d.ExpiryDays)
+	for _, cert := range certs2 {
+		if cert.NotAfter.Before(deadline) {
+			diff.Expiring = append(diff.Expiring, cert)
+		}
+	}
+	sortCerts(diff.Added)
+	sortCerts(diff.Removed)
+	sort.Slice(diff.Expiring, func(i, j int) bool {
+		return diff.Expiring[i].NotAfter.Before(diff.Expiring[j].NotAfter)
+	})
+	return diff, nil
+}
+
+func sortCerts(certs []utils.CertInfo) {
+	sort.Slice(certs, func(i, j int) bool {
+		if certs[i].Subject != certs[j].Subject {
+			return certs[i].Subject < certs[j].Subject
+		}
+		return certs[i].Fingerprint < certs[j].Fingerprint
+	})
+}
+
+// getCerts reads the CA certificates of an image, keyed by fingerprint.
+func getCerts(files map[string]utils.ImageFile) map[string]utils.CertInfo {
+	paths := []string{}
+	paths = append(paths, certBundles...)
+	for _, p := range utils.SortedImagePaths(files) {
+		for _, dir := range certDirs {
+			if strings.HasPrefix(p, dir+"/") && isCertFile(p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	certs := map[string]utils.CertInfo{}
+	for _, p := range paths {
+		file, ok := utils.ResolveImagePath(files, p)
+		if !ok || !file.Info.Mode().IsRegular() {
+			continue
+		}
+		contents, err := ioutil.ReadFile(file.FSPath)
+		if err != nil {
+			glog.Warningf("Could not read certificates from %s: %s", p, err)
+			continue
+		}
+		for _, cert := range parseCerts(p, contents) {
+			fingerprint := sha256.Sum256(cert.Raw)
+			key := hex.EncodeToString(fingerprint[:])
+			info, ok := certs[key]
+			if !ok {
+				info = utils.CertInfo{Subject: cert.Subject.String(), Fingerprint: key, NotAfter: cert.NotAfter.UTC()}
+			}
+			if len(info.Files) == 0 || info.Files[len(info.Files)-1] != p {
+				info.Files = append(info.Files, p)
+			}
+			certs[key] = info
+		}
+	}
+	return certs
+}
+
+func isCertFile(p string) bool {
+	switch path.Ext(p) {
+	case ".crt", ".pem", ".cer":
+		return true
+	}
+	return false
+}
+
+// parseCerts decodes the PEM encoded certificates of a bundle, skipping anything else it holds
+// such as keys or OpenSSL trusted certificates.
+func parseCerts(p string, contents []byte) []*x509.Certificate {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			glog.Warningf("Could not parse a certificate in %s: %s", p, err)
+			continue
+		}
+		certs = append(certs, cert)
+	}
+}
@@ -1,9 +1,12 @@
 package differs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
 	"github.com/golang/glog"
@@ -15,49 +18,221 @@ type DiffRequest struct {
 	DiffTypes []Differ
 }
 
+type AnalyzeRequest struct {
+	Image        utils.Image
+	AnalyzeTypes []Analyzer
+}
+
 type Differ interface {
 	Diff(image1, image2 utils.Image) (utils.DiffResult, error)
 }
 
-var diffs = map[string]Differ{
-	"history": HistoryDiffer{},
-	"file":    FileDiffer{},
-	"apt":     AptDiffer{},
-	"pip":     PipDiffer{},
-	"node":    NodeDiffer{},
+// Analyzer is implemented by differs which can also describe a single image.
+type Analyzer interface {
+	Analyze(image utils.Image) (utils.AnalyzeResult, error)
 }
 
-func (diff DiffRequest) GetDiff() (map[string]utils.DiffResult, error) {
+// contextDiffer is implemented by differs which stop early when their context is cancelled.
+type contextDiffer interface {
+	DiffContext(ctx context.Context, image1, image2 utils.Image) (utils.DiffResult, error)
+}
+
+// namedDiffer is implemented by differs whose results are not named after their Go type.
+type namedDiffer interface {
+	DiffType() string
+}
+
+// differName returns the name of the differ's results, as registered.  Differs which are not
+// registered, such as the ReproDiffer, are named after their Go type.
+func differName(differ interface{}) string {
+	if named, ok := differ.(namedDiffer); ok {
+		return named.DiffType()
+	}
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
+	if name, ok := diffTypes[reflect.TypeOf(differ)]; ok {
+		return name
+	}
+	return reflect.TypeOf(differ).Name()
+}
+
+var diffsMu sync.RWMutex
+
+// diffs holds the registered differs by name.
+var diffs = map[string]Differ{}
+
+// GetDiff runs each requested differ, stopping early if ctx is cancelled.
+// Differs which fail are logged and left out of the results.
+func (diff DiffRequest) GetDiff(ctx context.Context) (map[string]utils.DiffResult, error) {
+	results, _, err := diff.GetDiffWithErrors(ctx)
+	return results, err
+}
+
+// GetDiffWithErrors is GetDiff which also returns the error of each differ which failed.
+func (diff DiffRequest) GetDiffWithErrors(ctx context.Context) (map[string]utils.DiffResult, map[string]error, error) {
 	img1 := diff.Image1
 	img2 := diff.Image2
 	diffs := diff.DiffTypes
 
 	results := map[string]utils.DiffResult{}
+	failed := map[string]error{}
 	for _, differ := range diffs {
-		differName := reflect.TypeOf(differ).Name()
-		if diff, err := differ.Diff(img1, img2); err == nil {
-			results[differName] = diff
+		if err := ctx.Err(); err != nil {
+			return results, failed, err
+		}
+		name := differName(differ)
+		if diff.skips(differ) {
+			glog.Warningf("Skipping %s, which needs an image file system, as an image was sourced from an SBOM", name)
+			continue
+		}
+		if diff, err := runDiffer(ctx, differ, img1, img2); err == nil {
+			results[name] = diff
 		} else {
-			glog.Errorf("Error getting diff with %s: %s", differName, err)
+			glog.Errorf("Error getting diff with %s: %s", name, err)
+			failed[name] = err
 		}
 	}
 
 	var err error
 	if len(results) == 0 {
-		err = fmt.Errorf("Could not perform diff on %s and %s", img1, img2)
+		err = fmt.Errorf("Could not perform diff on %s and %s", img1.Source, img2.Source)
 	} else {
 		err = nil
 	}
 
-	return results, err
+	return results, failed, err
+}
+
+func runDiffer(ctx context.Context, differ Differ, img1, img2 utils.Image) (utils.DiffResult, error) {
+	if contextDiffer, ok := differ.(contextDiffer); ok {
+		return contextDiffer.DiffContext(ctx, img1, img2)
+	}
+	return differ.Diff(img1, img2)
+}
+
+// Skipped returns the names of the requested differs which GetDiff skips because an image was
+// sourced from an SBOM, and so has no file system for them to inspect.
+func (diff DiffRequest) Skipped() []string {
+	names := []string{}
+	for _, differ := range diff.DiffTypes {
+		if diff.skips(differ) {
+			names = append(names, differName(differ))
+		}
+	}
+	return names
+}
+
+func (diff DiffRequest) skips(differ Differ) bool {
+	return (diff.Image1.SBOM != nil || diff.Image2.SBOM != nil) && !SupportsSBOM(differ)
+}
+
+// Skipped returns the names of the requested analyzers which GetAnalysis skips because the image
+// was sourced from an SBOM, and so has no file system for them to inspect.
+func (req AnalyzeRequest) Skipped() []string {
+	names := []string{}
+	for _, analyzer := range req.AnalyzeTypes {
+		if req.skips(analyzer) {
+			names = append(names, differName(analyzer))
+		}
+	}
+	return names
+}
+
+func (req AnalyzeRequest) skips(analyzer Analyzer) bool {
+	return req.Image.SBOM != nil && !SupportsSBOM(analyzer)
+}
+
+// GetAnalysis runs each requested analyzer, stopping early if ctx is cancelled.
+func (req AnalyzeRequest) GetAnalysis(ctx context.Context) (map[string]utils.AnalyzeResult, error) {
+	img := req.Image
+
+	results := map[string]utils.AnalyzeResult{}
+	for _, analyzer := range req.AnalyzeTypes {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		analyzerName := differName(analyzer)
+		if req.skips(analyzer) {
+			glog.Warningf("Skipping %s, which needs an image file system, as the image was sourced from an SBOM", analyzerName)
+			continue
+		}
+		if analysis, err := analyzer.Analyze(img); err == nil {
+			results[analyzerName] = analysis
+		} else {
+			glog.Errorf("Error getting analysis with %s: %s", analyzerName, err)
+		}
+	}
+
+	if len(results) == 0 {
+		return results, fmt.Errorf("Could not perform analysis on %s", img.Source)
+	}
+	return results, nil
+}
+
+// DifferNames returns the names of all available differs in alphabetical order.
+func DifferNames() []string {
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
+	names := []string{}
+	for name := range diffs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultDifferNames returns the names of the differs run when none are selected, in
+// alphabetical order.
+func DefaultDifferNames() []string {
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
+	names := []string{}
+	for name := range diffs {
+		if isDefault(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AnalyzerNames returns the names of all available differs which support analysis in alphabetical order.
+func AnalyzerNames() []string {
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
+	names := []string{}
+	for name, differ := range diffs {
+		if _, ok := differ.(Analyzer); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultAnalyzerNames returns the names of the differs run by default which support analysis,
+// in alphabetical order.
+func DefaultAnalyzerNames() []string {
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
+	names := []string{}
+	for name, differ := range diffs {
+		if _, ok := differ.(Analyzer); ok && isDefault(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func GetDiffers(diffNames []string) (diffFuncs []Differ, err error) {
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
 	for _, diffName := range diffNames {
 		if d, exists := diffs[diffName]; exists {
 			diffFuncs = append(diffFuncs, d)
 		} else {
-			glog.Errorf("Unknown differ specified", diffName)
+			glog.Errorf("Unknown differ specified: %s", diffName)
 		}
 	}
 	if len(diffFuncs) == 0 {
@@ -65,3 +240,25 @@ func GetDiffers(diffNames []string) (diffFuncs []Differ, err error) {
 	}
 	return
 }
+
+// GetAnalyzers returns the differs named which also support analyzing a single image.
+func GetAnalyzers(analyzerNames []string) (analyzeFuncs []Analyzer, err error) {
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
+	for _, name := range analyzerNames {
+		d, exists := diffs[name]
+		if !exists {
+			glog.Errorf("Unknown analyzer specified: %s", name)
+			continue
+		}
+		if a, ok := d.(Analyzer); ok {
+			analyzeFuncs = append(analyzeFuncs, a)
+		} else {
+			glog.Errorf("Differ %s does not support analysis", name)
+		}
+	}
+	if len(analyzeFuncs) == 0 {
+		err = errors.New("No known analyzers specified")
+	}
+	return
+}
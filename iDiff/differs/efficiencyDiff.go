@@ -0,0 +1,195 @@
+package differs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "efficiency",
+		Shorthand:   "w",
+		Description: "layer efficiency (wasted space) differ",
+		Default:     true,
+		DiffType:    "EfficiencyDiffer",
+		Result:      utils.EfficiencyDiffResult{},
+		Template:    utils.EfficiencyDiffOutput,
+		Differ:      EfficiencyDiffer{},
+	})
+}
+
+type EfficiencyDiffer struct {
+}
+
+// EfficiencyDiff compares how much space the layers of two images waste.
+func (d EfficiencyDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
+	diff := utils.EfficiencyDiff{Image1: image1.Source, Image2: image2.Source}
+	efficiency1, err := getEfficiency(image1)
+	if err != nil {
+		return &utils.EfficiencyDiffResult{DiffType: "EfficiencyDiffer", Diff: diff}, err
+	}
+	efficiency2, err := getEfficiency(image2)
+	if err != nil {
+		return &utils.EfficiencyDiffResult{DiffType: "EfficiencyDiffer", Diff: diff}, err
+	}
+	diff.Efficiency1 = efficiency1
+	diff.Efficiency2 = efficiency2
+	diff.ScoreDelta = efficiency2.Score - efficiency1.Score
+	diff.WastedSizeDelta = efficiency2.WastedSize - efficiency1.WastedSize
+	return &utils.EfficiencyDiffResult{DiffType: "EfficiencyDiffer", Diff: diff}, nil
+}
+
+// Analyze reports the space wasted by the layers of the image.
+func (d EfficiencyDiffer) Analyze(image utils.Image) (utils.AnalyzeResult, error) {
+	efficiency, err := getEfficiency(image)
+	return &utils.EfficiencyAnalyzeResult{Image: image.Source, AnalyzeType: "EfficiencyDiffer", Analysis: efficiency}, err
+}
+
+// storedFile is the content of a regular file stored in a layer which is visible in the layers
+// applied so far.  Hardlinks within a layer share their content, so it is visible at several paths.
+type storedFile struct {
+	layer int
+	size  int64
+	// links is how many visible paths hold the content.
+	links int
+}
+
+// storedLink is a file of a layer and its content, by which its hardlinks are found.
+type storedLink struct {
+	info os.FileInfo
+	file *storedFile
+}
+
+// getEfficiency applies the layers of the image in order, charging each layer for the bytes of its
+// files that later layers overwrite or whiteout, and hashes every stored file to find duplicated content.
+// Hardlinks are stored once, so they are neither counted twice nor reported as duplicates, and their
+// content is only wasted once every link to it is overwritten or deleted.
+func getEfficiency(image utils.Image) (utils.Efficiency, error) {
+	efficiency := utils.Efficiency{
+		Image:      image.Source,
+		Score:      1,
+		Layers:     []utils.LayerEfficiency{},
+		Duplicates: []utils.DuplicateContent{},
+	}
+	layers, steps := getLayerSteps(image)
+	roots := utils.GetLayerRoots(image.FSPath)
+	visible := map[string]*storedFile{}
+	contents := map[string]*utils.DuplicateContent{}
+
+	// hide removes path, and everything below it, from the visible files, charging the layers they were stored in.
+	hide := func(path string, self bool) {
+		prefix := strings.TrimSuffix(path, "/") + "/"
+		for p, file := range visible {
+			if (self && p == path) || strings.HasPrefix(p, prefix) {
+				if file.links--; file.links == 0 {
+					efficiency.Layers[file.layer].DeletedSize += file.size
+				}
+				delete(visible, p)
+			}
+		}
+	}
+
+	for i, root := range roots {
+		changes, err := utils.GetLayerChanges(root)
+		if err != nil {
+			return efficiency, fmt.Errorf("Error reading layer %s of image %s: %s", root, image.Source, err)
+		}
+		layer := filepath.Base(layers[i])
+		efficiency.Layers = append(efficiency.Layers, utils.LayerEfficiency{Layer: layer, CreatedBy: steps[i]})
+
+		for _, dir := range changes.OpaqueDirs {
+			hide(dir, false)
+		}
+		for _, path := range changes.Whiteouts {
+			hide(path, true)
+		}
+		// links holds the files stored in the layer by the hash of their content.
+		links := map[string][]storedLink{}
+		for _, path := range utils.SortedImagePaths(changes.Files) {
+			file := changes.Files[path]
+			if overwritten, ok := visible[path]; ok {
+				if overwritten.links--; overwritten.links == 0 {
+					efficiency.Layers[overwritten.layer].OverwrittenSize += overwritten.size
+				}
+				delete(visible, path)
+			}
+			if !file.Info.Mode().IsRegular() {
+				continue
+			}
+			size := file.Info.Size()
+			stored := &storedFile{layer: i, size: size, links: 1}
+			if size > 0 {
+				hash, err := hashFile(file.FSPath)
+				if err != nil {
+					return efficiency, err
+				}
+				if linked := findHardlink(links[hash], file.Info); linked != nil {
+					linked.links++
+					visible[path] = linked
+					continue
+				}
+				links[hash] = append(links[hash], storedLink{info: file.Info, file: stored})
+				if _, ok := contents[hash]; !ok {
+					contents[hash] = &utils.DuplicateContent{Hash: hash, Size: size, Files: []utils.DuplicateFile{}}
+				}
+				contents[hash].Files = append(contents[hash].Files, utils.DuplicateFile{Path: path, Layer: layer})
+			}
+			visible[path] = stored
+			efficiency.Layers[i].Size += size
+			efficiency.TotalSize += size
+		}
+	}
+
+	for _, layer := range efficiency.Layers {
+		efficiency.WastedSize += layer.OverwrittenSize + layer.DeletedSize
+	}
+	if efficiency.TotalSize > 0 {
+		efficiency.Score = float64(efficiency.TotalSize-efficiency.WastedSize) / float64(efficiency.TotalSize)
+	}
+	for _, content := range contents {
+		if len(content.Files) > 1 {
+			content.WastedSize = content.Size * int64(len(content.Files)-1)
+			efficiency.Duplicates = append(efficiency.Duplicates, *content)
+		}
+	}
+	sort.Slice(efficiency.Duplicates, func(i, j int) bool {
+		d1, d2 := efficiency.Duplicates[i], efficiency.Duplicates[j]
+		if d1.WastedSize != d2.WastedSize {
+			return d1.WastedSize > d2.WastedSize
+		}
+		return d1.Hash < d2.Hash
+	})
+	return efficiency, nil
+}
+
+// findHardlink returns the content of the file among those with the same content which is a
+// hardlink to it, if any is.
+func findHardlink(files []storedLink, info os.FileInfo) *storedFile {
+	for _, file := range files {
+		if os.SameFile(file.info, info) {
+			return file.file
+		}
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
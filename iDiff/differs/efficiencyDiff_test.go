@@ -0,0 +1,125 @@
+package differs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func TestEfficiency(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "efficiency")
+	defer os.RemoveAll(dir)
+
+	conf := strings.Repeat("c", 10)
+	wasteful := writeTestImage(t, filepath.Join(dir, "wasteful"), `{}`, []map[string]testEntry{
+		{
+			"app/big":   {content: strings.Repeat("a", 100)},
+			"app/tmp":   {content: strings.Repeat("t", 50)},
+			"etc/conf":  {content: conf},
+			"etc/empty": {},
+		},
+		{
+			"app/big":     {content: strings.Repeat("b", 100)},
+			"app/.wh.tmp": {},
+			"opt/copy":    {content: conf},
+		},
+	})
+	lean := writeTestImage(t, filepath.Join(dir, "lean"), `{}`, []map[string]testEntry{{
+		"app/big":  {content: strings.Repeat("b", 100)},
+		"etc/conf": {content: conf},
+	}})
+
+	result, err := EfficiencyDiffer{}.Analyze(wasteful)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	efficiency := result.(*utils.EfficiencyAnalyzeResult).Analysis
+	if efficiency.TotalSize != 270 || efficiency.WastedSize != 150 {
+		t.Errorf("Expected 150 of 270 bytes wasted but got %d of %d", efficiency.WastedSize, efficiency.TotalSize)
+	}
+	if expected := 120.0 / 270.0; efficiency.Score != expected {
+		t.Errorf("Expected score %f but got %f", expected, efficiency.Score)
+	}
+	expectedLayers := []utils.LayerEfficiency{
+		{Layer: "layer0", Size: 160, OverwrittenSize: 100, DeletedSize: 50},
+		{Layer: "layer1", Size: 110},
+	}
+	if !reflect.DeepEqual(efficiency.Layers, expectedLayers) {
+		t.Errorf("Expected layers: %v but got: %v", expectedLayers, efficiency.Layers)
+	}
+	if err := result.OutputText("EfficiencyDiffer"); err != nil {
+		t.Errorf("Got unexpected error writing output: %s", err)
+	}
+	if len(efficiency.Duplicates) != 1 {
+		t.Fatalf("Expected one duplicated content but got: %v", efficiency.Duplicates)
+	}
+	expectedFiles := []utils.DuplicateFile{{Path: "/etc/conf", Layer: "layer0"}, {Path: "/opt/copy", Layer: "layer1"}}
+	if duplicate := efficiency.Duplicates[0]; duplicate.WastedSize != 10 || !reflect.DeepEqual(duplicate.Files, expectedFiles) {
+		t.Errorf("Expected 10 bytes wasted by %v but got: %v", expectedFiles, duplicate)
+	}
+
+	diffResult, err := EfficiencyDiffer{}.Diff(wasteful, lean)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	diff := diffResult.(*utils.EfficiencyDiffResult).Diff
+	if diff.ScoreDelta <= 0 || diff.WastedSizeDelta != -150 {
+		t.Errorf("Expected lean image to be more efficient but got score change %f and wasted size change %d", diff.ScoreDelta, diff.WastedSizeDelta)
+	}
+	if err := diffResult.OutputText("EfficiencyDiffer"); err != nil {
+		t.Errorf("Got unexpected error writing output: %s", err)
+	}
+}
+
+func TestEfficiencyHardlinks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "efficiency")
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		descrip  string
+		deleted  []string
+		expected []utils.LayerEfficiency
+	}{
+		{
+			descrip:  "link kept",
+			deleted:  []string{"app/.wh.bin"},
+			expected: []utils.LayerEfficiency{{Layer: "layer0", Size: 100}, {Layer: "layer1"}},
+		},
+		{
+			descrip:  "every link deleted",
+			deleted:  []string{"app/.wh.bin", "app/.wh.alias"},
+			expected: []utils.LayerEfficiency{{Layer: "layer0", Size: 100, DeletedSize: 100}, {Layer: "layer1"}},
+		},
+	} {
+		imageDir := filepath.Join(dir, strings.Replace(test.descrip, " ", "-", -1))
+		deletions := map[string]testEntry{}
+		for _, path := range test.deleted {
+			deletions[path] = testEntry{}
+		}
+		image := writeTestImage(t, imageDir, `{}`, []map[string]testEntry{
+			{"app/bin": {content: strings.Repeat("a", 100)}},
+			deletions,
+		})
+		layerRoot := filepath.Join(imageDir, "layer0", "layer")
+		if err := os.Link(filepath.Join(layerRoot, "app/bin"), filepath.Join(layerRoot, "app/alias")); err != nil {
+			t.Fatalf("Could not create hardlink: %s", err)
+		}
+
+		result, err := EfficiencyDiffer{}.Analyze(image)
+		if err != nil {
+			t.Fatalf("%s: Got unexpected error: %s", test.descrip, err)
+		}
+		efficiency := result.(*utils.EfficiencyAnalyzeResult).Analysis
+		if efficiency.TotalSize != 100 || len(efficiency.Duplicates) != 0 {
+			t.Errorf("%s: Expected hardlinks to be stored once, not duplicated, but got %d bytes with duplicates %v", test.descrip, efficiency.TotalSize, efficiency.Duplicates)
+		}
+		if !reflect.DeepEqual(efficiency.Layers, test.expected) {
+			t.Errorf("%s: Expected layers: %v but got: %v", test.descrip, test.expected, efficiency.Layers)
+		}
+	}
+}
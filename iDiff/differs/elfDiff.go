@@ -0,0 +1,252 @@
+package differs
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "elf",
+		Shorthand:   "l",
+		Description: "ELF shared library dependency differ",
+		Default:     true,
+		DiffType:    "ElfDiffer",
+		Result:      utils.ElfDiffResult{},
+		Template:    utils.ElfOutput,
+		Differ:      ElfDiffer{},
+	})
+}
+
+type ElfDiffer struct {
+}
+
+// ElfDiff compares the shared library dependencies of the ELF files in two images.
+func (d ElfDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
+	diff, err := getElfDiff(image1, image2)
+	return &utils.ElfDiffResult{DiffType: "ElfDiffer", Diff: diff}, err
+}
+
+func getElfDiff(image1, image2 utils.Image) (utils.ElfDiff, error) {
+	diff := utils.ElfDiff{Image1: image1.Source, Image2: image2.Source}
+
+	files1, err := utils.GetImageFiles(image1.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image1.Source, err)
+	}
+	files2, err := utils.GetImageFiles(image2.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image2.Source, err)
+	}
+	elfs1 := getElfInfos(files1)
+	elfs2 := getElfInfos(files2)
+	linker1 := newLinker(files1)
+	linker2 := newLinker(files2)
+
+	diff.Changed = []utils.ElfChange{}
+	diff.Unresolved = []utils.ElfUnresolved{}
+	for _, path := range utils.SortedImagePaths(files2) {
+		info2, ok := elfs2[path]
+		if !ok {
+			continue
+		}
+		info1, existed := elfs1[path]
+		if existed && !reflect.DeepEqual(info1, info2) {
+			diff.Changed = append(diff.Changed, utils.ElfChange{Path: path, Info1: info1, Info2: info2})
+		}
+
+		missing := []string{}
+		for _, lib := range linker2.unresolved(path, info2) {
+			if existed && contains(linker1.unresolved(path, info1), lib) {
+				// already broken in the first image
+				continue
+			}
+			missing = append(missing, lib)
+		}
+		if len(missing) > 0 {
+			diff.Unresolved = append(diff.Unresolved, utils.ElfUnresolved{Path: path, Libraries: missing})
+		}
+	}
+	return diff, nil
+}
+
+var elfMagic = []byte(elf.ELFMAG)
+
+// getElfInfos reads the dynamic linking information of every dynamically linked ELF file in an image.
+func getElfInfos(files map[string]utils.ImageFile) map[string]utils.ElfInfo {
+	infos := map[string]utils.ElfInfo{}
+	for path, file := range files {
+		if !file.Info.Mode().IsRegular() || file.Info.Size() < int64(len(elfMagic)) {
+			continue
+		}
+		info, ok, err := readElfInfo(file.FSPath)
+		if err != nil {
+			glog.Warningf("Could not read ELF file %s: %s", path, err)
+			continue
+		}
+		if ok {
+			infos[path] = info
+		}
+	}
+	return infos
+}
+
+// readElfInfo returns the linking information of the file at path, if it is a dynamically linked ELF file.
+func readElfInfo(path string) (utils.ElfInfo, bool, error) {
+	var info utils.ElfInfo
+	f, err := os.Open(path)
+	if err != nil {
+		return info, false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(elfMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, elfMagic) {
+		return info, false, nil
+	}
+
+	elfFile, err := elf.NewFile(f)
+	if err != nil {
+		return info, false, err
+	}
+	defer elfFile.Close()
+	if elfFile.Section(".dynamic") == nil {
+		// statically linked
+		return info, false, nil
+	}
+	if info.Needed, err = elfFile.DynString(elf.DT_NEEDED); err != nil {
+		return info, false, err
+	}
+	if sonames, _ := elfFile.DynString(elf.DT_SONAME); len(sonames) > 0 {
+		info.Soname = sonames[0]
+	}
+	info.Rpath = dynPaths(elfFile, elf.DT_RPATH)
+	info.Runpath = dynPaths(elfFile, elf.DT_RUNPATH)
+	return info, true, nil
+}
+
+func dynPaths(elfFile *elf.File, tag elf.DynTag) []string {
+	values, _ := elfFile.DynString(tag)
+	paths := []string{}
+	for _, value := range values {
+		paths = append(paths, strings.Split(value, ":")...)
+	}
+	return paths
+}
+
+// linker resolves needed libraries inside an image the way the glibc dynamic linker does,
+// without consulting ld.so.cache.
+type linker struct {
+	files       map[string]utils.ImageFile
+	searchPaths []string
+}
+
+var defaultLibPaths = []string{
+	"/lib", "/usr/lib", "/lib64", "/usr/lib64",
+	"/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu",
+	"/lib/aarch64-linux-gnu", "/usr/lib/aarch64-linux-gnu",
+	"/lib/arm-linux-gnueabihf", "/usr/lib/arm-linux-gnueabihf",
+	"/lib/i386-linux-gnu", "/usr/lib/i386-linux-gnu",
+}
+
+func newLinker(files map[string]utils.ImageFile) linker {
+	searchPaths := readLdSoConf(files, "/etc/ld.so.conf", 0)
+	searchPaths = append(searchPaths, defaultLibPaths...)
+	return linker{files: files, searchPaths: searchPaths}
+}
+
+// readLdSoConf returns the library directories listed in an ld.so.conf file and the files it includes.
+func readLdSoConf(files map[string]utils.ImageFile, confPath string, depth int) []string {
+	dirs := []string{}
+	file, ok := utils.ResolveImagePath(files, confPath)
+	if !ok || depth > 8 {
+		return dirs
+	}
+	f, err := os.Open(file.FSPath)
+	if err != nil {
+		return dirs
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.SplitN(scanner.Text(), "#", 2)[0])
+		if line == "" {
+			continue
+		}
+		if fields := strings.Fields(line); fields[0] == "include" && len(fields) > 1 {
+			for _, pattern := range fields[1:] {
+				if !path.IsAbs(pattern) {
+					pattern = path.Join(path.Dir(confPath), pattern)
+				}
+				for _, included := range utils.SortedImagePaths(files) {
+					if matched, _ := path.Match(pattern, included); matched {
+						dirs = append(dirs, readLdSoConf(files, included, depth+1)...)
+					}
+				}
+			}
+			continue
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs
+}
+
+// unresolved returns the needed libraries of the file at binPath which cannot be found in the image.
+func (l linker) unresolved(binPath string, info utils.ElfInfo) []string {
+	origin := path.Dir(binPath)
+	expand := func(dirs []string) []string {
+		expanded := []string{}
+		for _, dir := range dirs {
+			dir = strings.Replace(dir, "${ORIGIN}", origin, -1)
+			expanded = append(expanded, strings.Replace(dir, "$ORIGIN", origin, -1))
+		}
+		return expanded
+	}
+
+	searchPaths := []string{}
+	if len(info.Runpath) == 0 {
+		// DT_RPATH is ignored when DT_RUNPATH is present
+		searchPaths = append(searchPaths, expand(info.Rpath)...)
+	}
+	searchPaths = append(searchPaths, expand(info.Runpath)...)
+	searchPaths = append(searchPaths, l.searchPaths...)
+
+	missing := []string{}
+	for _, lib := range info.Needed {
+		if !l.resolve(lib, searchPaths) {
+			missing = append(missing, lib)
+		}
+	}
+	return missing
+}
+
+func (l linker) resolve(lib string, searchPaths []string) bool {
+	if strings.Contains(lib, "/") {
+		_, ok := utils.ResolveImagePath(l.files, lib)
+		return ok
+	}
+	for _, dir := range searchPaths {
+		if file, ok := utils.ResolveImagePath(l.files, path.Join(dir, lib)); ok && !file.Info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, item string) bool {
+	for _, entry := range list {
+		if entry == item {
+			return true
+		}
+	}
+	return false
+}
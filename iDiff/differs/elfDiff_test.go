@@ -0,0 +1,144 @@
+package differs
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// buildElf returns a minimal 64-bit shared object with the given dynamic section entries.
+func buildElf(needed []string, soname, runpath string) []byte {
+	dynstr := []byte{0}
+	addString := func(s string) uint64 {
+		offset := uint64(len(dynstr))
+		dynstr = append(dynstr, append([]byte(s), 0)...)
+		return offset
+	}
+	dyns := []elf.Dyn64{}
+	for _, lib := range needed {
+		dyns = append(dyns, elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: addString(lib)})
+	}
+	if soname != "" {
+		dyns = append(dyns, elf.Dyn64{Tag: int64(elf.DT_SONAME), Val: addString(soname)})
+	}
+	if runpath != "" {
+		dyns = append(dyns, elf.Dyn64{Tag: int64(elf.DT_RUNPATH), Val: addString(runpath)})
+	}
+	dyns = append(dyns, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+	shstrtab := []byte("\x00.dynstr\x00.dynamic\x00.shstrtab\x00")
+
+	var dynamic bytes.Buffer
+	binary.Write(&dynamic, binary.LittleEndian, dyns)
+
+	headerSize := uint64(binary.Size(elf.Header64{}))
+	dynstrOff := headerSize
+	dynamicOff := dynstrOff + uint64(len(dynstr))
+	shstrtabOff := dynamicOff + uint64(dynamic.Len())
+	sectionsOff := shstrtabOff + uint64(len(shstrtab))
+
+	header := elf.Header64{
+		Type: uint16(elf.ET_DYN), Machine: uint16(elf.EM_X86_64), Version: uint32(elf.EV_CURRENT),
+		Shoff: sectionsOff, Ehsize: uint16(headerSize), Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum: 4, Shstrndx: 3,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: dynstrOff, Size: uint64(len(dynstr)), Addralign: 1},
+		{Name: 9, Type: uint32(elf.SHT_DYNAMIC), Off: dynamicOff, Size: uint64(dynamic.Len()), Link: 1, Addralign: 8, Entsize: 16},
+		{Name: 18, Type: uint32(elf.SHT_STRTAB), Off: shstrtabOff, Size: uint64(len(shstrtab)), Addralign: 1},
+	}
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, header)
+	out.Write(dynstr)
+	out.Write(dynamic.Bytes())
+	out.Write(shstrtab)
+	binary.Write(&out, binary.LittleEndian, sections)
+	return out.Bytes()
+}
+
+func TestReadElfInfo(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "elf")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "libfoo.so.1")
+	ioutil.WriteFile(path, buildElf([]string{"libc.so.6", "libbar.so.2"}, "libfoo.so.1", "$ORIGIN/../lib:/opt/lib"), 0755)
+	info, ok, err := readElfInfo(path)
+	if err != nil || !ok {
+		t.Fatalf("Expected ELF info but got ok: %t, error: %s", ok, err)
+	}
+	expected := utils.ElfInfo{
+		Needed:  []string{"libc.so.6", "libbar.so.2"},
+		Soname:  "libfoo.so.1",
+		Rpath:   []string{},
+		Runpath: []string{"$ORIGIN/../lib", "/opt/lib"},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, info)
+	}
+
+	textPath := filepath.Join(dir, "script.sh")
+	ioutil.WriteFile(textPath, []byte("#!/bin/sh\necho not elf\n"), 0755)
+	if _, ok, err := readElfInfo(textPath); ok || err != nil {
+		t.Errorf("Expected non-ELF file to be skipped but got ok: %t, error: %s", ok, err)
+	}
+}
+
+func TestElfDiff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "elf")
+	defer os.RemoveAll(dir)
+
+	app := string(buildElf([]string{"libc.so.6", "libssl.so.1.0.0"}, "", ""))
+	appNew := string(buildElf([]string{"libc.so.6", "libssl.so.1.1"}, "", ""))
+	tool := string(buildElf([]string{"libc.so.6", "libcrypto.so.1.0.0", "libplugin.so"}, "", "$ORIGIN/../lib/tool"))
+	image1 := writeTestImage(t, filepath.Join(dir, "image1"), "{}", []map[string]testEntry{{
+		"etc/ld.so.conf":                                  {content: "include /etc/ld.so.conf.d/*.conf\n"},
+		"etc/ld.so.conf.d/local.conf":                     {content: "# local libraries\n/usr/local/lib\n"},
+		"lib/x86_64-linux-gnu/libc.so.6":                  {content: "libc"},
+		"usr/lib/x86_64-linux-gnu/libssl.so.1.0.0":        {content: "ssl"},
+		"usr/local/lib/libcrypto.so.1.0.0":                {content: "crypto"},
+		"usr/local/lib/tool/libplugin.so":                 {content: "plugin"},
+		"usr/bin/app":                                     {content: app, mode: 0755},
+		"usr/local/bin/tool":                              {content: tool, mode: 0755},
+		"usr/local/bin/broken":                            {content: string(buildElf([]string{"libgone.so"}, "", "")), mode: 0755},
+		"usr/lib/x86_64-linux-gnu/libstatic-not-elf.so.1": {content: "text"},
+	}})
+	image2 := writeTestImage(t, filepath.Join(dir, "image2"), "{}", []map[string]testEntry{{
+		"lib/x86_64-linux-gnu/libc.so.6":         {content: "libc"},
+		"usr/lib/x86_64-linux-gnu/libssl.so.1.1": {content: "ssl"},
+		"usr/local/lib/libcrypto.so.1.0.0":       {content: "crypto"},
+		"usr/local/lib/tool/libplugin.so":        {content: "plugin"},
+		"usr/bin/app":                            {content: appNew, mode: 0755},
+		"usr/local/bin/tool":                     {content: tool, mode: 0755},
+		"usr/local/bin/broken":                   {content: string(buildElf([]string{"libgone.so"}, "", "")), mode: 0755},
+	}})
+
+	diff, err := getElfDiff(image1, image2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expectedChanged := []utils.ElfChange{{
+		Path:  "/usr/bin/app",
+		Info1: utils.ElfInfo{Needed: []string{"libc.so.6", "libssl.so.1.0.0"}, Rpath: []string{}, Runpath: []string{}},
+		Info2: utils.ElfInfo{Needed: []string{"libc.so.6", "libssl.so.1.1"}, Rpath: []string{}, Runpath: []string{}},
+	}}
+	if !reflect.DeepEqual(diff.Changed, expectedChanged) {
+		t.Errorf("Expected changed: %v but got: %v", expectedChanged, diff.Changed)
+	}
+	// libcrypto was only found through /etc/ld.so.conf.d, which image2 no longer has
+	expectedUnresolved := []utils.ElfUnresolved{{Path: "/usr/local/bin/tool", Libraries: []string{"libcrypto.so.1.0.0"}}}
+	if !reflect.DeepEqual(diff.Unresolved, expectedUnresolved) {
+		t.Errorf("Expected unresolved: %v but got: %v", expectedUnresolved, diff.Unresolved)
+	}
+}
@@ -0,0 +1,100 @@
+package differs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// ContentOptions configures the file differ's --show-content mode, in which unified diffs
+// are reported for modified text files.
+type ContentOptions struct {
+	// Paths are the directories within the image whose modified files have their content diffed.
+	Paths []string
+	// MaxFileSize is the largest file, in bytes, whose content is diffed.
+	MaxFileSize int64
+	// MaxTotalSize caps the combined size, in bytes, of all content diffs reported.
+	MaxTotalSize int64
+}
+
+// DefaultContentOptions diffs configuration files under /etc.
+var DefaultContentOptions = ContentOptions{
+	Paths:        []string{"/etc"},
+	MaxFileSize:  1 << 20,
+	MaxTotalSize: 10 << 20,
+}
+
+func (o ContentOptions) includes(path string) bool {
+	for _, dir := range o.Paths {
+		dir = "/" + strings.Trim(dir, "/")
+		if dir == "/" || path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// getModifiedFiles returns the regular files present in both images whose contents differ.
+func getModifiedFiles(files1, files2 map[string]utils.ImageFile) ([]string, error) {
+	modified := []string{}
+	for _, path := range utils.SortedImagePaths(files1) {
+		f1 := files1[path]
+		f2, ok := files2[path]
+		if !ok || !f1.Info.Mode().IsRegular() || !f2.Info.Mode().IsRegular() {
+			continue
+		}
+		same, err := utils.CheckSameFile(f1.FSPath, f2.FSPath)
+		if err != nil {
+			return modified, err
+		}
+		if !same {
+			modified = append(modified, path)
+		}
+	}
+	return modified, nil
+}
+
+func getContentDiffs(modified []string, files1, files2 map[string]utils.ImageFile, opts ContentOptions) ([]utils.FileContentDiff, error) {
+	contentDiffs := []utils.FileContentDiff{}
+	var total int64
+	for _, path := range modified {
+		if !opts.includes(path) {
+			continue
+		}
+		f1, f2 := files1[path], files2[path]
+		contentDiff := utils.FileContentDiff{Path: path, Size1: f1.Info.Size(), Size2: f2.Info.Size()}
+		switch {
+		case contentDiff.Size1 > opts.MaxFileSize || contentDiff.Size2 > opts.MaxFileSize:
+			contentDiff.Skipped = fmt.Sprintf("larger than %d bytes", opts.MaxFileSize)
+		case total >= opts.MaxTotalSize:
+			contentDiff.Skipped = fmt.Sprintf("total content diff limit of %d bytes reached", opts.MaxTotalSize)
+		default:
+			content1, err := ioutil.ReadFile(f1.FSPath)
+			if err != nil {
+				return contentDiffs, err
+			}
+			content2, err := ioutil.ReadFile(f2.FSPath)
+			if err != nil {
+				return contentDiffs, err
+			}
+			if utils.IsBinary(content1) || utils.IsBinary(content2) {
+				contentDiff.Binary = true
+				break
+			}
+			diff, err := utils.GetUnifiedDiff("a"+path, "b"+path, content1, content2)
+			if err != nil {
+				return contentDiffs, err
+			}
+			if total+int64(len(diff)) > opts.MaxTotalSize {
+				contentDiff.Skipped = fmt.Sprintf("total content diff limit of %d bytes reached", opts.MaxTotalSize)
+				break
+			}
+			total += int64(len(diff))
+			contentDiff.Diff = diff
+		}
+		contentDiffs = append(contentDiffs, contentDiff)
+	}
+	return contentDiffs, nil
+}
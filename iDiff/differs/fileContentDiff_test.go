@@ -0,0 +1,86 @@
+package differs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func writeImageFiles(t *testing.T, root string, files map[string]string) map[string]utils.ImageFile {
+	imageFiles := map[string]utils.ImageFile{}
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(full)
+		imageFiles[path] = utils.ImageFile{Path: path, FSPath: full, Info: info}
+	}
+	return imageFiles
+}
+
+func TestGetContentDiffs(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "content")
+	defer os.RemoveAll(dir)
+
+	files1 := writeImageFiles(t, filepath.Join(dir, "1"), map[string]string{
+		"/etc/nginx.conf": "worker_processes 1;\nuser www;\n",
+		"/etc/bin.db":     "a\x00b",
+		"/etc/big.conf":   strings.Repeat("x", 100),
+		"/etc/same.conf":  "same",
+		"/usr/lib/libc":   "old",
+	})
+	files2 := writeImageFiles(t, filepath.Join(dir, "2"), map[string]string{
+		"/etc/nginx.conf": "worker_processes 4;\nuser www;\n",
+		"/etc/bin.db":     "a\x00c",
+		"/etc/big.conf":   strings.Repeat("y", 100),
+		"/etc/same.conf":  "same",
+		"/usr/lib/libc":   "new",
+	})
+
+	modified, err := getModifiedFiles(files1, files2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expectedMods := []string{"/etc/big.conf", "/etc/bin.db", "/etc/nginx.conf", "/usr/lib/libc"}
+	if !reflect.DeepEqual(modified, expectedMods) {
+		t.Errorf("Expected: %s but got: %s", expectedMods, modified)
+	}
+
+	opts := ContentOptions{Paths: []string{"/etc/"}, MaxFileSize: 64, MaxTotalSize: 1024}
+	diffs, err := getContentDiffs(modified, files1, files2, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("Expected 3 content diffs but got: %v", diffs)
+	}
+	if diffs[0].Path != "/etc/big.conf" || diffs[0].Skipped == "" {
+		t.Errorf("Expected oversized file to be skipped but got: %v", diffs[0])
+	}
+	if diffs[1].Path != "/etc/bin.db" || !diffs[1].Binary || diffs[1].Diff != "" {
+		t.Errorf("Expected binary file to be summarised but got: %v", diffs[1])
+	}
+	expectedDiff := `--- a/etc/nginx.conf
++++ b/etc/nginx.conf
+@@ -1,2 +1,2 @@
+-worker_processes 1;
++worker_processes 4;
+ user www;
+`
+	if diffs[2].Diff != expectedDiff {
+		t.Errorf("Expected diff:\n%s\nbut got:\n%s", expectedDiff, diffs[2].Diff)
+	}
+
+	opts.MaxTotalSize = 10
+	diffs, _ = getContentDiffs(modified, files1, files2, opts)
+	if diffs[2].Diff != "" || diffs[2].Skipped == "" {
+		t.Errorf("Expected diff over the total limit to be skipped but got: %v", diffs[2])
+	}
+}
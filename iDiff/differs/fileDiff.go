@@ -2,22 +2,80 @@ package differs
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"sort"
 
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
 )
 
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "file",
+		Shorthand:   "f",
+		Description: "file differ",
+		Default:     true,
+		DiffType:    "FileDiffer",
+		Result:      utils.DirDiffResult{},
+		Template:    utils.FSOutput,
+		Differ:      FileDiffer{},
+	})
+}
+
 type FileDiffer struct {
+	// Content, if set, makes the differ report modified files along with unified diffs of their content.
+	Content *ContentOptions
+	// ByPackage makes the differ group added, removed and modified files by their owning package.
+	ByPackage bool
 }
 
 // FileDiff diffs two packages and compares their contents
 func (d FileDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
 	diff, err := diffImageFiles(image1, image2)
+	if err == nil && (d.Content != nil || d.ByPackage) {
+		err = d.diffImageFileSystems(image1, image2, &diff)
+	}
 	return &utils.DirDiffResult{DiffType: "FileDiffer", Diff: diff}, err
 }
 
+// diffImageFileSystems fills in the modified files of the merged image file systems,
+// along with their content diffs and owning packages as configured.
+func (d FileDiffer) diffImageFileSystems(image1, image2 utils.Image, diff *utils.DirDiff) error {
+	files1, err := utils.GetImageFiles(image1.FSPath)
+	if err != nil {
+		return fmt.Errorf("Error reading image %s files: %s", image1.Source, err)
+	}
+	files2, err := utils.GetImageFiles(image2.FSPath)
+	if err != nil {
+		return fmt.Errorf("Error reading image %s files: %s", image2.Source, err)
+	}
+
+	diff.Mods, err = getModifiedFiles(files1, files2)
+	if err != nil {
+		return err
+	}
+	if d.Content != nil {
+		diff.ContentDiffs, err = getContentDiffs(diff.Mods, files1, files2, *d.Content)
+		if err != nil {
+			return err
+		}
+	}
+	if d.ByPackage {
+		diff.Packages, diff.Unmanaged, err = getPackageFiles(files1, files2, diff.Mods)
+	}
+	return err
+}
+
+// Analyze lists the files contained in the layers of the image.
+func (d FileDiffer) Analyze(image utils.Image) (utils.AnalyzeResult, error) {
+	contents, err := getImageContents(image.FSPath)
+	if err != nil {
+		return &utils.ListAnalyzeResult{}, fmt.Errorf("Error parsing image %s contents: %s", image.FSPath, err)
+	}
+	files := getContentList(contents)
+	sort.Strings(files)
+	return &utils.ListAnalyzeResult{Image: image.Source, AnalyzeType: "FileDiffer", Analysis: files}, nil
+}
+
 func diffImageFiles(image1, image2 utils.Image) (utils.DirDiff, error) {
 	img1 := image1.FSPath
 	img2 := image2.FSPath
@@ -98,14 +156,7 @@ func getImageContents(pathToImage string) (map[string]utils.Directory, error) {
 	contents := map[string]utils.Directory{}
 	for _, layer := range utils.GetImageLayers(pathToImage) {
 		pathToLayer := filepath.Join(pathToImage, layer)
-		pathToJSON := layer + ".json"
-		err := utils.DirToJSON(pathToLayer, pathToJSON, true)
-		if err != nil {
-			return contents, fmt.Errorf("Could not convert layer %s in image %s contents to JSON: %s", layer, pathToImage, err)
-		}
-
-		layerDir, err := utils.GetDirectory(pathToJSON)
-		defer os.Remove(pathToJSON)
+		layerDir, err := utils.DirToDirectory(pathToLayer, true)
 		if err != nil {
 			return contents, fmt.Errorf("Could not get Directory struct for layer %s in image %s: %s", layer, pathToImage, err)
 		}
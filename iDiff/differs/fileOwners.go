@@ -0,0 +1,61 @@
+package differs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// getPackageFiles groups the files added to, removed from and modified between the merged
+// image file systems by the package owning them. Removed files are attributed using the
+// package databases of the first image, and added or modified files using those of the second.
+func getPackageFiles(files1, files2 map[string]utils.ImageFile, mods []string) ([]utils.PackageFiles, *utils.PackageFiles, error) {
+	owners1, err := utils.GetPackageOwners(files1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading package databases: %s", err)
+	}
+	owners2, err := utils.GetPackageOwners(files2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading package databases: %s", err)
+	}
+
+	byPackage := map[string]*utils.PackageFiles{}
+	unmanaged := &utils.PackageFiles{Adds: []string{}, Dels: []string{}, Mods: []string{}}
+	get := func(owners map[string]string, path string) *utils.PackageFiles {
+		pkg, ok := owners[path]
+		if !ok {
+			return unmanaged
+		}
+		if _, ok := byPackage[pkg]; !ok {
+			byPackage[pkg] = &utils.PackageFiles{Package: pkg, Adds: []string{}, Dels: []string{}, Mods: []string{}}
+		}
+		return byPackage[pkg]
+	}
+
+	for _, path := range utils.SortedImagePaths(files2) {
+		if _, ok := files1[path]; !ok && !files2[path].Info.IsDir() {
+			pkgFiles := get(owners2, path)
+			pkgFiles.Adds = append(pkgFiles.Adds, path)
+		}
+	}
+	for _, path := range utils.SortedImagePaths(files1) {
+		if _, ok := files2[path]; !ok && !files1[path].Info.IsDir() {
+			pkgFiles := get(owners1, path)
+			pkgFiles.Dels = append(pkgFiles.Dels, path)
+		}
+	}
+	for _, path := range mods {
+		pkgFiles := get(owners2, path)
+		pkgFiles.Mods = append(pkgFiles.Mods, path)
+	}
+
+	packages := []utils.PackageFiles{}
+	for _, pkgFiles := range byPackage {
+		packages = append(packages, *pkgFiles)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Package < packages[j].Package
+	})
+	return packages, unmanaged, nil
+}
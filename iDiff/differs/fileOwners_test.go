@@ -0,0 +1,59 @@
+package differs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func TestGetPackageFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "owners")
+	defer os.RemoveAll(dir)
+
+	files1 := writeImageFiles(t, filepath.Join(dir, "1"), map[string]string{
+		"/var/lib/dpkg/info/curl.list":            "/.\n/usr\n/usr/bin\n/usr/bin/curl\n",
+		"/var/lib/dpkg/info/libssl1.0:amd64.list": "/usr/lib\n/usr/lib/libssl.so.1.0\n",
+		"/usr/bin/curl":                           "curl 1",
+		"/usr/lib/libssl.so.1.0":                  "ssl 1.0",
+		"/opt/app/old.jar":                        "old",
+	})
+	files2 := writeImageFiles(t, filepath.Join(dir, "2"), map[string]string{
+		"/var/lib/dpkg/info/curl.list":            "/.\n/usr\n/usr/bin\n/usr/bin/curl\n",
+		"/var/lib/dpkg/info/libssl1.1:amd64.list": "/usr/lib\n/usr/lib/libssl.so.1.1\n",
+		"/lib/apk/db/installed":                   "P:musl\nV:1.1\nF:lib\nR:ld-musl.so.1\n\nP:busybox\nF:bin\nR:busybox\n",
+		"/lib/ld-musl.so.1":                       "musl",
+		"/usr/bin/curl":                           "curl 2",
+		"/usr/lib/libssl.so.1.1":                  "ssl 1.1",
+		"/opt/app/new.jar":                        "new",
+	})
+	mods, err := getModifiedFiles(files1, files2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	packages, unmanaged, err := getPackageFiles(files1, files2, mods)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := []utils.PackageFiles{
+		{Package: "curl", Adds: []string{}, Dels: []string{}, Mods: []string{"/usr/bin/curl"}},
+		{Package: "libssl1.0", Adds: []string{}, Dels: []string{"/usr/lib/libssl.so.1.0"}, Mods: []string{}},
+		{Package: "libssl1.1", Adds: []string{"/usr/lib/libssl.so.1.1"}, Dels: []string{}, Mods: []string{}},
+		{Package: "musl", Adds: []string{"/lib/ld-musl.so.1"}, Dels: []string{}, Mods: []string{}},
+	}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, packages)
+	}
+	expectedUnmanaged := &utils.PackageFiles{
+		Adds: []string{"/lib/apk/db/installed", "/opt/app/new.jar", "/var/lib/dpkg/info/libssl1.1:amd64.list"},
+		Dels: []string{"/opt/app/old.jar", "/var/lib/dpkg/info/libssl1.0:amd64.list"},
+		Mods: []string{},
+	}
+	if !reflect.DeepEqual(unmanaged, expectedUnmanaged) {
+		t.Errorf("Expected unmanaged: %v but got: %v", expectedUnmanaged, unmanaged)
+	}
+}
@@ -4,6 +4,19 @@ import (
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
 )
 
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "history",
+		Shorthand:   "d",
+		Description: "dockerfile history differ",
+		Default:     true,
+		DiffType:    "HistoryDiffer",
+		Result:      utils.HistDiffResult{},
+		Template:    utils.HistoryOutput,
+		Differ:      HistoryDiffer{},
+	})
+}
+
 type HistoryDiffer struct {
 }
 
@@ -12,12 +25,18 @@ func (d HistoryDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error
 	return &utils.HistDiffResult{DiffType: "HistoryDiffer", Diff: diff}, err
 }
 
+// Analyze lists the Dockerfile history of the image.
+func (d HistoryDiffer) Analyze(image utils.Image) (utils.AnalyzeResult, error) {
+	return &utils.ListAnalyzeResult{Image: image.Source, AnalyzeType: "HistoryDiffer", Analysis: image.History}, nil
+}
+
 func getHistoryDiff(image1, image2 utils.Image) (utils.HistDiff, error) {
 	history1 := image1.History
 	history2 := image2.History
 
 	adds := utils.GetAdditions(history1, history2)
 	dels := utils.GetDeletions(history1, history2)
-	diff := utils.HistDiff{image1.Source, image2.Source, adds, dels}
+	steps := utils.GetHistoryStepDiff(image1.Steps, image2.Steps)
+	diff := utils.HistDiff{Image1: image1.Source, Image2: image2.Source, Adds: adds, Dels: dels, Steps: steps}
 	return diff, nil
 }
@@ -4,13 +4,26 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
 	"github.com/golang/glog"
 )
 
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "node",
+		Shorthand:   "n",
+		Description: "node differ",
+		Default:     true,
+		DiffType:    "NodeDiffer",
+		Result:      utils.MultiVersionPackageDiffResult{},
+		Template:    utils.MultiVersionOutput,
+		Differ:      NodeDiffer{},
+	})
+}
+
 type NodeDiffer struct {
 }
 
@@ -20,6 +33,11 @@ func (d NodeDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
 	return diff, err
 }
 
+// Analyze lists the packages installed by npm in the image.
+func (d NodeDiffer) Analyze(image utils.Image) (utils.AnalyzeResult, error) {
+	return multiVersionAnalysis(image, d)
+}
+
 func buildNodePaths(path string) ([]string, error) {
 	globalPaths, err := utils.BuildLayerTargets(path, "layer/node_modules")
 	if err != nil {
@@ -40,8 +58,23 @@ func (d NodeDiffer) getPackages(path string) (map[string]map[string]utils.Packag
 		glog.Warningf("Error building JSON paths at %s: %s\n", path, err)
 		return packages, err
 	}
+	err = readNodeModules(layerStems, packages)
+	return packages, err
+}
 
-	for _, modulesDir := range layerStems {
+// getLayerPackages lists the packages in the global and local node_modules folders of a single layer.
+func (d NodeDiffer) getLayerPackages(pathToLayer string) (map[string]map[string]utils.PackageInfo, error) {
+	packages := make(map[string]map[string]utils.PackageInfo)
+	modulesDirs := []string{
+		filepath.Join(pathToLayer, "layer/node_modules"),
+		filepath.Join(pathToLayer, "layer/usr/local/lib/node_modules"),
+	}
+	err := readNodeModules(modulesDirs, packages)
+	return packages, err
+}
+
+func readNodeModules(modulesDirs []string, packages map[string]map[string]utils.PackageInfo) error {
+	for _, modulesDir := range modulesDirs {
 		packageJSONs, _ := utils.BuildLayerTargets(modulesDir, "package.json")
 		for _, currPackage := range packageJSONs {
 			if _, err := os.Stat(currPackage); err != nil {
@@ -51,7 +84,7 @@ func (d NodeDiffer) getPackages(path string) (map[string]map[string]utils.Packag
 			packageJSON, err := readPackageJSON(currPackage)
 			if err != nil {
 				glog.Warningf("Error reading package JSON at %s: %s\n", currPackage, err)
-				return packages, err
+				return err
 			}
 			// Build PackageInfo for this package occurence
 			var currInfo utils.PackageInfo
@@ -60,9 +93,9 @@ func (d NodeDiffer) getPackages(path string) (map[string]map[string]utils.Packag
 			size, err := utils.GetDirectorySize(packagePath)
 			if err != nil {
 				glog.Warningf("Error getting package size at %s: %s\n", currPackage, err)
-				return packages, err
+				return err
 			}
-			currInfo.Size = strconv.FormatInt(size, 10)
+			currInfo.Size = size
 
 			// Check if other package version already recorded
 			if _, ok := packages[packageJSON.Name]; !ok {
@@ -76,7 +109,7 @@ func (d NodeDiffer) getPackages(path string) (map[string]map[string]utils.Packag
 
 		}
 	}
-	return packages, nil
+	return nil
 }
 
 type nodePackage struct {
@@ -96,3 +129,8 @@ func readPackageJSON(path string) (nodePackage, error) {
 	}
 	return currPackage, err
 }
+
+// sbomPackageType is the package URL type of the packages the differ compares.
+func (d NodeDiffer) sbomPackageType() string {
+	return "npm"
+}
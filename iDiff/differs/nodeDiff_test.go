@@ -29,27 +29,27 @@ func TestGetNodePackages(t *testing.T) {
 			descrip: "all packages in one layer",
 			path:    "testDirs/packageOne",
 			expected: map[string]map[string]utils.PackageInfo{
-				"pac1": {"testDirs/packageOne/layer1/layer/node_modules/pac1/package.json": {Version: "1.0", Size: "41"}},
-				"pac2": {"testDirs/packageOne/layer1/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "2.0", Size: "41"}},
-				"pac3": {"testDirs/packageOne/layer1/layer/node_modules/pac3/package.json": {Version: "3.0", Size: "41"}}},
+				"pac1": {"testDirs/packageOne/layer1/layer/node_modules/pac1/package.json": {Version: "1.0", Size: 41}},
+				"pac2": {"testDirs/packageOne/layer1/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "2.0", Size: 41}},
+				"pac3": {"testDirs/packageOne/layer1/layer/node_modules/pac3/package.json": {Version: "3.0", Size: 41}}},
 		},
 		{
 			descrip: "many packages in different layers",
 			path:    "testDirs/packageMany",
 			expected: map[string]map[string]utils.PackageInfo{
-				"pac1": {"testDirs/packageMany/layer1/layer/node_modules/pac1/package.json": {Version: "1.0", Size: "41"}},
-				"pac2": {"testDirs/packageMany/layer1/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "2.0", Size: "41"}},
-				"pac3": {"testDirs/packageMany/layer2/layer/node_modules/pac3/package.json": {Version: "3.0", Size: "41"}},
-				"pac4": {"testDirs/packageMany/layer2/layer/node_modules/pac4/package.json": {Version: "4.0", Size: "41"}},
-				"pac5": {"testDirs/packageMany/layer2/layer/node_modules/pac5/package.json": {Version: "5.0", Size: "41"}}},
+				"pac1": {"testDirs/packageMany/layer1/layer/node_modules/pac1/package.json": {Version: "1.0", Size: 41}},
+				"pac2": {"testDirs/packageMany/layer1/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "2.0", Size: 41}},
+				"pac3": {"testDirs/packageMany/layer2/layer/node_modules/pac3/package.json": {Version: "3.0", Size: 41}},
+				"pac4": {"testDirs/packageMany/layer2/layer/node_modules/pac4/package.json": {Version: "4.0", Size: 41}},
+				"pac5": {"testDirs/packageMany/layer2/layer/node_modules/pac5/package.json": {Version: "5.0", Size: 41}}},
 		},
 		{
 			descrip: "Multi version packages",
 			path:    "testDirs/packageMulti",
 			expected: map[string]map[string]utils.PackageInfo{
-				"pac1": {"testDirs/packageMulti/layer1/layer/node_modules/pac1/package.json": {Version: "1.0", Size: "41"}},
-				"pac2": {"testDirs/packageMulti/layer1/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "2.0", Size: "41"},
-					"testDirs/packageMulti/layer2/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "3.0", Size: "41"}}},
+				"pac1": {"testDirs/packageMulti/layer1/layer/node_modules/pac1/package.json": {Version: "1.0", Size: 41}},
+				"pac2": {"testDirs/packageMulti/layer1/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "2.0", Size: 41},
+					"testDirs/packageMulti/layer2/layer/usr/local/lib/node_modules/pac2/package.json": {Version: "3.0", Size: 41}}},
 		},
 	}
 
@@ -63,7 +63,7 @@ func TestGetNodePackages(t *testing.T) {
 			t.Errorf("Expected error but got none.")
 		}
 		if !reflect.DeepEqual(packages, test.expected) {
-			t.Errorf("Expected: %s but got: %s", test.expected, packages)
+			t.Errorf("Expected: %v but got: %v", test.expected, packages)
 		}
 	}
 }
@@ -99,7 +99,7 @@ func TestReadPackageJSON(t *testing.T) {
 			t.Error("Expected errorbut got none.")
 		}
 		if !reflect.DeepEqual(actual, test.expected) {
-			t.Errorf("Expected: %s but got: %s", test.expected, actual)
+			t.Errorf("Expected: %v but got: %v", test.expected, actual)
 		}
 	}
 }
@@ -1,51 +1,285 @@
 package differs
 
 import (
-	"reflect"
+	"path/filepath"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
 )
 
 type MultiVersionPackageDiffer interface {
 	getPackages(path string) (map[string]map[string]utils.PackageInfo, error)
+	getLayerPackages(pathToLayer string) (map[string]map[string]utils.PackageInfo, error)
+	sbomPackageType() string
 }
 
 type SingleVersionPackageDiffer interface {
 	getPackages(path string) (map[string]utils.PackageInfo, error)
+	getLayerPackages(pathToLayer string) (map[string]utils.PackageInfo, error)
+	sbomPackageType() string
 }
 
-func multiVersionDiff(image1, image2 utils.Image, differ MultiVersionPackageDiffer) (utils.DiffResult, error) {
-	img1FS := image1.FSPath
-	img2FS := image2.FSPath
+// SupportsSBOM returns whether the differ can be run on images sourced from a software bill
+// of materials, which list packages but have no file system.
+func SupportsSBOM(differ interface{}) bool {
+	switch differ.(type) {
+	case SingleVersionPackageDiffer, MultiVersionPackageDiffer:
+		return true
+	}
+	return false
+}
 
-	pack1, err := differ.getPackages(img1FS)
+func multiVersionDiff(image1, image2 utils.Image, differ MultiVersionPackageDiffer) (utils.DiffResult, error) {
+	pack1, err := getMultiVersionPackages(image1, differ)
 	if err != nil {
 		return &utils.MultiVersionPackageDiffResult{}, err
 	}
-	pack2, err := differ.getPackages(img2FS)
+	pack2, err := getMultiVersionPackages(image2, differ)
 	if err != nil {
 		return &utils.MultiVersionPackageDiffResult{}, err
 	}
+	if image1.SBOM != nil || image2.SBOM != nil {
+		pack1 = comparableMultiVersionPackages(pack1, differ)
+		pack2 = comparableMultiVersionPackages(pack2, differ)
+	}
 
 	diff := utils.GetMultiVersionMapDiff(pack1, pack2, image1.Source, image2.Source)
-	diff.DiffType = reflect.TypeOf(differ).Name()
-	return &diff, nil
+	diff.DiffType = differName(differ)
+	if image2.SBOM != nil {
+		return &diff, nil
+	}
+	err = setMultiVersionIntroducedBy(image2, differ, &diff.Diff)
+	return &diff, err
 }
 
 func singleVersionDiff(image1, image2 utils.Image, differ SingleVersionPackageDiffer) (utils.DiffResult, error) {
-	img1FS := image1.FSPath
-	img2FS := image2.FSPath
-
-	pack1, err := differ.getPackages(img1FS)
+	pack1, err := getSingleVersionPackages(image1, differ)
 	if err != nil {
 		return &utils.PackageDiffResult{}, err
 	}
-	pack2, err := differ.getPackages(img2FS)
+	pack2, err := getSingleVersionPackages(image2, differ)
 	if err != nil {
 		return &utils.PackageDiffResult{}, err
 	}
+	if image1.SBOM != nil || image2.SBOM != nil {
+		pack1 = comparableSingleVersionPackages(pack1, differ)
+		pack2 = comparableSingleVersionPackages(pack2, differ)
+	}
 
 	diff := utils.GetMapDiff(pack1, pack2, image1.Source, image2.Source)
-	diff.DiffType = reflect.TypeOf(differ).Name()
-	return &diff, nil
+	diff.DiffType = differName(differ)
+	if image2.SBOM != nil {
+		return &diff, nil
+	}
+	err = setSingleVersionIntroducedBy(image2, differ, &diff.Diff)
+	return &diff, err
+}
+
+func multiVersionAnalysis(image utils.Image, differ MultiVersionPackageDiffer) (utils.AnalyzeResult, error) {
+	packs, err := getMultiVersionPackages(image, differ)
+	if err != nil {
+		return &utils.MultiVersionPackageAnalyzeResult{}, err
+	}
+
+	analysis := utils.MultiVersionPackageAnalyzeResult{
+		Image:       image.Source,
+		AnalyzeType: differName(differ),
+		Analysis:    packs,
+	}
+	return &analysis, nil
+}
+
+func singleVersionAnalysis(image utils.Image, differ SingleVersionPackageDiffer) (utils.AnalyzeResult, error) {
+	packs, err := getSingleVersionPackages(image, differ)
+	if err != nil {
+		return &utils.PackageAnalyzeResult{}, err
+	}
+
+	analysis := utils.PackageAnalyzeResult{
+		Image:       image.Source,
+		AnalyzeType: differName(differ),
+		Analysis:    packs,
+	}
+	return &analysis, nil
+}
+
+// getSingleVersionPackages lists the differ's packages from the image's SBOM, if it was sourced
+// from one, or else from its file system.
+func getSingleVersionPackages(image utils.Image, differ SingleVersionPackageDiffer) (map[string]utils.PackageInfo, error) {
+	if image.SBOM == nil {
+		return differ.getPackages(image.FSPath)
+	}
+	packages := map[string]utils.PackageInfo{}
+	for _, pkg := range image.SBOM {
+		if pkg.Type != differ.sbomPackageType() {
+			continue
+		}
+		version := pkg.Version
+		if pkg.Type == "deb" {
+			// Match the apt differ, which replaces the first "+" of versions with a space.
+			version = strings.Replace(version, "+", " ", 1)
+		}
+		packages[pkg.Name] = utils.PackageInfo{Version: version}
+	}
+	return packages, nil
+}
+
+// getMultiVersionPackages lists the differ's packages from the image's SBOM, if it was sourced
+// from one, or else from its file system.  SBOMs do not record where packages are installed,
+// so each version of an SBOM package is keyed by the version itself.
+func getMultiVersionPackages(image utils.Image, differ MultiVersionPackageDiffer) (map[string]map[string]utils.PackageInfo, error) {
+	if image.SBOM == nil {
+		return differ.getPackages(image.FSPath)
+	}
+	packages := map[string]map[string]utils.PackageInfo{}
+	for _, pkg := range image.SBOM {
+		if pkg.Type != differ.sbomPackageType() {
+			continue
+		}
+		if _, ok := packages[pkg.Name]; !ok {
+			packages[pkg.Name] = map[string]utils.PackageInfo{}
+		}
+		packages[pkg.Name][pkg.Version] = utils.PackageInfo{Version: pkg.Version}
+	}
+	return packages, nil
+}
+
+// comparableSingleVersionPackages drops what an SBOM does not record, package sizes, so that
+// packages listed by an SBOM compare equal to those installed in an image.
+func comparableSingleVersionPackages(packages map[string]utils.PackageInfo, differ SingleVersionPackageDiffer) map[string]utils.PackageInfo {
+	stripped := map[string]utils.PackageInfo{}
+	for name, info := range packages {
+		stripped[sbomPackageName(name, differ.sbomPackageType())] = utils.PackageInfo{Version: info.Version}
+	}
+	return stripped
+}
+
+// comparableMultiVersionPackages drops what an SBOM does not record, package sizes and
+// install locations, so that packages listed by an SBOM compare equal to those installed in an image.
+func comparableMultiVersionPackages(packages map[string]map[string]utils.PackageInfo, differ MultiVersionPackageDiffer) map[string]map[string]utils.PackageInfo {
+	stripped := map[string]map[string]utils.PackageInfo{}
+	for name, infos := range packages {
+		name = sbomPackageName(name, differ.sbomPackageType())
+		if _, ok := stripped[name]; !ok {
+			stripped[name] = map[string]utils.PackageInfo{}
+		}
+		for _, info := range infos {
+			stripped[name][info.Version] = utils.PackageInfo{Version: info.Version}
+		}
+	}
+	return stripped
+}
+
+// sbomPackageName normalises package names as package URLs do, so that names read from an
+// image match those read from an SBOM.
+func sbomPackageName(name, packageType string) string {
+	if packageType == "pypi" {
+		return strings.ToLower(strings.Replace(name, "_", "-", -1))
+	}
+	return name
+}
+
+// getLayerSteps returns the directory of each layer of the image, from the base layer up,
+// along with the command of the history step which created it where the history records one.
+func getLayerSteps(image utils.Image) ([]string, []string) {
+	layers := []string{}
+	for _, root := range utils.GetLayerRoots(image.FSPath) {
+		layers = append(layers, filepath.Dir(root))
+	}
+	steps := []string{}
+	for _, step := range image.Steps {
+		if !step.EmptyLayer {
+			steps = append(steps, step.CreatedBy)
+		}
+	}
+	if len(steps) != len(layers) {
+		glog.Warningf("Image %s has %d history steps creating layers but %d layers, package changes may not be attributed to steps", image.Source, len(steps), len(layers))
+	}
+	for len(steps) < len(layers) {
+		steps = append(steps, "")
+	}
+	return layers, steps
+}
+
+// setSingleVersionIntroducedBy records, for each package added or changed in the second image,
+// the history step of the first layer in which the package appears at its new version.
+func setSingleVersionIntroducedBy(image utils.Image, differ SingleVersionPackageDiffer, diff *utils.PackageDiff) error {
+	if len(diff.Packages2) == 0 && len(diff.InfoDiff) == 0 {
+		return nil
+	}
+	layers, steps := getLayerSteps(image)
+	layerPackages := []map[string]utils.PackageInfo{}
+	for _, layer := range layers {
+		packages, err := differ.getLayerPackages(layer)
+		if err != nil {
+			return err
+		}
+		layerPackages = append(layerPackages, packages)
+	}
+	introducedBy := func(name, version string) string {
+		for i, packages := range layerPackages {
+			if info, ok := packages[name]; ok && info.Version == version {
+				return steps[i]
+			}
+		}
+		return ""
+	}
+
+	diff.IntroducedBy = map[string]string{}
+	for name, info := range diff.Packages2 {
+		diff.IntroducedBy[name] = introducedBy(name, info.Version)
+	}
+	for _, info := range diff.InfoDiff {
+		diff.IntroducedBy[info.Package] = introducedBy(info.Package, info.Info2.Version)
+	}
+	return nil
+}
+
+// setMultiVersionIntroducedBy records, for each package version added or changed in the second image,
+// the history step of the first layer in which the package appears at that version.
+func setMultiVersionIntroducedBy(image utils.Image, differ MultiVersionPackageDiffer, diff *utils.MultiVersionPackageDiff) error {
+	if len(diff.Packages2) == 0 && len(diff.InfoDiff) == 0 {
+		return nil
+	}
+	layers, steps := getLayerSteps(image)
+	layerPackages := []map[string]map[string]utils.PackageInfo{}
+	for _, layer := range layers {
+		packages, err := differ.getLayerPackages(layer)
+		if err != nil {
+			return err
+		}
+		layerPackages = append(layerPackages, packages)
+	}
+	introducedBy := func(name, version string) string {
+		for i, packages := range layerPackages {
+			for _, info := range packages[name] {
+				if info.Version == version {
+					return steps[i]
+				}
+			}
+		}
+		return ""
+	}
+
+	diff.IntroducedBy = map[string]map[string]string{}
+	record := func(name string, infos []utils.PackageInfo) {
+		if _, ok := diff.IntroducedBy[name]; !ok {
+			diff.IntroducedBy[name] = map[string]string{}
+		}
+		for _, info := range infos {
+			diff.IntroducedBy[name][info.Version] = introducedBy(name, info.Version)
+		}
+	}
+	for name, infos := range diff.Packages2 {
+		versions := []utils.PackageInfo{}
+		for _, info := range infos {
+			versions = append(versions, info)
+		}
+		record(name, versions)
+	}
+	for _, info := range diff.InfoDiff {
+		record(info.Package, info.Info2)
+	}
+	return nil
 }
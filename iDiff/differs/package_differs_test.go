@@ -0,0 +1,69 @@
+package differs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+const introducedByConfig = `{"history": [
+	{"created_by": "ADD rootfs.tar /"},
+	{"created_by": "ENV DEBIAN_FRONTEND=noninteractive", "empty_layer": true},
+	{"created_by": "RUN apt-get install -y curl"},
+	{"created_by": "RUN npm install -g left-pad"}
+]}`
+
+func TestIntroducedBy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "introduced")
+	defer os.RemoveAll(dir)
+
+	status := func(packages ...string) testEntry {
+		content := ""
+		for i := 0; i+1 < len(packages); i += 2 {
+			content += "Package: " + packages[i] + "\nVersion: " + packages[i+1] + "\nInstalled-Size: 1\n\n"
+		}
+		return testEntry{content: content}
+	}
+	image1 := writeTestImage(t, filepath.Join(dir, "image1"), `{"history": [{"created_by": "ADD rootfs.tar /"}]}`, []map[string]testEntry{
+		{"var/lib/dpkg/status": status("libc6", "2.19")},
+	})
+	image2 := writeTestImage(t, filepath.Join(dir, "image2"), introducedByConfig, []map[string]testEntry{
+		{"var/lib/dpkg/status": status("libc6", "2.19")},
+		{"var/lib/dpkg/status": status("libc6", "2.19", "curl", "7.52")},
+		{
+			"var/lib/dpkg/status":                              status("libc6", "2.19", "curl", "7.52"),
+			"usr/local/lib/node_modules/left-pad/package.json": {content: `{"name": "left-pad", "version": "1.1.3"}`},
+		},
+	})
+	steps, err := utils.GetHistorySteps(image2.FSPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image2.Steps = steps
+
+	result, err := singleVersionDiff(image1, image2, AptDiffer{})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := map[string]string{
+		"curl": "RUN apt-get install -y curl",
+	}
+	if introducedBy := result.(*utils.PackageDiffResult).Diff.IntroducedBy; !reflect.DeepEqual(introducedBy, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, introducedBy)
+	}
+
+	result, err = multiVersionDiff(image1, image2, NodeDiffer{})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expectedMulti := map[string]map[string]string{
+		"left-pad": {"1.1.3": "RUN npm install -g left-pad"},
+	}
+	if introducedBy := result.(*utils.MultiVersionPackageDiffResult).Diff.IntroducedBy; !reflect.DeepEqual(introducedBy, expectedMulti) {
+		t.Errorf("Expected: %v but got: %v", expectedMulti, introducedBy)
+	}
+}
@@ -4,12 +4,24 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
-	"strconv"
 
 	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
 	"github.com/golang/glog"
 )
 
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "pip",
+		Shorthand:   "p",
+		Description: "pip differ",
+		Default:     true,
+		DiffType:    "PipDiffer",
+		Result:      utils.PackageDiffResult{},
+		Template:    utils.SingleVersionOutput,
+		Differ:      PipDiffer{},
+	})
+}
+
 type PipDiffer struct {
 }
 
@@ -19,6 +31,11 @@ func (d PipDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
 	return diff, err
 }
 
+// Analyze lists the packages installed by pip in the image.
+func (d PipDiffer) Analyze(image utils.Image) (utils.AnalyzeResult, error) {
+	return singleVersionAnalysis(image, d)
+}
+
 func getPythonVersion(pathToLayer string) (string, bool) {
 	libPath := filepath.Join(pathToLayer, "/layer/usr/local/lib")
 	libContents, err := ioutil.ReadDir(libPath)
@@ -43,54 +60,69 @@ func (d PipDiffer) getPackages(path string) (map[string]utils.PackageInfo, error
 	// with that of another image to get only the layers that have changed.
 	layers := utils.GetImageLayers(path)
 	for _, layer := range layers {
-		pathToLayer := filepath.Join(path, layer)
-		pythonVersion, exists := getPythonVersion(pathToLayer)
-		if !exists {
-			// layer doesn't have a Python folder installed
-			continue
-		}
-		packagesPath := filepath.Join(pathToLayer, "layer/usr/local/lib", pythonVersion, "site-packages")
-		contents, err := ioutil.ReadDir(packagesPath)
+		layerPackages, err := d.getLayerPackages(filepath.Join(path, layer))
 		if err != nil {
-			// layer's Python folder doesn't have a site-packages folder
-			continue
+			return packages, err
+		}
+		for name, info := range layerPackages {
+			packages[name] = info
 		}
+	}
 
-		for i := 0; i < len(contents); i++ {
-			c := contents[i]
-			fileName := c.Name()
-
-			// check if package
-			packageDir := regexp.MustCompile("^([a-z|A-Z]+)-(([0-9]+?\\.){3})dist-info$")
-			packageMatch := packageDir.FindStringSubmatch(fileName)
-			if len(packageMatch) != 0 {
-				packageName := packageMatch[1]
-				version := packageMatch[2][:len(packageMatch[2])-1]
-
-				// Retrieves size for actual package/script corresponding to each dist-info metadata directory
-				// by taking the file entry alphabetically before it (for a package) or after it (for a script)
-				var size string
-				if i-1 >= 0 && contents[i-1].Name() == packageName {
-					packagePath := filepath.Join(packagesPath, packageName)
-					intSize, err := utils.GetDirectorySize(packagePath)
-					if err != nil {
-						glog.Errorf("Could not obtain size for package %s", packagePath)
-						size = ""
-					} else {
-						size = strconv.FormatInt(intSize, 10)
-					}
-				} else if i+1 < len(contents) && contents[i+1].Name() == packageName+".py" {
-					size = strconv.FormatInt(contents[i+1].Size(), 10)
-
-				} else {
-					glog.Errorf("Could not find Python package %s for corresponding metadata info", packageName)
-					continue
+	return packages, nil
+}
+
+// getLayerPackages lists the packages in the Python site-packages folder of a single layer.
+func (d PipDiffer) getLayerPackages(pathToLayer string) (map[string]utils.PackageInfo, error) {
+	packages := make(map[string]utils.PackageInfo)
+	pythonVersion, exists := getPythonVersion(pathToLayer)
+	if !exists {
+		// layer doesn't have a Python folder installed
+		return packages, nil
+	}
+	packagesPath := filepath.Join(pathToLayer, "layer/usr/local/lib", pythonVersion, "site-packages")
+	contents, err := ioutil.ReadDir(packagesPath)
+	if err != nil {
+		// layer's Python folder doesn't have a site-packages folder
+		return packages, nil
+	}
+
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+		fileName := c.Name()
+
+		// check if package
+		packageDir := regexp.MustCompile("^([a-z|A-Z]+)-(([0-9]+?\\.){3})dist-info$")
+		packageMatch := packageDir.FindStringSubmatch(fileName)
+		if len(packageMatch) != 0 {
+			packageName := packageMatch[1]
+			version := packageMatch[2][:len(packageMatch[2])-1]
+
+			// Retrieves size for actual package/script corresponding to each dist-info metadata directory
+			// by taking the file entry alphabetically before it (for a package) or after it (for a script)
+			var size int64
+			if i-1 >= 0 && contents[i-1].Name() == packageName {
+				packagePath := filepath.Join(packagesPath, packageName)
+				var err error
+				if size, err = utils.GetDirectorySize(packagePath); err != nil {
+					glog.Errorf("Could not obtain size for package %s", packagePath)
+					size = 0
 				}
+			} else if i+1 < len(contents) && contents[i+1].Name() == packageName+".py" {
+				size = contents[i+1].Size()
 
-				packages[packageName] = utils.PackageInfo{Version: version, Size: size}
+			} else {
+				glog.Errorf("Could not find Python package %s for corresponding metadata info", packageName)
+				continue
 			}
+
+			packages[packageName] = utils.PackageInfo{Version: version, Size: size}
 		}
 	}
-
 	return packages, nil
 }
+
+// sbomPackageType is the package URL type of the packages the differ compares.
+func (d PipDiffer) sbomPackageType() string {
+	return "pypi"
+}
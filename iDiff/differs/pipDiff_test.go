@@ -43,7 +43,7 @@ func TestGetPythonVersion(t *testing.T) {
 				t.Errorf("Expected failure finding version but found one: %s", version)
 			}
 		} else if version != test.expectedVersion {
-			t.Errorf("Expected: %s.  Got: %s", test.expectedVersion, version)
+			t.Errorf("Expected: %v.  Got: %s", test.expectedVersion, version)
 		}
 	}
 }
@@ -60,17 +60,17 @@ func TestGetPythonPackages(t *testing.T) {
 		{
 			path: "testDirs/pipTests/packagesManyLayers",
 			expectedPackages: map[string]utils.PackageInfo{
-				"packageone":   {Version: "3.6.9", Size: "0"},
-				"packagetwo":   {Version: "4.6.2", Size: "0"},
-				"packagethree": {Version: "2.4.5", Size: "0"},
-				"packagefour":  {Version: "2.4.6", Size: "0"},
+				"packageone":   {Version: "3.6.9", Size: 0},
+				"packagetwo":   {Version: "4.6.2", Size: 0},
+				"packagethree": {Version: "2.4.5", Size: 0},
+				"packagefour":  {Version: "2.4.6", Size: 0},
 			},
 		},
 		{
 			path: "testDirs/pipTests/packagesOneLayer",
 			expectedPackages: map[string]utils.PackageInfo{
-				"packageone": {Version: "3.6.9", Size: "0"},
-				"packagetwo": {Version: "4.6.2", Size: "0"},
+				"packageone": {Version: "3.6.9", Size: 0},
+				"packagetwo": {Version: "4.6.2", Size: 0},
 			},
 		},
 	}
@@ -78,7 +78,7 @@ func TestGetPythonPackages(t *testing.T) {
 		d := PipDiffer{}
 		packages, _ := d.getPackages(test.path)
 		if !reflect.DeepEqual(packages, test.expectedPackages) {
-			t.Errorf("Expected: %s but got: %s", test.expectedPackages, packages)
+			t.Errorf("Expected: %v but got: %v", test.expectedPackages, packages)
 		}
 	}
 }
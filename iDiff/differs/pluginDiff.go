@@ -0,0 +1,139 @@
+package differs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+// PluginPrefix is the file name prefix identifying external differ executables.
+// An executable named idiff-differ-rpm provides the differ "rpm".
+const PluginPrefix = "idiff-differ-"
+
+// PluginDiffer runs an external differ executable.  The executable is invoked with the
+// extracted file system roots of the two images as its arguments, with the image names
+// in the IDIFF_IMAGE1 and IDIFF_IMAGE2 environment variables.  It must print a JSON
+// object with Adds, Dels and Mods string lists to stdout and exit zero.
+type PluginDiffer struct {
+	Name string
+	Path string
+}
+
+func (d PluginDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
+	return d.DiffContext(context.Background(), image1, image2)
+}
+
+// DiffContext runs the plugin, killing it if ctx is cancelled before it exits.
+func (d PluginDiffer) DiffContext(ctx context.Context, image1, image2 utils.Image) (utils.DiffResult, error) {
+	diff, err := d.runPlugin(ctx, image1, image2)
+	return &utils.PluginDiffResult{DiffType: d.DiffType(), Diff: diff}, err
+}
+
+// DiffType names the plugin in output and results.
+func (d PluginDiffer) DiffType() string {
+	return "PluginDiffer:" + d.Name
+}
+
+func (d PluginDiffer) runPlugin(ctx context.Context, image1, image2 utils.Image) (utils.PluginDiff, error) {
+	diff := utils.PluginDiff{Image1: image1.Source, Image2: image2.Source}
+
+	cmd := exec.CommandContext(ctx, d.Path, image1.FSPath, image2.FSPath)
+	// Children of a killed plugin may hold its output open, so stop waiting for them.
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(), "IDIFF_IMAGE1="+image1.Source, "IDIFF_IMAGE2="+image2.Source)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return diff, fmt.Errorf("Plugin %s was stopped: %s", d.Path, ctx.Err())
+		}
+		return diff, fmt.Errorf("Plugin %s failed: %s: %s", d.Path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), &diff); err != nil {
+		return diff, fmt.Errorf("Could not parse output of plugin %s: %s", d.Path, err)
+	}
+	// The image names are always those given to the plugin, whatever it printed.
+	diff.Image1 = image1.Source
+	diff.Image2 = image2.Source
+	sort.Strings(diff.Adds)
+	sort.Strings(diff.Dels)
+	sort.Strings(diff.Mods)
+	return diff, nil
+}
+
+// DiscoverPlugins finds differ executables in the given directories followed by those on PATH.
+// As with PATH lookup, the first executable found for a name wins.
+func DiscoverPlugins(dirs []string) map[string]PluginDiffer {
+	searchDirs := append([]string{}, dirs...)
+	searchDirs = append(searchDirs, filepath.SplitList(os.Getenv("PATH"))...)
+
+	plugins := map[string]PluginDiffer{}
+	for _, dir := range searchDirs {
+		if dir == "" {
+			continue
+		}
+		contents, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range contents {
+			name := strings.TrimPrefix(file.Name(), PluginPrefix)
+			if name == file.Name() || name == "" || !isExecutable(file) {
+				continue
+			}
+			if _, exists := plugins[name]; exists {
+				continue
+			}
+			plugins[name] = PluginDiffer{Name: name, Path: filepath.Join(dir, file.Name())}
+		}
+	}
+	return plugins
+}
+
+// GetDiffersWithPlugins is GetDiffers which also finds the named differs which are not built in
+// among the plugins discovered in the directories and on PATH.  Plugins are only run when named,
+// and may not replace a built-in differ.
+func GetDiffersWithPlugins(diffNames []string, pluginDirs []string) ([]Differ, error) {
+	var plugins map[string]PluginDiffer
+	diffFuncs := []Differ{}
+	for _, diffName := range diffNames {
+		diffsMu.RLock()
+		d, exists := diffs[diffName]
+		diffsMu.RUnlock()
+		if !exists {
+			if plugins == nil {
+				plugins = DiscoverPlugins(pluginDirs)
+			}
+			if plugin, found := plugins[diffName]; found {
+				d, exists = plugin, true
+			}
+		}
+		if exists {
+			diffFuncs = append(diffFuncs, d)
+		} else {
+			glog.Errorf("Unknown differ specified: %s", diffName)
+		}
+	}
+	if len(diffFuncs) == 0 {
+		return nil, errors.New("No known differs specified")
+	}
+	return diffFuncs, nil
+}
+
+func isExecutable(file os.FileInfo) bool {
+	return file.Mode().IsRegular() && file.Mode().Perm()&0111 != 0
+}
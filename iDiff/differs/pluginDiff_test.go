@@ -0,0 +1,151 @@
+package differs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func writePlugin(t *testing.T, dir, name, script string, mode os.FileMode) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(script), mode); err != nil {
+		t.Fatalf("Could not write plugin %s: %s", path, err)
+	}
+	return path
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	dir1, _ := ioutil.TempDir("", "plugins1")
+	defer os.RemoveAll(dir1)
+	dir2, _ := ioutil.TempDir("", "plugins2")
+	defer os.RemoveAll(dir2)
+
+	rpm := writePlugin(t, dir1, "idiff-differ-rpm", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir2, "idiff-differ-rpm", "#!/bin/sh\n", 0755)
+	gem := writePlugin(t, dir2, "idiff-differ-gem", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir1, "idiff-differ-notexec", "#!/bin/sh\n", 0644)
+	writePlugin(t, dir1, "not-a-differ", "#!/bin/sh\n", 0755)
+
+	plugins := DiscoverPlugins([]string{dir1, dir2})
+	for name, expected := range map[string]string{"rpm": rpm, "gem": gem} {
+		if plugin, ok := plugins[name]; !ok || plugin.Path != expected {
+			t.Errorf("Expected plugin %s at %s but got: %v", name, expected, plugins[name])
+		}
+	}
+	for _, name := range []string{"notexec", "not-a-differ"} {
+		if _, ok := plugins[name]; ok {
+			t.Errorf("Did not expect plugin %s to be discovered", name)
+		}
+	}
+}
+
+func TestGetDiffersWithPlugins(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "plugins")
+	defer os.RemoveAll(dir)
+	rpm := writePlugin(t, dir, "idiff-differ-rpm", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir, "idiff-differ-apt", "#!/bin/sh\n", 0755)
+
+	diffTypes, err := GetDiffersWithPlugins([]string{"apt", "rpm", "unknown"}, []string{dir})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(diffTypes) != 2 || !reflect.DeepEqual(diffTypes[1], PluginDiffer{Name: "rpm", Path: rpm}) {
+		t.Fatalf("Expected the apt differ and the rpm plugin but got: %v", diffTypes)
+	}
+	if _, ok := diffTypes[0].(AptDiffer); !ok {
+		t.Errorf("Expected a plugin not to replace the built-in apt differ but got: %v", diffTypes[0])
+	}
+	// Plugins are neither registered nor run by default.
+	for _, names := range [][]string{DifferNames(), DefaultDifferNames()} {
+		for _, name := range names {
+			if name == "rpm" {
+				t.Errorf("Expected plugin rpm not to be available without naming it, but got: %v", names)
+			}
+		}
+	}
+	if _, err := GetDiffersWithPlugins([]string{"unknown"}, []string{dir}); err == nil {
+		t.Errorf("Expected error for unknown differ but got none")
+	}
+}
+
+func TestPluginDiffCancelled(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "plugins")
+	defer os.RemoveAll(dir)
+	path := writePlugin(t, dir, "idiff-differ-sleep", "#!/bin/sh\nsleep 30\necho {}\n", 0755)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req := DiffRequest{
+		Image1:    utils.Image{Source: "image1", FSPath: "/path/one"},
+		Image2:    utils.Image{Source: "image2", FSPath: "/path/two"},
+		DiffTypes: []Differ{PluginDiffer{Name: "sleep", Path: path}},
+	}
+	start := time.Now()
+	_, failed, _ := req.GetDiffWithErrors(ctx)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected plugin to be stopped when the diff was cancelled but it ran for %s", elapsed)
+	}
+	if err := failed["PluginDiffer:sleep"]; err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Errorf("Expected plugin to fail as it was stopped but got: %v", err)
+	}
+}
+
+func TestPluginDiff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "plugins")
+	defer os.RemoveAll(dir)
+
+	image1 := utils.Image{Source: "image1", FSPath: "/path/one"}
+	image2 := utils.Image{Source: "image2", FSPath: "/path/two"}
+
+	for _, test := range []struct {
+		descrip  string
+		script   string
+		expected utils.PluginDiff
+		err      bool
+	}{
+		{
+			descrip: "plugin reporting differences",
+			script:  "#!/bin/sh\necho \"{\\\"Adds\\\": [\\\"$2\\\", \\\"$IDIFF_IMAGE2\\\"], \\\"Dels\\\": [\\\"$1\\\"]}\"\n",
+			expected: utils.PluginDiff{
+				Image1: "image1",
+				Image2: "image2",
+				Adds:   []string{"/path/two", "image2"},
+				Dels:   []string{"/path/one"},
+			},
+		},
+		{
+			descrip: "plugin exiting non-zero",
+			script:  "#!/bin/sh\necho broken >&2\nexit 3\n",
+			err:     true,
+		},
+		{
+			descrip: "plugin printing invalid JSON",
+			script:  "#!/bin/sh\necho not json\n",
+			err:     true,
+		},
+	} {
+		path := writePlugin(t, dir, "idiff-differ-test", test.script, 0755)
+		d := PluginDiffer{Name: "test", Path: path}
+		result, err := d.Diff(image1, image2)
+		if err != nil && !test.err {
+			t.Errorf("%s: Got unexpected error: %s", test.descrip, err)
+		}
+		if err == nil && test.err {
+			t.Errorf("%s: Expected error but got none", test.descrip)
+		}
+		if err != nil {
+			continue
+		}
+		diff := result.(*utils.PluginDiffResult).Diff
+		if !reflect.DeepEqual(diff, test.expected) {
+			t.Errorf("%s: Expected: %v but got: %v", test.descrip, test.expected, diff)
+		}
+	}
+}
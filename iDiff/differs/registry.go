@@ -0,0 +1,94 @@
+package differs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// DifferInfo describes a differ to the registry, from which the CLI generates the differ's
+// flag, its help and the `differs list` command.
+type DifferInfo struct {
+	// Name selects the differ, and is the name of its flag.
+	Name string
+	// Shorthand is the one letter shorthand of the differ's flag, if it has one.
+	Shorthand string
+	// Description names what the differ compares, such as "apt differ", completing the
+	// flag's help "Set this flag to use the <description>."
+	Description string
+	// Default differs are run when none are selected.
+	Default bool
+	// DiffType names the differ's results in the output, such as AptDiffer.
+	DiffType string
+	// Result is a value of the type of the differ's results, which are printed as text
+	// with Template.  Differs sharing a result type must share its template.
+	Result   utils.DiffResult
+	Template string
+	Differ   Differ
+}
+
+var registry = map[string]DifferInfo{}
+
+// diffTypes maps the Go type of each registered differ to the name of its results.
+var diffTypes = map[reflect.Type]string{}
+
+// Register makes a differ available by name, and registers the template of its results.
+func Register(info DifferInfo) error {
+	if info.Name == "" || info.Differ == nil || info.DiffType == "" {
+		return errors.New("A differ must have a name, a diff type and an implementation")
+	}
+	if len(info.Shorthand) > 1 {
+		return fmt.Errorf("The shorthand of differ %s must be one letter, got %q", info.Name, info.Shorthand)
+	}
+
+	diffsMu.Lock()
+	defer diffsMu.Unlock()
+	if _, exists := diffs[info.Name]; exists {
+		return fmt.Errorf("A differ named %s already exists", info.Name)
+	}
+	for _, existing := range registry {
+		if info.Shorthand != "" && existing.Shorthand == info.Shorthand {
+			return fmt.Errorf("Differs %s and %s have the same shorthand %s", existing.Name, info.Name, info.Shorthand)
+		}
+	}
+	if info.Result != nil {
+		if err := utils.RegisterTemplate(info.Result, info.Template); err != nil {
+			return err
+		}
+	}
+	diffs[info.Name] = info.Differ
+	registry[info.Name] = info
+	if _, named := info.Differ.(namedDiffer); !named {
+		diffTypes[reflect.TypeOf(info.Differ)] = info.DiffType
+	}
+	return nil
+}
+
+// mustRegister registers a built-in differ, which must not conflict with another.
+func mustRegister(info DifferInfo) {
+	if err := Register(info); err != nil {
+		panic(err)
+	}
+}
+
+// Registered returns the descriptions of the registered differs in alphabetical order by name.
+// Plugins, which are discovered rather than registered, are not included.
+func Registered() []DifferInfo {
+	diffsMu.RLock()
+	defer diffsMu.RUnlock()
+	infos := []DifferInfo{}
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// isDefault reports whether the named differ is run when none are selected.
+// It must be called with diffsMu held.
+func isDefault(name string) bool {
+	return registry[name].Default
+}
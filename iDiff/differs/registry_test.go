@@ -0,0 +1,82 @@
+package differs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+type registryTestDiffer struct{}
+
+func (d registryTestDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
+	return &utils.PluginDiffResult{DiffType: "RegistryTestDiffer"}, nil
+}
+
+func unregister(name string) {
+	diffsMu.Lock()
+	defer diffsMu.Unlock()
+	if info, ok := registry[name]; ok {
+		delete(diffTypes, reflect.TypeOf(info.Differ))
+	}
+	delete(registry, name)
+	delete(diffs, name)
+}
+
+func TestRegister(t *testing.T) {
+	defer unregister("registrytest")
+	info := DifferInfo{
+		Name:        "registrytest",
+		Shorthand:   "z",
+		Description: "registry test differ",
+		DiffType:    "RegistryTestDiffer",
+		Result:      utils.PluginDiffResult{},
+		Template:    utils.PluginOutput,
+		Differ:      registryTestDiffer{},
+	}
+	if err := Register(info); err != nil {
+		t.Fatalf("Got unexpected error registering differ: %s", err)
+	}
+	if name := differName(registryTestDiffer{}); name != "RegistryTestDiffer" {
+		t.Errorf("Expected results of registered differ to be named RegistryTestDiffer but got %s", name)
+	}
+	if differs, err := GetDiffers([]string{"registrytest"}); err != nil || len(differs) != 1 {
+		t.Errorf("Expected registered differ to be available but got %v: %v", differs, err)
+	}
+	for _, name := range DefaultDifferNames() {
+		if name == "registrytest" {
+			t.Errorf("Expected differ registered without Default not to run by default")
+		}
+	}
+
+	for _, invalid := range []DifferInfo{
+		{Name: "registrytest", DiffType: "Other", Differ: registryTestDiffer{}},
+		{Name: "other", Shorthand: "a", DiffType: "Other", Differ: registryTestDiffer{}},
+		{Name: "other", Shorthand: "zz", DiffType: "Other", Differ: registryTestDiffer{}},
+		{Name: "other", DiffType: "Other", Differ: registryTestDiffer{}, Result: utils.PluginDiffResult{}, Template: utils.FSOutput},
+		{Name: "other", DiffType: "Other", Differ: registryTestDiffer{}, Result: &utils.SecurityDiffResult{}, Template: "{{.Missing"},
+		{Name: "other", DiffType: "Other"},
+		{DiffType: "Other", Differ: registryTestDiffer{}},
+	} {
+		if err := Register(invalid); err == nil {
+			unregister(invalid.Name)
+			t.Errorf("Expected error registering %+v but got none", invalid)
+		}
+	}
+}
+
+func TestRegisteredDiffers(t *testing.T) {
+	shorthands := map[string]string{}
+	for _, info := range Registered() {
+		if other, ok := shorthands[info.Shorthand]; ok && info.Shorthand != "" {
+			t.Errorf("Differs %s and %s share shorthand %s", other, info.Name, info.Shorthand)
+		}
+		shorthands[info.Shorthand] = info.Name
+		if name := differName(info.Differ); name != info.DiffType {
+			t.Errorf("Expected results of %s to be named %s but got %s", info.Name, info.DiffType, name)
+		}
+	}
+	if expected := DifferNames(); len(Registered()) > len(expected) {
+		t.Errorf("Expected every registered differ to be available, got %v", expected)
+	}
+}
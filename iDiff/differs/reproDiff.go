@@ -0,0 +1,306 @@
+package differs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// reproIgnoredDirs hold files expected to differ between any two builds.
+var reproIgnoredDirs = []string{"/var/lib/apt/lists"}
+
+const ldSoCache = "/etc/ld.so.cache"
+
+// ReproDiffer checks whether two builds of the same Dockerfile produced the same file system.
+// The type, mode, owner and extended attributes of each file are compared as recorded in the layer
+// tars.  Modification times are not compared, and the contents of Python bytecode, gzip files and the
+// dynamic linker cache are normalised before comparison to ignore timestamps and ordering.
+type ReproDiffer struct {
+}
+
+func (d ReproDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
+	diff, err := getReproDiff(image1, image2)
+	return &utils.ReproDiffResult{DiffType: "ReproDiffer", Diff: diff}, err
+}
+
+func getReproDiff(image1, image2 utils.Image) (utils.ReproDiff, error) {
+	diff := utils.ReproDiff{Image1: image1.Source, Image2: image2.Source, Files: []utils.ReproFile{}}
+
+	files1, err := utils.GetImageFiles(image1.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image1.Source, err)
+	}
+	files2, err := utils.GetImageFiles(image2.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image2.Source, err)
+	}
+
+	paths := utils.SortedImagePaths(files1)
+	for _, p := range utils.SortedImagePaths(files2) {
+		if _, ok := files1[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if reproIgnored(p) {
+			continue
+		}
+		f1, ok1 := files1[p]
+		f2, ok2 := files2[p]
+		switch {
+		case !ok2:
+			diff.Files = append(diff.Files, utils.ReproFile{Path: p, Reason: "only in " + image1.Source, Offset: -1})
+		case !ok1:
+			diff.Files = append(diff.Files, utils.ReproFile{Path: p, Reason: "only in " + image2.Source, Offset: -1})
+		default:
+			file, same, err := compareReproFiles(f1, f2)
+			if err != nil {
+				return diff, err
+			}
+			if !same {
+				diff.Files = append(diff.Files, file)
+			}
+		}
+	}
+	return diff, nil
+}
+
+func reproIgnored(p string) bool {
+	for _, dir := range reproIgnoredDirs {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// compareReproFiles compares the metadata of two copies of a file and, for regular files, their normalised contents.
+func compareReproFiles(f1, f2 utils.ImageFile) (utils.ReproFile, bool, error) {
+	file := utils.ReproFile{Path: f1.Path, Offset: -1}
+	mode1, mode2 := f1.Mode(), f2.Mode()
+	switch {
+	case mode1.Type() != mode2.Type():
+		file.Reason = fmt.Sprintf("file type differs: %s -> %s", mode1, mode2)
+		return file, false, nil
+	case mode1 != mode2:
+		file.Reason = fmt.Sprintf("mode differs: %s -> %s", mode1, mode2)
+		return file, false, nil
+	case f1.Metadata != nil && f2.Metadata != nil && (f1.Metadata.Uid != f2.Metadata.Uid || f1.Metadata.Gid != f2.Metadata.Gid):
+		file.Reason = fmt.Sprintf("owner differs: %d:%d -> %d:%d", f1.Metadata.Uid, f1.Metadata.Gid, f2.Metadata.Uid, f2.Metadata.Gid)
+		return file, false, nil
+	case !reflect.DeepEqual(f1.Xattrs, f2.Xattrs):
+		file.Reason = "extended attributes differ"
+		return file, false, nil
+	}
+
+	if mode1&os.ModeSymlink != 0 {
+		target1, err := os.Readlink(f1.FSPath)
+		if err != nil {
+			return file, false, err
+		}
+		target2, err := os.Readlink(f2.FSPath)
+		if err != nil {
+			return file, false, err
+		}
+		if target1 != target2 {
+			file.Reason = fmt.Sprintf("link target differs: %s -> %s", target1, target2)
+			return file, false, nil
+		}
+		return file, true, nil
+	}
+	if !mode1.IsRegular() {
+		return file, true, nil
+	}
+
+	switch {
+	case f1.Path == ldSoCache:
+		return compareNormalised(file, f1, f2, "linker cache entries differ", normaliseLdSoCache)
+	case path.Ext(f1.Path) == ".pyc":
+		return compareNormalised(file, f1, f2, "bytecode differs", normalisePyc)
+	}
+	gzipped, err := isGzip(f1.FSPath)
+	if err != nil {
+		return file, false, err
+	}
+	if gzipped {
+		hash1, err1 := hashGzipContent(f1.FSPath)
+		hash2, err2 := hashGzipContent(f2.FSPath)
+		if err1 == nil && err2 == nil {
+			if hash1 == hash2 {
+				return file, true, nil
+			}
+			file.Reason = "decompressed content differs"
+			file.Hash1, file.Hash2 = hash1, hash2
+			return file, false, nil
+		}
+		// Corrupt archives are compared byte for byte.
+	}
+
+	offset, err := firstDifference(f1.FSPath, f2.FSPath)
+	if err != nil || offset < 0 {
+		return file, offset < 0, err
+	}
+	file.Reason = "content differs"
+	file.Offset = offset
+	if file.Hash1, err = hashFile(f1.FSPath); err != nil {
+		return file, false, err
+	}
+	file.Hash2, err = hashFile(f2.FSPath)
+	return file, false, err
+}
+
+// compareNormalised compares the contents of two small files after normalising them.
+func compareNormalised(file utils.ReproFile, f1, f2 utils.ImageFile, reason string, normalise func([]byte) []byte) (utils.ReproFile, bool, error) {
+	content1, err := ioutil.ReadFile(f1.FSPath)
+	if err != nil {
+		return file, false, err
+	}
+	content2, err := ioutil.ReadFile(f2.FSPath)
+	if err != nil {
+		return file, false, err
+	}
+	content1, content2 = normalise(content1), normalise(content2)
+	if bytes.Equal(content1, content2) {
+		return file, true, nil
+	}
+	file.Reason = reason
+	file.Offset = int64(commonPrefix(content1, content2))
+	file.Hash1, file.Hash2 = hashBytes(content1), hashBytes(content2)
+	return file, false, nil
+}
+
+// normalisePyc zeroes the source modification time recorded in a Python bytecode header.
+// Python 3.7 onwards (magic numbers 3390 to 3999) adds a flags word before it, and
+// records no time at all in hash-based files.
+func normalisePyc(content []byte) []byte {
+	if len(content) < 8 {
+		return content
+	}
+	normalised := append([]byte{}, content...)
+	magic := binary.LittleEndian.Uint16(normalised)
+	if magic >= 3390 && magic < 4000 {
+		if len(normalised) >= 12 && binary.LittleEndian.Uint32(normalised[4:]) == 0 {
+			copy(normalised[8:12], make([]byte, 4))
+		}
+		return normalised
+	}
+	copy(normalised[4:8], make([]byte, 4))
+	return normalised
+}
+
+// normaliseLdSoCache reduces the dynamic linker cache to its sorted library names and paths,
+// as ldconfig writes its entries in an order which depends on the file system.
+func normaliseLdSoCache(content []byte) []byte {
+	strs := []string{}
+	for _, field := range bytes.Split(content, []byte{0}) {
+		if len(field) > 1 && isPrintable(field) {
+			strs = append(strs, string(field))
+		}
+	}
+	sort.Strings(strs)
+	return []byte(strings.Join(strs, "\n"))
+}
+
+func isPrintable(field []byte) bool {
+	for _, b := range field {
+		if b < 0x20 || b > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func isGzip(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false, nil
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// hashGzipContent hashes the decompressed content of a gzip file, ignoring the
+// modification time and file name recorded in its header.
+func hashGzipContent(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// firstDifference returns the offset of the first byte at which two files differ, or -1 if they are identical.
+func firstDifference(path1, path2 string) (int64, error) {
+	file1, err := os.Open(path1)
+	if err != nil {
+		return 0, err
+	}
+	defer file1.Close()
+	file2, err := os.Open(path2)
+	if err != nil {
+		return 0, err
+	}
+	defer file2.Close()
+
+	reader1, reader2 := bufio.NewReader(file1), bufio.NewReader(file2)
+	var offset int64
+	for {
+		b1, err1 := reader1.ReadByte()
+		b2, err2 := reader2.ReadByte()
+		if err1 == io.EOF && err2 == io.EOF {
+			return -1, nil
+		}
+		if err1 != nil && err1 != io.EOF {
+			return 0, err1
+		}
+		if err2 != nil && err2 != io.EOF {
+			return 0, err2
+		}
+		if err1 != nil || err2 != nil || b1 != b2 {
+			return offset, nil
+		}
+		offset++
+	}
+}
+
+func commonPrefix(b1, b2 []byte) int {
+	i := 0
+	for i < len(b1) && i < len(b2) && b1[i] == b2[i] {
+		i++
+	}
+	return i
+}
+
+func hashBytes(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
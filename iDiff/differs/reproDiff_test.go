@@ -0,0 +1,136 @@
+package differs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func gzipContent(t *testing.T, content string, modTime time.Time) string {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.ModTime = modTime
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	return buf.String()
+}
+
+func TestReproDiff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "repro")
+	defer os.RemoveAll(dir)
+
+	// Python 3.7 bytecode: magic, flags, mtime, source size, code.
+	pyc37 := func(mtime string) string { return "\x42\x0d\r\n\x00\x00\x00\x00" + mtime + "\x10\x00\x00\x00code" }
+	// Python 2.7 bytecode: magic, mtime, code.
+	pyc27 := func(mtime string) string { return "\x03\xf3\r\n" + mtime + "code" }
+	build1, build2 := time.Unix(1500000000, 0), time.Unix(1600000000, 0)
+
+	image1 := writeTestImage(t, filepath.Join(dir, "image1"), `{}`, []map[string]testEntry{{
+		"usr/lib/python3.7/a.pyc":   {content: pyc37("\x01\x02\x03\x04")},
+		"usr/lib/python2.7/b.pyc":   {content: pyc27("\x01\x02\x03\x04")},
+		"var/lib/apt/lists/sources": {content: "fetched at 1"},
+		"etc/ld.so.cache":           {content: "ld.so-1.7.0\x00libc.so.6\x00/lib/libc.so.6\x00libm.so.6\x00/lib/libm.so.6\x00"},
+		"usr/share/doc/a.gz":        {content: gzipContent(t, "changelog", build1)},
+		"usr/share/doc/b.gz":        {content: gzipContent(t, "changelog 1", build1)},
+		"usr/bin/tool":              {content: "abcdef"},
+		"etc/secret":                {content: "s", mode: 0644},
+		"only1":                     {content: "1"},
+	}})
+	image2 := writeTestImage(t, filepath.Join(dir, "image2"), `{}`, []map[string]testEntry{{
+		"usr/lib/python3.7/a.pyc":   {content: pyc37("\x05\x06\x07\x08")},
+		"usr/lib/python2.7/b.pyc":   {content: pyc27("\x05\x06\x07\x08")},
+		"var/lib/apt/lists/sources": {content: "fetched at 2"},
+		"etc/ld.so.cache":           {content: "ld.so-1.7.0\x00libm.so.6\x00/lib/libm.so.6\x00libc.so.6\x00/lib/libc.so.6\x00"},
+		"usr/share/doc/a.gz":        {content: gzipContent(t, "changelog", build2)},
+		"usr/share/doc/b.gz":        {content: gzipContent(t, "changelog 2", build2)},
+		"usr/bin/tool":              {content: "abcXef"},
+		"etc/secret":                {content: "s", mode: 0600},
+		"only2":                     {content: "2"},
+	}})
+
+	result, err := ReproDiffer{}.Diff(image1, image2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	files := result.(*utils.ReproDiffResult).Diff.Files
+	reasons := map[string]string{}
+	offsets := map[string]int64{}
+	for _, file := range files {
+		reasons[file.Path] = file.Reason
+		offsets[file.Path] = file.Offset
+	}
+	expected := map[string]string{
+		"/etc/secret":         "mode differs: -rw-r--r-- -> -rw-------",
+		"/only1":              "only in image1",
+		"/only2":              "only in image2",
+		"/usr/bin/tool":       "content differs",
+		"/usr/share/doc/b.gz": "decompressed content differs",
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, reasons)
+	}
+	if offsets["/usr/bin/tool"] != 3 {
+		t.Errorf("Expected first difference at byte 3 but got %d", offsets["/usr/bin/tool"])
+	}
+	if err := result.OutputText("ReproDiffer"); err != nil {
+		t.Errorf("Got unexpected error writing output: %s", err)
+	}
+}
+
+func TestReproDiffOwners(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "repro")
+	defer os.RemoveAll(dir)
+
+	layer := map[string]testEntry{
+		"etc/shadow": {content: "root:*"},
+		"home/app/":  {dir: true},
+		"dev/null":   {},
+	}
+	image1 := writeTestImage(t, filepath.Join(dir, "image1"), `{}`, []map[string]testEntry{layer})
+	image2 := writeTestImage(t, filepath.Join(dir, "image2"), `{}`, []map[string]testEntry{layer})
+	// The owners and modes recorded when the layer tars were extracted.
+	for image, metadata := range map[string]map[string]utils.EntryMetadata{
+		image1.FSPath: {
+			"/etc/shadow": {Gid: 42, Mode: 0640},
+			"/home/app":   {Uid: 1000, Gid: 1000, Mode: os.ModeDir | 0700},
+			"/dev/null":   {Mode: os.ModeDevice | os.ModeCharDevice | 0666},
+		},
+		image2.FSPath: {
+			"/etc/shadow": {Gid: 0, Mode: 0640},
+			"/home/app":   {Uid: 1001, Gid: 1000, Mode: os.ModeDir | 0700},
+			"/dev/null":   {Mode: os.ModeDevice | 0666},
+		},
+	} {
+		contents, _ := json.Marshal(metadata)
+		if err := ioutil.WriteFile(filepath.Join(image, "layer0", "layer"+utils.MetadataSuffix), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := ReproDiffer{}.Diff(image1, image2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	reasons := map[string]string{}
+	for _, file := range result.(*utils.ReproDiffResult).Diff.Files {
+		reasons[file.Path] = file.Reason
+	}
+	expected := map[string]string{
+		"/etc/shadow": "owner differs: 0:42 -> 0:0",
+		"/home/app":   "owner differs: 1000:1000 -> 1001:1000",
+		"/dev/null":   "file type differs: Dcrw-rw-rw- -> Drw-rw-rw-",
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, reasons)
+	}
+}
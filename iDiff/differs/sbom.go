@@ -0,0 +1,196 @@
+package differs
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+// GetSBOMPackages lists the apt, pip and node packages installed in the image, along with
+// the licenses they declare, for inclusion in a software bill of materials.
+func GetSBOMPackages(image utils.Image) ([]utils.SBOMPackage, error) {
+	files, err := utils.GetImageFiles(image.FSPath)
+	if err != nil {
+		return nil, err
+	}
+	packages := []utils.SBOMPackage{}
+
+	aptPackages, err := AptDiffer{}.getPackages(image.FSPath)
+	if err != nil {
+		return nil, err
+	}
+	distro := getDistroID(files)
+	for name, info := range aptPackages {
+		packages = append(packages, utils.SBOMPackage{
+			Name: name,
+			// The apt differ reports versions with their first "+" replaced by a space.
+			Version:   strings.Replace(info.Version, " ", "+", 1),
+			Type:      "deb",
+			Namespace: distro,
+			Licenses:  getDebianLicenses(files, name),
+		})
+	}
+
+	pipPackages, err := PipDiffer{}.getPackages(image.FSPath)
+	if err != nil {
+		return nil, err
+	}
+	for name, info := range pipPackages {
+		packages = append(packages, utils.SBOMPackage{
+			Name:     name,
+			Version:  info.Version,
+			Type:     "pypi",
+			Licenses: getPythonLicenses(files, name, info.Version),
+		})
+	}
+
+	nodePackages, err := NodeDiffer{}.getPackages(image.FSPath)
+	if err != nil {
+		return nil, err
+	}
+	for name, infos := range nodePackages {
+		for packageJSON, info := range infos {
+			packages = append(packages, utils.SBOMPackage{
+				Name:     name,
+				Version:  info.Version,
+				Type:     "npm",
+				Licenses: getNodeLicenses(packageJSON),
+			})
+		}
+	}
+	return packages, nil
+}
+
+// getDistroID returns the ID of the distribution in /etc/os-release, which namespaces its deb packages.
+func getDistroID(files map[string]utils.ImageFile) string {
+	distro := "debian"
+	osRelease, ok := utils.ResolveImagePath(files, "/etc/os-release")
+	if !ok {
+		return distro
+	}
+	readFields(osRelease.FSPath, "=", func(key, value string) {
+		if key == "ID" {
+			distro = strings.Trim(value, `"'`)
+		}
+	})
+	return distro
+}
+
+// getDebianLicenses reads the License fields of a package's machine-readable copyright file.
+func getDebianLicenses(files map[string]utils.ImageFile, pkg string) []string {
+	licenses := []string{}
+	copyright, ok := utils.ResolveImagePath(files, path.Join("/usr/share/doc", pkg, "copyright"))
+	if !ok {
+		return licenses
+	}
+	seen := map[string]bool{}
+	readFields(copyright.FSPath, ":", func(key, value string) {
+		if key != "License" || value == "" {
+			return
+		}
+		if license := debianLicenseExpression(value); license != "" && !seen[license] {
+			seen[license] = true
+			licenses = append(licenses, license)
+		}
+	})
+	sort.Strings(licenses)
+	return licenses
+}
+
+var debianLicenseOperator = regexp.MustCompile(`\s+(?:or|and)\s+`)
+var debianLicenseLeadingOperator = regexp.MustCompile(`^(or|and)\s+`)
+
+// debianLicenseExpression rewrites the License field of a Debian copyright file as an expression
+// of its license names joined by AND and OR.  A comma binds less tightly than either operator,
+// so "GPL-2+ or Artistic, and BSD" is (GPL-2+ OR Artistic) AND BSD.
+func debianLicenseExpression(field string) string {
+	expression := ""
+	for _, part := range strings.Split(field, ",") {
+		part = strings.TrimSpace(part)
+		operator := "AND"
+		if match := debianLicenseLeadingOperator.FindStringSubmatch(part); match != nil {
+			operator = strings.ToUpper(match[1])
+			part = part[len(match[0]):]
+		}
+		part = debianLicenseOperator.ReplaceAllStringFunc(part, func(op string) string {
+			return " " + strings.ToUpper(strings.TrimSpace(op)) + " "
+		})
+		if part == "" {
+			continue
+		}
+		if expression == "" {
+			expression = part
+		} else {
+			expression = utils.GroupLicenseExpression(expression) + " " + operator + " " + utils.GroupLicenseExpression(part)
+		}
+	}
+	return expression
+}
+
+// getPythonLicenses reads the License field of a package's dist-info METADATA.
+func getPythonLicenses(files map[string]utils.ImageFile, pkg, version string) []string {
+	suffix := "/site-packages/" + pkg + "-" + version + ".dist-info/METADATA"
+	for p, file := range files {
+		if !strings.HasSuffix(p, suffix) {
+			continue
+		}
+		license := ""
+		readFields(file.FSPath, ":", func(key, value string) {
+			if key == "License" && license == "" && value != "UNKNOWN" {
+				license = value
+			}
+		})
+		if license != "" {
+			return []string{license}
+		}
+	}
+	return []string{}
+}
+
+// getNodeLicenses reads the license declared by a package.json.
+func getNodeLicenses(packageJSON string) []string {
+	var pkg struct {
+		License interface{} `json:"license"`
+	}
+	contents, err := ioutil.ReadFile(packageJSON)
+	if err != nil || json.Unmarshal(contents, &pkg) != nil {
+		return []string{}
+	}
+	switch license := pkg.License.(type) {
+	case string:
+		if license != "" {
+			return []string{license}
+		}
+	case map[string]interface{}:
+		// Older packages declare {"type": "MIT", "url": "..."}.
+		if licenseType, ok := license["type"].(string); ok && licenseType != "" {
+			return []string{licenseType}
+		}
+	}
+	return []string{}
+}
+
+// readFields calls fn with the key and value of each line of the file split by separator.
+func readFields(filePath, separator string, fn func(key, value string)) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		glog.Warningf("Could not read %s: %s", filePath, err)
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), separator, 2)
+		if len(parts) == 2 {
+			fn(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		}
+	}
+}
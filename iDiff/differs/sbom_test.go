@@ -0,0 +1,95 @@
+package differs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func TestGetSBOMPackages(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sbom")
+	defer os.RemoveAll(dir)
+
+	sitePackages := "usr/local/lib/python3.6/site-packages/"
+	image := writeTestImage(t, filepath.Join(dir, "image"), `{}`, []map[string]testEntry{{
+		"etc/os-release":      {content: "NAME=\"Ubuntu\"\nID=ubuntu\n"},
+		"var/lib/dpkg/status": {content: "Package: libc6\nVersion: 2.24-11+deb9u1\nInstalled-Size: 10\n\nPackage: zlib1g\nVersion: 1:1.2.8\nInstalled-Size: 1\n"},
+		"usr/share/doc/libc6/copyright": {content: "Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/\n\n" +
+			"Files: *\nLicense: LGPL-2.1+ or GPL-2\n\nLicense: LGPL-2.1+\n On Debian systems: see /usr/share/common-licenses\n"},
+		sitePackages + "six/__init__.py":               {content: "six"},
+		sitePackages + "six-1.10.0.dist-info/METADATA": {content: "Metadata-Version: 2.0\nName: six\nLicense: MIT\n"},
+		"node_modules/left-pad/package.json":           {content: `{"name": "left-pad", "version": "1.1.3", "license": {"type": "WTFPL"}}`},
+	}})
+
+	packages, err := GetSBOMPackages(image)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	expected := []utils.SBOMPackage{
+		{Name: "left-pad", Version: "1.1.3", Type: "npm", Licenses: []string{"WTFPL"}},
+		{Name: "libc6", Version: "2.24-11+deb9u1", Type: "deb", Namespace: "ubuntu", Licenses: []string{"LGPL-2.1+", "LGPL-2.1+ OR GPL-2"}},
+		{Name: "six", Version: "1.10.0", Type: "pypi", Licenses: []string{"MIT"}},
+		{Name: "zlib1g", Version: "1:1.2.8", Type: "deb", Namespace: "ubuntu", Licenses: []string{}},
+	}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, packages)
+	}
+}
+
+func TestDebianLicenseExpression(t *testing.T) {
+	for field, expected := range map[string]string{
+		"GPL-1+ or Artistic":            "GPL-1+ OR Artistic",
+		"GPL-2+ and BSD":                "GPL-2+ AND BSD",
+		"GPL-2+ or Artistic, and BSD":   "(GPL-2+ OR Artistic) AND BSD",
+		"MIT, or GPL-2 and BSD":         "MIT OR (GPL-2 AND BSD)",
+		"GPL-2+ with OpenSSL exception": "GPL-2+ with OpenSSL exception",
+	} {
+		if expression := debianLicenseExpression(field); expression != expected {
+			t.Errorf("Expected %q to be read as %q but got %q", field, expected, expression)
+		}
+	}
+}
+
+func TestDiffImageAgainstSBOM(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sbom")
+	defer os.RemoveAll(dir)
+
+	image := writeTestImage(t, filepath.Join(dir, "image"), `{}`, []map[string]testEntry{{
+		"var/lib/dpkg/status": {content: "Package: libc6\nVersion: 2.24-11+deb9u1\nInstalled-Size: 10\n\nPackage: zlib1g\nVersion: 1:1.2.8\nInstalled-Size: 1\n"},
+	}})
+	sbom := utils.Image{Source: "vendor.spdx.json", FSPath: filepath.Join(dir, "sbom"), SBOM: []utils.SBOMPackage{
+		{Name: "libc6", Version: "2.24-11+deb9u1", Type: "deb", Namespace: "debian"},
+		{Name: "curl", Version: "7.52.1", Type: "deb", Namespace: "debian"},
+		{Name: "six", Version: "1.10.0", Type: "pypi"},
+	}}
+
+	req := DiffRequest{Image1: image, Image2: sbom, DiffTypes: []Differ{AptDiffer{}, FileDiffer{}}}
+	if skipped := req.Skipped(); !reflect.DeepEqual(skipped, []string{"FileDiffer"}) {
+		t.Errorf("Expected the file differ to be skipped but got: %v", skipped)
+	}
+	results, err := req.GetDiff(context.Background())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	diff := results["AptDiffer"].(*utils.PackageDiffResult).Diff
+	expected := utils.PackageDiff{
+		Image1:    image.Source,
+		Packages1: map[string]utils.PackageInfo{"zlib1g": {Version: "1:1.2.8"}},
+		Image2:    sbom.Source,
+		Packages2: map[string]utils.PackageInfo{"curl": {Version: "7.52.1"}},
+		InfoDiff:  []utils.Info{},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, diff)
+	}
+	if _, ok := results["FileDiffer"]; ok {
+		t.Errorf("Expected no file diff result but got: %v", results)
+	}
+}
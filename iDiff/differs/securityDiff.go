@@ -0,0 +1,345 @@
+package differs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+func init() {
+	mustRegister(DifferInfo{
+		Name:        "security",
+		Shorthand:   "s",
+		Description: "security differ",
+		Default:     true,
+		DiffType:    "SecurityDiffer",
+		Result:      utils.SecurityDiffResult{},
+		Template:    utils.SecurityOutput,
+		Differ:      SecurityDiffer{},
+	})
+}
+
+type SecurityDiffer struct {
+}
+
+// SecurityDiff reports changes between two images which a security reviewer should look at.
+func (d SecurityDiffer) Diff(image1, image2 utils.Image) (utils.DiffResult, error) {
+	diff, err := getSecurityDiff(image1, image2)
+	return &utils.SecurityDiffResult{DiffType: "SecurityDiffer", Diff: diff}, err
+}
+
+func getSecurityDiff(image1, image2 utils.Image) (utils.SecurityDiff, error) {
+	diff := utils.SecurityDiff{Image1: image1.Source, Image2: image2.Source}
+
+	files1, err := utils.GetImageFiles(image1.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image1.Source, err)
+	}
+	files2, err := utils.GetImageFiles(image2.FSPath)
+	if err != nil {
+		return diff, fmt.Errorf("Error reading image %s files: %s", image2.Source, err)
+	}
+
+	findings := getModeFindings(files1, files2)
+	findings = append(findings, getCapabilityFindings(files1, files2)...)
+	findings = append(findings, getAccountFindings("/etc/passwd", "User", files1, files2)...)
+	findings = append(findings, getAccountFindings("/etc/group", "Group", files1, files2)...)
+	findings = append(findings, getSudoersFindings(files1, files2)...)
+	findings = append(findings, getDefaultUserFindings(image1, image2)...)
+	sortFindings(findings)
+	diff.Findings = findings
+	return diff, nil
+}
+
+var severityRank = map[string]int{
+	utils.SeverityHigh:   0,
+	utils.SeverityMedium: 1,
+	utils.SeverityLow:    2,
+}
+
+func sortFindings(findings []utils.SecurityFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] < severityRank[b.Severity]
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Subject < b.Subject
+	})
+}
+
+// getModeFindings reports files which became setuid, setgid or world-writable.
+func getModeFindings(files1, files2 map[string]utils.ImageFile) []utils.SecurityFinding {
+	findings := []utils.SecurityFinding{}
+	for _, path := range utils.SortedImagePaths(files2) {
+		mode := files2[path].Info.Mode()
+		if mode&os.ModeSymlink != 0 {
+			continue
+		}
+		var oldMode os.FileMode
+		old, existed := files1[path]
+		if existed {
+			oldMode = old.Info.Mode()
+		}
+		gained := func(bit os.FileMode) bool {
+			return mode&bit != 0 && (!existed || oldMode&bit == 0)
+		}
+
+		if gained(os.ModeSetuid) {
+			findings = append(findings, newModeFinding(utils.SeverityHigh, "setuid", path, files2[path].Info, existed, "setuid"))
+		}
+		if gained(os.ModeSetgid) && !mode.IsDir() {
+			findings = append(findings, newModeFinding(utils.SeverityHigh, "setgid", path, files2[path].Info, existed, "setgid"))
+		}
+		if gained(0002) {
+			severity := utils.SeverityMedium
+			description := "world-writable"
+			if mode.IsDir() && mode&os.ModeSticky != 0 {
+				severity = utils.SeverityLow
+				description = "world-writable with the sticky bit"
+			}
+			findings = append(findings, newModeFinding(severity, "world-writable", path, files2[path].Info, existed, description))
+		}
+	}
+	return findings
+}
+
+func newModeFinding(severity, category, path string, info os.FileInfo, existed bool, description string) utils.SecurityFinding {
+	kind := "File"
+	if info.IsDir() {
+		kind = "Directory"
+	}
+	action := "made"
+	if !existed {
+		action = "added as"
+	}
+	return utils.SecurityFinding{Severity: severity, Category: category, Subject: path,
+		Description: fmt.Sprintf("%s %s %s", kind, action, description)}
+}
+
+const capabilityXattr = "security.capability"
+
+// getCapabilityFindings reports files whose file capabilities were added or changed.
+func getCapabilityFindings(files1, files2 map[string]utils.ImageFile) []utils.SecurityFinding {
+	findings := []utils.SecurityFinding{}
+	for _, path := range utils.SortedImagePaths(files2) {
+		caps, ok := files2[path].Xattrs[capabilityXattr]
+		if !ok {
+			continue
+		}
+		oldCaps, hadCaps := files1[path].Xattrs[capabilityXattr]
+		if hadCaps && bytes.Equal(oldCaps, caps) {
+			continue
+		}
+		description := "Capabilities added: " + decodeCapabilities(caps)
+		if hadCaps {
+			description = fmt.Sprintf("Capabilities changed from %s to %s", decodeCapabilities(oldCaps), decodeCapabilities(caps))
+		}
+		findings = append(findings, utils.SecurityFinding{Severity: utils.SeverityHigh, Category: "capability",
+			Subject: path, Description: description})
+	}
+	return findings
+}
+
+var capabilityNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill", "setgid", "setuid",
+	"setpcap", "linux_immutable", "net_bind_service", "net_broadcast", "net_admin", "net_raw",
+	"ipc_lock", "ipc_owner", "sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time", "sys_tty_config", "mknod",
+	"lease", "audit_write", "audit_control", "setfcap", "mac_override", "mac_admin", "syslog",
+	"wake_alarm", "block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+const (
+	vfsCapRevisionMask   = 0xff000000
+	vfsCapRevision1      = 0x01000000
+	vfsCapFlagsEffective = 0x000001
+)
+
+// decodeCapabilities renders a security.capability xattr value (struct vfs_cap_data) like getcap does.
+func decodeCapabilities(value []byte) string {
+	if len(value) < 12 {
+		return "unknown"
+	}
+	magic := binary.LittleEndian.Uint32(value[0:4])
+	words := 2
+	if magic&vfsCapRevisionMask == vfsCapRevision1 {
+		words = 1
+	}
+	if len(value) < 4+8*words {
+		return "unknown"
+	}
+	var permitted, inheritable uint64
+	for i := 0; i < words; i++ {
+		permitted |= uint64(binary.LittleEndian.Uint32(value[4+8*i:])) << (32 * uint(i))
+		inheritable |= uint64(binary.LittleEndian.Uint32(value[8+8*i:])) << (32 * uint(i))
+	}
+
+	flags := "p"
+	if magic&vfsCapFlagsEffective != 0 {
+		flags = "ep"
+	}
+	sets := []string{}
+	if permitted != 0 {
+		sets = append(sets, capabilitySet(permitted)+"="+flags)
+	}
+	if inheritable != 0 {
+		sets = append(sets, capabilitySet(inheritable)+"+i")
+	}
+	if len(sets) == 0 {
+		return "none"
+	}
+	return strings.Join(sets, " ")
+}
+
+func capabilitySet(bits uint64) string {
+	names := []string{}
+	for i := uint(0); i < 64; i++ {
+		if bits&(1<<i) == 0 {
+			continue
+		}
+		if int(i) < len(capabilityNames) {
+			names = append(names, "cap_"+capabilityNames[i])
+		} else {
+			names = append(names, fmt.Sprintf("cap_%d", i))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// getAccountFindings reports users or groups added to or removed from an /etc/passwd style file.
+func getAccountFindings(path, label string, files1, files2 map[string]utils.ImageFile) []utils.SecurityFinding {
+	accounts1 := readAccounts(files1, path)
+	accounts2 := readAccounts(files2, path)
+	kind := strings.ToLower(label)
+	findings := []utils.SecurityFinding{}
+	for _, name := range sortedKeys(accounts2) {
+		id := accounts2[name]
+		oldID, existed := accounts1[name]
+		severity := utils.SeverityMedium
+		if id == "0" {
+			severity = utils.SeverityHigh
+		}
+		if !existed {
+			findings = append(findings, utils.SecurityFinding{Severity: severity, Category: kind, Subject: name,
+				Description: fmt.Sprintf("%s added to %s with ID %s", label, path, id)})
+		} else if oldID != id {
+			findings = append(findings, utils.SecurityFinding{Severity: severity, Category: kind, Subject: name,
+				Description: fmt.Sprintf("%s ID changed in %s from %s to %s", label, path, oldID, id)})
+		}
+	}
+	for _, name := range sortedKeys(accounts1) {
+		if _, exists := accounts2[name]; !exists {
+			findings = append(findings, utils.SecurityFinding{Severity: utils.SeverityLow, Category: kind, Subject: name,
+				Description: fmt.Sprintf("%s removed from %s", label, path)})
+		}
+	}
+	return findings
+}
+
+// readAccounts maps the names in an /etc/passwd or /etc/group style file to their numeric IDs.
+func readAccounts(files map[string]utils.ImageFile, path string) map[string]string {
+	accounts := map[string]string{}
+	file, ok := files[path]
+	if !ok || !file.Info.Mode().IsRegular() {
+		return accounts
+	}
+	f, err := os.Open(file.FSPath)
+	if err != nil {
+		glog.Warningf("Could not read %s: %s", path, err)
+		return accounts
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		accounts[fields[0]] = fields[2]
+	}
+	return accounts
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isSudoersPath(path string) bool {
+	return path == "/etc/sudoers" || strings.HasPrefix(path, "/etc/sudoers.d/")
+}
+
+// getSudoersFindings reports any change to /etc/sudoers or the files in /etc/sudoers.d.
+func getSudoersFindings(files1, files2 map[string]utils.ImageFile) []utils.SecurityFinding {
+	findings := []utils.SecurityFinding{}
+	newFinding := func(path, description string) {
+		findings = append(findings, utils.SecurityFinding{Severity: utils.SeverityHigh, Category: "sudoers",
+			Subject: path, Description: description})
+	}
+	for _, path := range utils.SortedImagePaths(files2) {
+		f2 := files2[path]
+		if !isSudoersPath(path) || !f2.Info.Mode().IsRegular() {
+			continue
+		}
+		f1, existed := files1[path]
+		if !existed {
+			newFinding(path, "Sudoers file added")
+			continue
+		}
+		if same, err := utils.CheckSameFile(f1.FSPath, f2.FSPath); err != nil || !same {
+			newFinding(path, "Sudoers file modified")
+		}
+	}
+	for _, path := range utils.SortedImagePaths(files1) {
+		if _, exists := files2[path]; isSudoersPath(path) && files1[path].Info.Mode().IsRegular() && !exists {
+			newFinding(path, "Sudoers file removed")
+		}
+	}
+	return findings
+}
+
+// getDefaultUserFindings reports a change to the user containers of the image run as by default.
+func getDefaultUserFindings(image1, image2 utils.Image) []utils.SecurityFinding {
+	config1, err1 := utils.GetImageConfig(image1.FSPath)
+	config2, err2 := utils.GetImageConfig(image2.FSPath)
+	if err1 != nil || err2 != nil {
+		glog.Warning("Could not read image configs, skipping default user check")
+		return []utils.SecurityFinding{}
+	}
+	user1, user2 := config1.Config.User, config2.Config.User
+	if user1 == user2 {
+		return []utils.SecurityFinding{}
+	}
+	severity := utils.SeverityMedium
+	if isRootUser(user2) {
+		severity = utils.SeverityHigh
+	}
+	return []utils.SecurityFinding{{Severity: severity, Category: "default-user", Subject: "User",
+		Description: fmt.Sprintf("Default user changed from %s to %s", displayUser(user1), displayUser(user2))}}
+}
+
+func isRootUser(user string) bool {
+	name := strings.SplitN(user, ":", 2)[0]
+	return name == "" || name == "root" || name == "0"
+}
+
+func displayUser(user string) string {
+	if user == "" {
+		return "root (unset)"
+	}
+	return user
+}
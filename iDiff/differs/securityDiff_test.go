@@ -0,0 +1,124 @@
+package differs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+type testEntry struct {
+	content string
+	mode    os.FileMode
+	dir     bool
+}
+
+// writeTestImage lays out an extracted docker save image with the given config and layers under dir.
+func writeTestImage(t *testing.T, dir, config string, layers []map[string]testEntry) utils.Image {
+	layerNames := []string{}
+	for i, layer := range layers {
+		layerName := fmt.Sprintf("layer%d", i)
+		layerNames = append(layerNames, layerName+"/layer.tar")
+		for path, entry := range layer {
+			full := filepath.Join(dir, layerName, "layer", path)
+			mode := entry.mode
+			if entry.dir {
+				if mode == 0 {
+					mode = os.ModeDir | 0755
+				}
+				if err := os.MkdirAll(full, 0755); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				if mode == 0 {
+					mode = 0644
+				}
+				os.MkdirAll(filepath.Dir(full), 0755)
+				if err := ioutil.WriteFile(full, []byte(entry.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chmod(full, mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	manifest, _ := json.Marshal([]map[string]interface{}{{"Config": "config.json", "Layers": layerNames}})
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return utils.Image{Source: filepath.Base(dir), FSPath: dir}
+}
+
+func TestSecurityDiff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "security")
+	defer os.RemoveAll(dir)
+
+	image1 := writeTestImage(t, filepath.Join(dir, "image1"), `{"config": {"User": "app"}}`, []map[string]testEntry{{
+		"etc/passwd":      {content: "root:x:0:0::/root:/bin/sh\napp:x:1000:1000::/app:/bin/sh\nold:x:1001:1001::/:/bin/false\n"},
+		"etc/group":       {content: "root:x:0:\napp:x:1000:\n"},
+		"etc/sudoers":     {content: "root ALL=(ALL) ALL\n"},
+		"usr/bin/passwd":  {mode: os.ModeSetuid | 0755},
+		"usr/bin/ping":    {mode: 0755},
+		"var/cache/app":   {dir: true},
+		"usr/bin/tracker": {mode: 0755},
+	}})
+	image2 := writeTestImage(t, filepath.Join(dir, "image2"), `{"config": {"User": ""}}`, []map[string]testEntry{{
+		"etc/passwd":      {content: "root:x:0:0::/root:/bin/sh\napp:x:1000:1000::/app:/bin/sh\ntoor:x:0:0::/:/bin/sh\n"},
+		"etc/group":       {content: "root:x:0:\napp:x:1000:\ndocker:x:999:\n"},
+		"etc/sudoers":     {content: "root ALL=(ALL) ALL\napp ALL=(ALL) NOPASSWD: ALL\n"},
+		"usr/bin/passwd":  {mode: os.ModeSetuid | 0755},
+		"usr/bin/ping":    {mode: 0755},
+		"usr/bin/newgrp":  {mode: os.ModeSetgid | 0755},
+		"var/cache/app":   {dir: true, mode: os.ModeDir | 0777},
+		"tmp":             {dir: true, mode: os.ModeDir | os.ModeSticky | 0777},
+		"usr/bin/tracker": {mode: os.ModeSetuid | 0755},
+	}})
+	// Record a capability of cap_net_raw=ep on ping, as UnTar does for PAX xattr records.
+	capability := []byte{0x01, 0x00, 0x00, 0x02, 0x00, 0x20, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	xattrs, _ := json.Marshal(map[string]map[string][]byte{"/usr/bin/ping": {"security.capability": capability}})
+	ioutil.WriteFile(filepath.Join(image2.FSPath, "layer0", "layer"+utils.XattrsSuffix), xattrs, 0644)
+
+	diff, err := getSecurityDiff(image1, image2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := []utils.SecurityFinding{
+		{Severity: utils.SeverityHigh, Category: "capability", Subject: "/usr/bin/ping", Description: "Capabilities added: cap_net_raw=ep"},
+		{Severity: utils.SeverityHigh, Category: "default-user", Subject: "User", Description: "Default user changed from app to root (unset)"},
+		{Severity: utils.SeverityHigh, Category: "setgid", Subject: "/usr/bin/newgrp", Description: "File added as setgid"},
+		{Severity: utils.SeverityHigh, Category: "setuid", Subject: "/usr/bin/tracker", Description: "File made setuid"},
+		{Severity: utils.SeverityHigh, Category: "sudoers", Subject: "/etc/sudoers", Description: "Sudoers file modified"},
+		{Severity: utils.SeverityHigh, Category: "user", Subject: "toor", Description: "User added to /etc/passwd with ID 0"},
+		{Severity: utils.SeverityMedium, Category: "group", Subject: "docker", Description: "Group added to /etc/group with ID 999"},
+		{Severity: utils.SeverityMedium, Category: "world-writable", Subject: "/var/cache/app", Description: "Directory made world-writable"},
+		{Severity: utils.SeverityLow, Category: "user", Subject: "old", Description: "User removed from /etc/passwd"},
+		{Severity: utils.SeverityLow, Category: "world-writable", Subject: "/tmp", Description: "Directory added as world-writable with the sticky bit"},
+	}
+	if !reflect.DeepEqual(diff.Findings, expected) {
+		t.Errorf("Expected:\n%v\nbut got:\n%v", expected, diff.Findings)
+	}
+}
+
+func TestDecodeCapabilities(t *testing.T) {
+	for _, test := range []struct {
+		value    []byte
+		expected string
+	}{
+		{[]byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x04, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "cap_net_bind_service=p"},
+		{[]byte{0x01, 0x00, 0x00, 0x01, 0x03, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00}, "cap_chown,cap_dac_override=ep cap_kill+i"},
+		{[]byte{0x01, 0x00}, "unknown"},
+	} {
+		if actual := decodeCapabilities(test.value); actual != test.expected {
+			t.Errorf("Expected: %s but got: %s", test.expected, actual)
+		}
+	}
+}
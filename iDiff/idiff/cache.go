@@ -0,0 +1,231 @@
+package idiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/docker/distribution/reference"
+	"github.com/golang/glog"
+)
+
+// ImageCache keeps the images prepared for diffs and analyses so that an image used by several,
+// such as a base image many others are compared against, is only extracted once.  Only sources
+// which cannot change without their name changing are cached: image tarballs, identified by
+// their path, size and modification time, and registry references pinned by digest.
+// Cached images are shared, so differs must not modify the file systems they are given.
+type ImageCache struct {
+	dir string
+	// capacity is how many images which are not in use are kept.
+	capacity int
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	// ready is closed once the image has been prepared, or has failed to be.  The image and
+	// error are set with the cache's mu held before then.
+	ready chan struct{}
+	// cancel stops preparing the image, once no user is waiting for it.
+	cancel   context.CancelFunc
+	image    utils.Image
+	err      error
+	users    int
+	lastUsed time.Time
+}
+
+// prepareImage prepares images for the cache.  It is replaced by tests.
+var prepareImage = utils.ImagePrepper.GetImage
+
+// NewImageCache returns a cache which prepares images under dir and keeps up to capacity
+// images which are not in use, removing the least recently used beyond that.
+func NewImageCache(dir string, capacity int) *ImageCache {
+	return &ImageCache{dir: dir, capacity: capacity, entries: map[string]*cacheEntry{}}
+}
+
+// getImage returns the image prepared by p, from the cache if its source can be cached.
+// Images are prepared as by GetImage if the cache is nil.  Each image returned must be
+// given back to release once done with.  A cached image is prepared once for all the users
+// waiting for it, and is only stopped when every one of them has been cancelled.
+func (c *ImageCache) getImage(ctx context.Context, p utils.ImagePrepper) (utils.Image, error) {
+	if c == nil {
+		return p.GetImage(ctx)
+	}
+	key, ok := cacheKey(p)
+	if !ok {
+		return p.GetImage(ctx)
+	}
+
+	c.mu.Lock()
+	entry, found := c.entries[key]
+	if !found {
+		prepCtx, cancel := context.WithCancel(context.Background())
+		entry = &cacheEntry{ready: make(chan struct{}), cancel: cancel}
+		c.entries[key] = entry
+		go c.prepare(prepCtx, key, entry, p)
+	}
+	entry.users++
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		c.mu.Lock()
+		entry.users--
+		if entry.users == 0 && c.entries[key] == entry && !isReady(entry) {
+			// The image is only dropped from the cache if it is still being prepared, so the
+			// next user prepares it again rather than waiting for the cancelled preparation.
+			delete(c.entries, key)
+			entry.cancel()
+		}
+		c.mu.Unlock()
+		return utils.Image{}, ctx.Err()
+	}
+	if entry.err != nil {
+		return utils.Image{}, entry.err
+	}
+	glog.Infof("Using cached image %s", p.Source)
+	return entry.image, nil
+}
+
+// prepare prepares the image of a new entry in the cache.  It runs on a context of its own,
+// as any of the entry's users may stop waiting for it.
+func (c *ImageCache) prepare(ctx context.Context, key string, entry *cacheEntry, p utils.ImagePrepper) {
+	defer entry.cancel()
+	p.WorkDir = c.dir
+	image, err := prepareImage(p, ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(entry.ready)
+	if c.entries[key] != entry {
+		// Every user stopped waiting, or the cache was closed, so the image is not kept.
+		if err == nil {
+			if err := removeImage(image); err != nil {
+				glog.Error(err)
+			}
+		}
+		entry.err = fmt.Errorf("Preparing image %s was cancelled", p.Source)
+		return
+	}
+	entry.image, entry.err = image, err
+	if err != nil {
+		// Images which failed to be prepared are tried again by the next user.
+		delete(c.entries, key)
+		return
+	}
+	entry.lastUsed = time.Now()
+	glog.Infof("Cached image %s", p.Source)
+}
+
+func isReady(entry *cacheEntry) bool {
+	select {
+	case <-entry.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// release gives back an image returned by getImage.  Cached images are kept for later users,
+// and any other image is removed.
+func (c *ImageCache) release(image utils.Image) error {
+	if c == nil || image.FSPath == "" {
+		return removeImage(image)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.entries {
+		if entry.image.FSPath == image.FSPath {
+			entry.users--
+			entry.lastUsed = time.Now()
+			return c.evict()
+		}
+	}
+	return removeImage(image)
+}
+
+// evict removes the least recently used images which are not in use, beyond the capacity of
+// the cache.  It must be called with c.mu held.
+func (c *ImageCache) evict() error {
+	unused := []string{}
+	for key, entry := range c.entries {
+		if entry.users == 0 && entry.image.FSPath != "" {
+			unused = append(unused, key)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return c.entries[unused[i]].lastUsed.Before(c.entries[unused[j]].lastUsed)
+	})
+
+	var firstErr error
+	for len(unused) > c.capacity {
+		entry := c.entries[unused[0]]
+		delete(c.entries, unused[0])
+		unused = unused[1:]
+		glog.Infof("Evicting cached image %s", entry.image.Source)
+		if err := removeImage(entry.image); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close removes every cached image.  It must only be called once no diff or analysis using the
+// cache is running.
+func (c *ImageCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var firstErr error
+	for key, entry := range c.entries {
+		delete(c.entries, key)
+		// Images still being prepared are removed once they are.
+		entry.cancel()
+		if err := removeImage(entry.image); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// cacheKey identifies the image prepared by p, if its source is one which can be cached.
+// The key includes the options which change how the image is prepared.
+func cacheKey(p utils.ImagePrepper) (string, bool) {
+	ref, err := utils.ParseImageSource(p.Source)
+	if err != nil {
+		return "", false
+	}
+	options := fmt.Sprintf("limits=%d/%d", p.Limits.MaxSize, p.Limits.MaxEntries)
+	switch ref.Type {
+	case utils.SourceTar:
+		path, image := utils.SplitTarSource(ref.Ref)
+		if image == "" {
+			image = p.TarImage
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return "", false
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("tar:%s#%s size=%d mtime=%d %s", path, image, info.Size(), info.ModTime().UnixNano(), options), true
+	case utils.SourceRegistry:
+		named, err := reference.ParseNormalizedNamed(ref.Ref)
+		if err != nil {
+			return "", false
+		}
+		if _, pinned := named.(reference.Canonical); !pinned {
+			return "", false
+		}
+		return fmt.Sprintf("docker:%s platform=%s %s", named.String(), p.Platform, options), true
+	}
+	return "", false
+}
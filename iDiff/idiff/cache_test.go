@@ -0,0 +1,189 @@
+package idiff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func TestImageCache(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+	cacheDir := filepath.Join(workDir, "cache")
+	if err := os.Mkdir(cacheDir, 0755); err != nil {
+		t.Fatalf("Could not create cache dir: %s", err)
+	}
+
+	cache := NewImageCache(cacheDir, 1)
+	opts := Options{Differs: []string{"file"}, WorkDir: workDir, Cache: cache}
+	first, err := Diff(context.Background(), tar1, tar2, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	second, err := Diff(context.Background(), tar1, tar2, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if first.Image1.FSPath != second.Image1.FSPath || first.Image2.FSPath != second.Image2.FSPath {
+		t.Errorf("Expected the second diff to use the cached images %s and %s but got %s and %s",
+			first.Image1.FSPath, first.Image2.FSPath, second.Image1.FSPath, second.Image2.FSPath)
+	}
+	if !strings.HasPrefix(first.Image1.FSPath, cacheDir) {
+		t.Errorf("Expected cached image to be extracted under %s but got %s", cacheDir, first.Image1.FSPath)
+	}
+	for _, comparison := range []*Comparison{first, second} {
+		if err := comparison.Cleanup(); err != nil {
+			t.Errorf("Got unexpected error cleaning up: %s", err)
+		}
+	}
+
+	// Only one unused image is kept, the most recently released.
+	if _, err := os.Stat(first.Image1.FSPath); !os.IsNotExist(err) {
+		t.Errorf("Expected least recently used image %s to be evicted", first.Image1.FSPath)
+	}
+	if _, err := os.Stat(first.Image2.FSPath); err != nil {
+		t.Errorf("Expected most recently used image to be kept: %s", err)
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Errorf("Got unexpected error closing cache: %s", err)
+	}
+	if contents, _ := ioutil.ReadDir(cacheDir); len(contents) != 0 {
+		t.Errorf("Expected cache dir to be empty after closing but found %d entries", len(contents))
+	}
+}
+
+func TestImageCacheConcurrentUsers(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create cache dir: %s", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	cache := NewImageCache(cacheDir, 0)
+	defer cache.Close()
+
+	// Images of tar2 are only prepared once unblocked, or stop when cancelled.
+	unblock := make(chan struct{})
+	cancelled := make(chan struct{}, 1)
+	defer func() { prepareImage = utils.ImagePrepper.GetImage }()
+	prepareImage = func(p utils.ImagePrepper, ctx context.Context) (utils.Image, error) {
+		if p.Source == string(tar2) {
+			select {
+			case <-unblock:
+			case <-ctx.Done():
+				cancelled <- struct{}{}
+				return utils.Image{}, ctx.Err()
+			}
+		}
+		return p.GetImage(ctx)
+	}
+
+	// A user which is cancelled stops waiting without failing the others.
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error, 2)
+	go func() {
+		_, err := cache.getImage(ctx, utils.ImagePrepper{Source: string(tar2)})
+		waited <- err
+	}()
+	type result struct {
+		image utils.Image
+		err   error
+	}
+	prepared := make(chan result, 1)
+	go func() {
+		image, err := cache.getImage(context.Background(), utils.ImagePrepper{Source: string(tar2)})
+		prepared <- result{image, err}
+	}()
+	key, _ := cacheKey(utils.ImagePrepper{Source: string(tar2)})
+	for users := 0; users < 2; time.Sleep(time.Millisecond) {
+		cache.mu.Lock()
+		if entry, ok := cache.entries[key]; ok {
+			users = entry.users
+		}
+		cache.mu.Unlock()
+	}
+	cancel()
+	if err := <-waited; err != context.Canceled {
+		t.Errorf("Expected the cancelled user to stop waiting but got: %v", err)
+	}
+
+	// Releasing another image, which evicts it, while tar2 is being prepared.
+	image1, err := cache.getImage(context.Background(), utils.ImagePrepper{Source: string(tar1)})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if err := cache.release(image1); err != nil {
+		t.Errorf("Got unexpected error releasing image: %s", err)
+	}
+	close(unblock)
+	r := <-prepared
+	if r.err != nil {
+		t.Fatalf("Expected the image to be prepared for the remaining user but got: %s", r.err)
+	}
+	if err := cache.release(r.image); err != nil {
+		t.Errorf("Got unexpected error releasing image: %s", err)
+	}
+	select {
+	case <-cancelled:
+		t.Errorf("Expected the preparation to continue while a user waits for it")
+	default:
+	}
+
+	// Preparing is stopped once every user has been cancelled.
+	unblock = make(chan struct{})
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := cache.getImage(ctx, utils.ImagePrepper{Source: string(tar2)}); err != context.Canceled {
+		t.Errorf("Expected the cancelled user to stop waiting but got: %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(10 * time.Second):
+		t.Errorf("Expected the preparation to be stopped once no user waits for it")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	root, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create dir: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	tarKey, ok := cacheKey(utils.ImagePrepper{Source: string(tar1)})
+	if !ok {
+		t.Fatalf("Expected tar %s to be cached", tar1)
+	}
+	if key, _ := cacheKey(utils.ImagePrepper{Source: "tar://" + string(tar1)}); key != tarKey {
+		t.Errorf("Expected tar given with and without its scheme to share key %s but got %s", tarKey, key)
+	}
+	limited := utils.ImagePrepper{Source: string(tar1), Limits: utils.ExtractLimits{MaxSize: 1, MaxEntries: 1}}
+	if key, _ := cacheKey(limited); key == tarKey {
+		t.Errorf("Expected tar extracted with other limits to have another key than %s", tarKey)
+	}
+
+	for _, source := range []string{
+		"gcr.io/google-appengine/python@sha256:" + strings.Repeat("a", 64),
+	} {
+		if _, ok := cacheKey(utils.ImagePrepper{Source: source}); !ok {
+			t.Errorf("Expected %s to be cached", source)
+		}
+	}
+	for _, source := range []string{"gcr.io/google-appengine/python:latest", "ubuntu", "dir://" + root, "container://web"} {
+		if key, ok := cacheKey(utils.ImagePrepper{Source: source}); ok {
+			t.Errorf("Expected %s not to be cached but got key %s", source, key)
+		}
+	}
+}
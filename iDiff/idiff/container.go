@@ -0,0 +1,28 @@
+package idiff
+
+import (
+	"context"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/docker/docker/client"
+)
+
+// ContainerImage returns the source of the image a container, given as a utils.ContainerScheme
+// source, was created from, so that the container can be diffed against it.
+func ContainerImage(ctx context.Context, src ImageSource) (ImageSource, error) {
+	cli, err := client.NewEnvClient()
+	if err != nil {
+		return "", err
+	}
+	id, err := utils.ContainerImageID(ctx, cli, string(src))
+	if err != nil {
+		return "", err
+	}
+	// Image sources give IDs in their short form.
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return ImageSource(id), nil
+}
@@ -0,0 +1,296 @@
+// Package idiff exposes iDiff as a library so that images can be analyzed and compared
+// from other Go programs.  Nothing in this package exits the process: failures are
+// reported as errors, work stops when the supplied context is cancelled, and the
+// extracted image file systems are left in place until the caller cleans them up.
+package idiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/differs"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// ImageSource identifies an image: an image ID, a registry URL, a path to a tarball
+// produced by `docker save`, a path to an SPDX or CycloneDX JSON software bill of materials,
+// or a container given as container://<id or name>.
+// Images sourced from an SBOM have no file system, so only the package differs are run on them.
+type ImageSource string
+
+// Options controls how images are prepared and which differs are run.
+type Options struct {
+	// Differs names the differs to run, e.g. "apt" or "file", or the plugins found in PluginDirs
+	// or on PATH.  The differs registered to run by default are run if empty.
+	Differs []string
+	// WorkDir is the directory images are saved and extracted under.
+	// The system temp directory is used if it is empty.
+	WorkDir string
+	// Engine selects the Docker Engine client over shelling out to the local docker CLI.
+	Engine bool
+	// ExtractLimits bounds the size and number of entries extracted from each image.
+	// utils.DefaultExtractLimits is used for any limit which is not set.
+	ExtractLimits utils.ExtractLimits
+	// TarImage selects, by repo tag or ID, the image read from tars saved with several images
+	// which are not given as <tar>#<image>.
+	TarImage string
+	// Platform selects, as os/arch[/variant], the image pulled from a manifest list or read from
+	// an OCI image index, and is checked against the image's config.  The Docker daemon's
+	// platform is used if it is empty.
+	Platform string
+	// PluginDirs are searched, before PATH, for external differ executables named idiff-differ-<name>.
+	PluginDirs []string
+	// FileContent, if set, makes the file differ report unified diffs of modified text files.
+	FileContent *differs.ContentOptions
+	// FileByPackage makes the file differ group changed files by their owning dpkg or apk package.
+	FileByPackage bool
+	// CertExpiryDays is how far ahead the certs differ checks certificates for expiry, and must
+	// not be negative.  Zero reports only expired certificates, and
+	// differs.DefaultCertExpiryDays is used if it is nil.
+	CertExpiryDays *int
+	// Filters drop the files and packages the diffs should not report.
+	Filters utils.DiffFilters
+	// Cache, if set, reuses the images it has already prepared rather than extracting them again.
+	// Cleanup leaves cached images in place until the cache evicts them.
+	Cache *ImageCache
+}
+
+func (o Options) differNames() []string {
+	// If no differs are specified, the default differs are performed.
+	if len(o.Differs) == 0 {
+		return differs.DefaultDifferNames()
+	}
+	return o.Differs
+}
+
+// getDiffers returns the selected differs, configured by the options.
+func (o Options) getDiffers() ([]differs.Differ, error) {
+	diffTypes, err := differs.GetDiffersWithPlugins(o.differNames(), o.PluginDirs)
+	if err != nil {
+		return nil, err
+	}
+	for i, differ := range diffTypes {
+		if fileDiffer, ok := differ.(differs.FileDiffer); ok {
+			fileDiffer.Content = o.FileContent
+			fileDiffer.ByPackage = o.FileByPackage
+			diffTypes[i] = fileDiffer
+		}
+		if certsDiffer, ok := differ.(differs.CertsDiffer); ok && o.CertExpiryDays != nil {
+			if *o.CertExpiryDays < 0 {
+				return nil, fmt.Errorf("Invalid certificate expiry of %d days", *o.CertExpiryDays)
+			}
+			certsDiffer.ExpiryDays = *o.CertExpiryDays
+			diffTypes[i] = certsDiffer
+		}
+	}
+	return diffTypes, nil
+}
+
+func (o Options) analyzerNames() []string {
+	if len(o.Differs) == 0 {
+		return differs.DefaultAnalyzerNames()
+	}
+	return o.Differs
+}
+
+func (o Options) prepper(src ImageSource) utils.ImagePrepper {
+	return utils.ImagePrepper{Source: string(src), WorkDir: o.WorkDir, Engine: o.Engine, Limits: o.ExtractLimits, TarImage: o.TarImage, Platform: o.Platform}
+}
+
+// Analysis holds the results of analyzing a single image.
+type Analysis struct {
+	Image   utils.Image
+	Results map[string]utils.AnalyzeResult
+	// Skipped names the analyzers which were not run because the image was sourced from an SBOM.
+	Skipped []string
+
+	cache *ImageCache
+}
+
+// Cleanup removes the extracted file system of the analyzed image.
+func (a *Analysis) Cleanup() error {
+	return a.cache.release(a.Image)
+}
+
+// Comparison holds the results of diffing two images.
+type Comparison struct {
+	Image1  utils.Image
+	Image2  utils.Image
+	Results map[string]utils.DiffResult
+	// Skipped names the differs which were not run because an image was sourced from an SBOM.
+	Skipped []string
+	// Errors holds the error of each differ which failed, and so has no result.
+	Errors map[string]error
+
+	cache *ImageCache
+}
+
+// Identical reports whether none of the differs which ran found a difference between the images.
+func (c *Comparison) Identical() bool {
+	for _, result := range c.Results {
+		if !result.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Summary totals the results of the differs, with the change in size of the images' file systems.
+// It must be called before Cleanup.
+func (c *Comparison) Summary() utils.ComparisonSummary {
+	sizeDelta := utils.GetImageSize(c.Image2.FSPath) - utils.GetImageSize(c.Image1.FSPath)
+	return utils.SummarizeDiffs(c.Results, sizeDelta)
+}
+
+// Cleanup removes the extracted file systems of both compared images.
+func (c *Comparison) Cleanup() error {
+	err1 := c.cache.release(c.Image1)
+	err2 := c.cache.release(c.Image2)
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// Analyze prepares the image and runs every selected differ that supports single image analysis.
+// On success the caller must call Cleanup on the returned Analysis once done with it.
+func Analyze(ctx context.Context, src ImageSource, opts Options) (*Analysis, error) {
+	analyzers, err := differs.GetAnalyzers(opts.analyzerNames())
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := opts.Cache.getImage(ctx, opts.prepper(src))
+	if err != nil {
+		return nil, err
+	}
+
+	req := differs.AnalyzeRequest{Image: image, AnalyzeTypes: analyzers}
+	results, err := req.GetAnalysis(ctx)
+	if err != nil {
+		opts.Cache.release(image)
+		return nil, err
+	}
+	return &Analysis{Image: image, Results: results, Skipped: req.Skipped(), cache: opts.Cache}, nil
+}
+
+// Diff prepares both images concurrently and runs the selected differs on them.
+// On success the caller must call Cleanup on the returned Comparison once done with it.
+func Diff(ctx context.Context, a, b ImageSource, opts Options) (*Comparison, error) {
+	diffTypes, err := opts.getDiffers()
+	if err != nil {
+		return nil, err
+	}
+	return diffImages(ctx, opts.Cache, opts.prepper(a), opts.prepper(b), diffTypes, opts.Filters)
+}
+
+// DiffPlatforms diffs two platforms, given as os/arch[/variant], of the same image pulled from a
+// manifest list or read from an OCI image index, such as its linux/amd64 and linux/arm64 images.
+// On success the caller must call Cleanup on the returned Comparison once done with it.
+func DiffPlatforms(ctx context.Context, src ImageSource, platform1, platform2 string, opts Options) (*Comparison, error) {
+	ref, err := utils.ParseImageSource(string(src))
+	if err != nil {
+		return nil, err
+	}
+	if ref.Type != utils.SourceRegistry && ref.Type != utils.SourceOCI {
+		return nil, fmt.Errorf("Cannot select platforms of image %s, which is not pulled from a registry or read from an OCI layout", src)
+	}
+	for _, platform := range []string{platform1, platform2} {
+		if _, err := utils.ParsePlatform(platform); err != nil {
+			return nil, err
+		}
+	}
+
+	diffTypes, err := opts.getDiffers()
+	if err != nil {
+		return nil, err
+	}
+	p1, p2 := opts.prepper(src), opts.prepper(src)
+	p1.Platform, p2.Platform = platform1, platform2
+	return diffImages(ctx, opts.Cache, p1, p2, diffTypes, opts.Filters)
+}
+
+// Repro prepares two builds of the same image and checks that their file systems are identical
+// once known sources of non-determinism are ignored.  Its only result is that of the ReproDiffer.
+// On success the caller must call Cleanup on the returned Comparison once done with it.
+func Repro(ctx context.Context, a, b ImageSource, opts Options) (*Comparison, error) {
+	return diffImages(ctx, opts.Cache, opts.prepper(a), opts.prepper(b), []differs.Differ{differs.ReproDiffer{}}, utils.DiffFilters{})
+}
+
+func diffImages(ctx context.Context, cache *ImageCache, a, b utils.ImagePrepper, diffTypes []differs.Differ, filters utils.DiffFilters) (*Comparison, error) {
+	image1, image2, err := prepareImages(ctx, cache, a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	req := differs.DiffRequest{Image1: image1, Image2: image2, DiffTypes: diffTypes}
+	results, failed, err := req.GetDiffWithErrors(ctx)
+	if err != nil {
+		cache.release(image1)
+		cache.release(image2)
+		return nil, err
+	}
+	filterResults(results, filters)
+	return &Comparison{Image1: image1, Image2: image2, Results: results, Skipped: req.Skipped(), Errors: failed, cache: cache}, nil
+}
+
+// prepareImages prepares both images in parallel, through the cache if there is one.  If either
+// fails the other is cancelled and anything already extracted is released.
+func prepareImages(ctx context.Context, cache *ImageCache, a, b utils.ImagePrepper) (utils.Image, utils.Image, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	fail := func(src string, err error) {
+		once.Do(func() {
+			firstErr = fmt.Errorf("Could not prepare image %s: %s", src, err)
+			cancel()
+		})
+	}
+
+	var image1, image2 utils.Image
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var err error
+		if image1, err = cache.getImage(ctx, a); err != nil {
+			fail(a.Source, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var err error
+		if image2, err = cache.getImage(ctx, b); err != nil {
+			fail(b.Source, err)
+		}
+	}()
+	wg.Wait()
+
+	if firstErr != nil {
+		cache.release(image1)
+		cache.release(image2)
+		return utils.Image{}, utils.Image{}, firstErr
+	}
+	return image1, image2, nil
+}
+
+// filterResults drops the excluded files and ignored packages from each result.
+func filterResults(results map[string]utils.DiffResult, filters utils.DiffFilters) {
+	if filters.IsEmpty() {
+		return
+	}
+	for _, result := range results {
+		filters.Apply(result)
+	}
+}
+
+func removeImage(image utils.Image) error {
+	if image.FSPath == "" {
+		return nil
+	}
+	return os.RemoveAll(image.FSPath)
+}
@@ -0,0 +1,289 @@
+package idiff
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/differs"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+const (
+	tar1 = ImageSource("../utils/testTars/la-croix1.tar")
+	tar2 = ImageSource("../utils/testTars/la-croix2.tar")
+)
+
+func TestDiff(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	opts := Options{Differs: []string{"file", "history"}, WorkDir: workDir}
+	comparison, err := Diff(context.Background(), tar1, tar2, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	for _, image := range []utils.Image{comparison.Image1, comparison.Image2} {
+		if !strings.HasPrefix(image.FSPath, workDir) {
+			t.Errorf("Expected image to be extracted under %s but got %s", workDir, image.FSPath)
+		}
+	}
+
+	fileDiff, ok := comparison.Results["FileDiffer"].(*utils.DirDiffResult)
+	if !ok {
+		t.Fatalf("Expected file diff result but got: %v", comparison.Results)
+	}
+	if expected := []string{"nest/f1.txt"}; !reflect.DeepEqual(fileDiff.Diff.Adds, expected) {
+		t.Errorf("Expected adds: %s but got: %s", expected, fileDiff.Diff.Adds)
+	}
+	if _, ok := comparison.Results["HistoryDiffer"]; !ok {
+		t.Errorf("Expected history diff result but got: %v", comparison.Results)
+	}
+	if comparison.Identical() {
+		t.Errorf("Expected images with different files not to be identical")
+	}
+
+	if err := comparison.Cleanup(); err != nil {
+		t.Errorf("Got unexpected error cleaning up: %s", err)
+	}
+	if contents, _ := ioutil.ReadDir(workDir); len(contents) != 0 {
+		t.Errorf("Expected work dir to be empty after cleanup but found %d entries", len(contents))
+	}
+	if _, err := os.Stat(string(tar1)); err != nil {
+		t.Errorf("Expected source tar to be left in place: %s", err)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	opts := Options{Differs: []string{"file", "history", "apt"}, WorkDir: workDir}
+	comparison, err := Diff(context.Background(), tar1, tar1, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	defer comparison.Cleanup()
+	if !comparison.Identical() {
+		t.Errorf("Expected an image to be identical to itself but got: %v", comparison.Results)
+	}
+	if len(comparison.Errors) != 0 {
+		t.Errorf("Got unexpected differ errors: %v", comparison.Errors)
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, test := range []struct {
+		descrip string
+		ctx     context.Context
+		image2  ImageSource
+		opts    Options
+	}{
+		{
+			descrip: "unknown differ",
+			ctx:     context.Background(),
+			image2:  tar2,
+			opts:    Options{Differs: []string{"la-croix"}, WorkDir: workDir},
+		},
+		{
+			descrip: "bad source",
+			ctx:     context.Background(),
+			image2:  "?!notAnImage",
+			opts:    Options{WorkDir: workDir},
+		},
+		{
+			descrip: "cancelled context",
+			ctx:     cancelled,
+			image2:  tar2,
+			opts:    Options{WorkDir: workDir},
+		},
+	} {
+		if _, err := Diff(test.ctx, tar1, test.image2, test.opts); err == nil {
+			t.Errorf("%s: Expected error but got none", test.descrip)
+		}
+		if contents, _ := ioutil.ReadDir(workDir); len(contents) != 0 {
+			t.Errorf("%s: Expected work dir to be empty after failure but found %d entries", test.descrip, len(contents))
+		}
+	}
+}
+
+func TestCertExpiryDays(t *testing.T) {
+	zero, negative := 0, -1
+	for _, test := range []struct {
+		days     *int
+		expected int
+	}{
+		{nil, differs.DefaultCertExpiryDays},
+		{&zero, 0},
+	} {
+		diffTypes, err := Options{Differs: []string{"certs"}, CertExpiryDays: test.days}.getDiffers()
+		if err != nil {
+			t.Fatalf("Got unexpected error: %s", err)
+		}
+		if days := diffTypes[0].(differs.CertsDiffer).ExpiryDays; days != test.expected {
+			t.Errorf("Expected an expiry of %d days but got %d", test.expected, days)
+		}
+	}
+	if _, err := (Options{Differs: []string{"certs"}, CertExpiryDays: &negative}).getDiffers(); err == nil {
+		t.Errorf("Expected error for a negative expiry but got none")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	analysis, err := Analyze(context.Background(), tar2, Options{Differs: []string{"file"}, WorkDir: workDir})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	defer analysis.Cleanup()
+
+	files, ok := analysis.Results["FileDiffer"].(*utils.ListAnalyzeResult)
+	if !ok {
+		t.Fatalf("Expected file analysis result but got: %v", analysis.Results)
+	}
+	if expected := []string{"nest/f1.txt"}; !reflect.DeepEqual(files.Analysis, expected) {
+		t.Errorf("Expected: %s but got: %s", expected, files.Analysis)
+	}
+}
+
+func TestDiffSBOM(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	writeSBOM := func(name, format string, packages []utils.SBOMPackage) ImageSource {
+		doc, err := utils.NewSBOM(format, name, packages)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %s", err)
+		}
+		contents, _ := json.Marshal(doc)
+		path := filepath.Join(workDir, name)
+		if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+			t.Fatalf("Could not write SBOM: %s", err)
+		}
+		return ImageSource(path)
+	}
+	sbom1 := writeSBOM("vendor1.spdx.json", utils.SPDXJSON, []utils.SBOMPackage{
+		{Name: "libc6", Version: "2.24-11+deb9u1", Type: "deb", Namespace: "debian"},
+		{Name: "zlib1g", Version: "1:1.2.8", Type: "deb", Namespace: "debian"},
+	})
+	sbom2 := writeSBOM("vendor2.cdx.json", utils.CycloneDXJSON, []utils.SBOMPackage{
+		{Name: "libc6", Version: "2.24-11+deb9u3", Type: "deb", Namespace: "debian"},
+		{Name: "zlib1g", Version: "1:1.2.8", Type: "deb", Namespace: "debian"},
+		{Name: "left-pad", Version: "1.1.3", Type: "npm"},
+	})
+
+	opts := Options{Differs: []string{"apt", "file", "node"}, WorkDir: workDir}
+	comparison, err := Diff(context.Background(), sbom1, sbom2, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	defer comparison.Cleanup()
+
+	if expected := []string{"FileDiffer"}; !reflect.DeepEqual(comparison.Skipped, expected) {
+		t.Errorf("Expected skipped differs: %s but got: %s", expected, comparison.Skipped)
+	}
+	if _, ok := comparison.Results["FileDiffer"]; ok {
+		t.Errorf("Expected file differ to be skipped but got: %v", comparison.Results)
+	}
+	aptDiff, ok := comparison.Results["AptDiffer"].(*utils.PackageDiffResult)
+	if !ok {
+		t.Fatalf("Expected apt diff result but got: %v", comparison.Results)
+	}
+	expectedInfo := []utils.Info{{
+		Package: "libc6",
+		Info1:   utils.PackageInfo{Version: "2.24-11 deb9u1"},
+		Info2:   utils.PackageInfo{Version: "2.24-11 deb9u3"},
+	}}
+	if !reflect.DeepEqual(aptDiff.Diff.InfoDiff, expectedInfo) || len(aptDiff.Diff.Packages1) != 0 || len(aptDiff.Diff.Packages2) != 0 {
+		t.Errorf("Expected only the libc6 upgrade but got: %v", aptDiff.Diff)
+	}
+	nodeDiff, ok := comparison.Results["NodeDiffer"].(*utils.MultiVersionPackageDiffResult)
+	if !ok {
+		t.Fatalf("Expected node diff result but got: %v", comparison.Results)
+	}
+	if _, ok := nodeDiff.Diff.Packages2["left-pad"]; !ok || len(nodeDiff.Diff.Packages2) != 1 {
+		t.Errorf("Expected left-pad to be added but got: %v", nodeDiff.Diff)
+	}
+}
+
+func TestDiffPlatformsErrors(t *testing.T) {
+	for _, test := range []struct {
+		descrip              string
+		src                  ImageSource
+		platform1, platform2 string
+	}{
+		{"tar source", tar1, "linux/amd64", "linux/arm64"},
+		{"bad platform", "gcr.io/google-appengine/python", "linux/amd64", "arm64"},
+	} {
+		if _, err := DiffPlatforms(context.Background(), test.src, test.platform1, test.platform2, Options{}); err == nil {
+			t.Errorf("%s: Expected error but got none", test.descrip)
+		}
+	}
+}
+
+func TestDiffDir(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+	root := filepath.Join(workDir, "rootfs")
+	os.MkdirAll(filepath.Join(root, "var", "lib", "dpkg"), 0755)
+	status := "Package: libc6\nStatus: install ok installed\nVersion: 2.24-11+deb9u1\nInstalled-Size: 10\n\n"
+	ioutil.WriteFile(filepath.Join(root, "var", "lib", "dpkg", "status"), []byte(status), 0644)
+	ioutil.WriteFile(filepath.Join(root, "lime.txt"), []byte("lime"), 0644)
+
+	opts := Options{Differs: []string{"apt", "file"}, WorkDir: workDir}
+	comparison, err := Diff(context.Background(), tar1, ImageSource("dir://"+root), opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	defer comparison.Cleanup()
+
+	aptDiff, ok := comparison.Results["AptDiffer"].(*utils.PackageDiffResult)
+	if !ok {
+		t.Fatalf("Expected apt diff result but got: %v", comparison.Results)
+	}
+	if _, ok := aptDiff.Diff.Packages2["libc6"]; !ok {
+		t.Errorf("Expected libc6 to be listed from the directory but got: %v", aptDiff.Diff)
+	}
+	fileDiff, ok := comparison.Results["FileDiffer"].(*utils.DirDiffResult)
+	if !ok {
+		t.Fatalf("Expected file diff result but got: %v", comparison.Results)
+	}
+	added := map[string]bool{}
+	for _, path := range fileDiff.Diff.Adds {
+		added[path] = true
+	}
+	if !added["rootfs/layer/var/lib/dpkg/status"] {
+		t.Errorf("Expected the dpkg status to be added but got: %v", fileDiff.Diff.Adds)
+	}
+}
@@ -0,0 +1,75 @@
+package idiff
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// Policy holds rules a comparison must satisfy, such as those a CI pipeline enforces on each
+// new build of an image.  Rules left at their zero values are not checked.
+type Policy struct {
+	// MaxSizeIncrease is the most, in bytes, the second image's file system may grow by.
+	MaxSizeIncrease int64
+	// DeniedPackages are glob patterns of the names of packages the second image may not add.
+	DeniedPackages []string
+}
+
+// IsEmpty reports whether the policy has no rules.
+func (p Policy) IsEmpty() bool {
+	return p.MaxSizeIncrease == 0 && len(p.DeniedPackages) == 0
+}
+
+// Check returns a description of each way in which the comparison violates the policy.
+// It returns an error if a rule cannot be checked, such as denied packages when no package
+// differ ran.  It must be called before the comparison's Cleanup.
+func (p Policy) Check(c *Comparison) ([]string, error) {
+	violations := []string{}
+	if p.MaxSizeIncrease > 0 {
+		if delta := c.Summary().SizeDelta; delta > p.MaxSizeIncrease {
+			violations = append(violations, fmt.Sprintf("Image size grew by %s, more than the %s allowed",
+				utils.HumanSizeDelta(delta), utils.HumanSize(p.MaxSizeIncrease)))
+		}
+	}
+	if len(p.DeniedPackages) > 0 {
+		added, checked := addedPackages(c.Results)
+		if !checked {
+			return nil, errors.New("Denied packages cannot be checked as no package differ, such as apt, pip or node, ran")
+		}
+		for _, name := range added {
+			if utils.PackageMatches(p.DeniedPackages, name) {
+				violations = append(violations, fmt.Sprintf("Package %s is added, which is denied", name))
+			}
+		}
+	}
+	return violations, nil
+}
+
+// addedPackages lists, in order, the names of the packages added by the package differs' results,
+// and reports whether there were any package differ results.
+func addedPackages(results map[string]utils.DiffResult) ([]string, bool) {
+	added := map[string]bool{}
+	checked := false
+	for _, result := range results {
+		switch r := result.(type) {
+		case *utils.PackageDiffResult:
+			checked = true
+			for name := range r.Diff.Packages2 {
+				added[name] = true
+			}
+		case *utils.MultiVersionPackageDiffResult:
+			checked = true
+			for name := range r.Diff.Packages2 {
+				added[name] = true
+			}
+		}
+	}
+	names := []string{}
+	for name := range added {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, checked
+}
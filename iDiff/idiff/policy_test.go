@@ -0,0 +1,45 @@
+package idiff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	comparison := &Comparison{Results: map[string]utils.DiffResult{
+		"AptDiffer": &utils.PackageDiffResult{DiffType: "AptDiffer", Diff: utils.PackageDiff{
+			Packages2: map[string]utils.PackageInfo{"telnet": {Version: "0.17"}, "curl": {Version: "7.52"}},
+		}},
+		"NodeDiffer": &utils.MultiVersionPackageDiffResult{DiffType: "NodeDiffer", Diff: utils.MultiVersionPackageDiff{
+			Packages2: map[string]map[string]utils.PackageInfo{"left-pad": {"/app/node_modules/left-pad": {Version: "1.0"}}},
+		}},
+		"FileDiffer": &utils.DirDiffResult{DiffType: "FileDiffer"},
+	}}
+
+	if violations, err := (Policy{}).Check(comparison); err != nil || len(violations) != 0 {
+		t.Errorf("Expected an empty policy to pass but got: %v, %v", violations, err)
+	}
+	if violations, err := (Policy{DeniedPackages: []string{"wget"}}).Check(comparison); err != nil || len(violations) != 0 {
+		t.Errorf("Expected no denied packages to be added but got: %v, %v", violations, err)
+	}
+
+	policy := Policy{DeniedPackages: []string{"telnet*", "left-*"}}
+	expected := []string{
+		"Package left-pad is added, which is denied",
+		"Package telnet is added, which is denied",
+	}
+	if violations, err := policy.Check(comparison); err != nil || !reflect.DeepEqual(violations, expected) {
+		t.Errorf("Expected violations %v but got: %v, %v", expected, violations, err)
+	}
+
+	// Without the results of a package differ, denied packages fail rather than pass unchecked.
+	fileOnly := &Comparison{Results: map[string]utils.DiffResult{"FileDiffer": &utils.DirDiffResult{DiffType: "FileDiffer"}}}
+	if _, err := policy.Check(fileOnly); err == nil {
+		t.Errorf("Expected error checking denied packages without a package differ but got none")
+	}
+	if _, err := (Policy{MaxSizeIncrease: 1 << 30}).Check(fileOnly); err != nil {
+		t.Errorf("Got unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,36 @@
+package idiff
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/differs"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+// SBOM prepares the image and returns a software bill of materials of its apt, pip and node
+// packages in the given format, utils.SPDXJSON or utils.CycloneDXJSON, ready to be encoded as JSON.
+// An SBOM source is converted to the given format.  The extracted image is removed before returning.
+func SBOM(ctx context.Context, src ImageSource, format string, opts Options) (interface{}, error) {
+	if err := utils.CheckSBOMFormat(format); err != nil {
+		return nil, err
+	}
+	image, err := opts.Cache.getImage(ctx, opts.prepper(src))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := opts.Cache.release(image); err != nil {
+			glog.Error(err)
+		}
+	}()
+
+	packages := image.SBOM
+	if packages == nil {
+		packages, err = differs.GetSBOMPackages(image)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return utils.NewSBOM(format, image.Source, packages)
+}
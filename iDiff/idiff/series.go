@@ -0,0 +1,107 @@
+package idiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/differs"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+// Series holds the results of diffing each consecutive pair in a series of images.
+type Series struct {
+	// Images holds each image of the series with its size, or the error preparing it.
+	Images []utils.SeriesImage
+	// Results[i] holds the diff results between Images[i] and Images[i+1], or nil if they could
+	// not be diffed.
+	Results []map[string]utils.DiffResult
+	// Failures records each pair of images which could not be diffed.
+	Failures []utils.SeriesFailure
+}
+
+// Report summarises the series as a timeline of package, size and history changes.
+func (s *Series) Report() utils.SeriesReport {
+	return utils.GetSeriesReport(s.Images, s.Results, s.Failures)
+}
+
+// DiffSeries prepares each image in turn and runs the selected differs on each consecutive pair.
+// Only the two images being diffed are extracted at once: each image is removed once it has been
+// diffed with the next.  Pairs which cannot be diffed, as an image could not be prepared or every
+// differ failed, are recorded in the series' Failures rather than stopping the series.
+func DiffSeries(ctx context.Context, sources []ImageSource, opts Options) (*Series, error) {
+	if len(sources) < 2 {
+		return nil, fmt.Errorf("A series needs at least two images, got %d", len(sources))
+	}
+	diffTypes, err := opts.getDiffers()
+	if err != nil {
+		return nil, err
+	}
+
+	series := &Series{}
+	// prev is the image before the current one, if it was prepared.
+	var prev *utils.Image
+	release := func(image *utils.Image) {
+		if image == nil {
+			return
+		}
+		if err := opts.Cache.release(*image); err != nil {
+			glog.Error(err)
+		}
+	}
+	defer func() { release(prev) }()
+
+	for i, src := range sources {
+		var current *utils.Image
+		entry := utils.SeriesImage{Image: string(src)}
+		image, err := opts.Cache.getImage(ctx, opts.prepper(src))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if err == nil {
+				release(&image)
+			}
+			return nil, ctxErr
+		}
+		if err != nil {
+			entry.Error = fmt.Sprintf("Could not prepare image %s: %s", src, err)
+		} else {
+			current = &image
+			entry.Size = utils.GetImageSize(image.FSPath)
+		}
+		series.Images = append(series.Images, entry)
+
+		if i > 0 {
+			results, err := diffSeriesPair(ctx, prev, current, series.Images[i-1], entry, diffTypes, opts.Filters)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				release(current)
+				return nil, ctxErr
+			}
+			if err != nil {
+				glog.Errorf("Could not diff %s and %s: %s", sources[i-1], src, err)
+				series.Failures = append(series.Failures, utils.SeriesFailure{
+					Index: i, Image1: string(sources[i-1]), Image2: string(src), Error: err.Error()})
+			}
+			series.Results = append(series.Results, results)
+		}
+		release(prev)
+		prev = current
+	}
+	return series, nil
+}
+
+// diffSeriesPair diffs two consecutive images of a series, either of which is nil if it could not
+// be prepared.
+func diffSeriesPair(ctx context.Context, image1, image2 *utils.Image, entry1, entry2 utils.SeriesImage, diffTypes []differs.Differ, filters utils.DiffFilters) (map[string]utils.DiffResult, error) {
+	for _, entry := range []utils.SeriesImage{entry1, entry2} {
+		if entry.Error != "" {
+			return nil, errors.New(entry.Error)
+		}
+	}
+	req := differs.DiffRequest{Image1: *image1, Image2: *image2, DiffTypes: diffTypes}
+	results, err := req.GetDiff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filterResults(results, filters)
+	return results, nil
+}
@@ -0,0 +1,62 @@
+package idiff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDiffSeries(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	opts := Options{Differs: []string{"file", "history"}, WorkDir: workDir}
+	series, err := DiffSeries(context.Background(), []ImageSource{tar1, tar2, tar1}, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(series.Images) != 3 || len(series.Results) != 2 || len(series.Failures) != 0 {
+		t.Fatalf("Expected 3 images and 2 diffs but got %d and %d, with failures %v", len(series.Images), len(series.Results), series.Failures)
+	}
+
+	report := series.Report()
+	if len(report.Images) != 3 {
+		t.Errorf("Expected 3 images in report but got %d", len(report.Images))
+	}
+	for i, image := range report.Images {
+		if expected := []ImageSource{tar1, tar2, tar1}[i]; image.Image != string(expected) {
+			t.Errorf("Expected image %d to be %s but got %+v", i, expected, image)
+		}
+	}
+	// Each image is removed once it has been diffed with the next.
+	if contents, _ := ioutil.ReadDir(workDir); len(contents) != 0 {
+		t.Errorf("Expected work dir to be empty once the series is diffed but found %d entries", len(contents))
+	}
+
+	// An image which cannot be prepared fails the pairs it is in, not the series.
+	missing := ImageSource("tar://" + workDir + "/missing.tar")
+	series, err = DiffSeries(context.Background(), []ImageSource{tar1, missing, tar2, tar1}, opts)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(series.Failures) != 2 || series.Failures[0].Index != 1 || series.Failures[1].Index != 2 || series.Failures[1].Image1 != string(missing) {
+		t.Errorf("Expected the two diffs with the missing image to fail but got: %+v", series.Failures)
+	}
+	if len(series.Results) != 3 || series.Results[0] != nil || series.Results[1] != nil || series.Results[2] == nil {
+		t.Errorf("Expected results for only the last pair but got: %v", series.Results)
+	}
+	if series.Images[1].Error == "" || series.Images[2].Error != "" {
+		t.Errorf("Expected only the missing image to have an error but got: %+v", series.Images)
+	}
+	if contents, _ := ioutil.ReadDir(workDir); len(contents) != 0 {
+		t.Errorf("Expected work dir to be empty once the series is diffed but found %d entries", len(contents))
+	}
+
+	if _, err := DiffSeries(context.Background(), []ImageSource{tar1}, opts); err == nil {
+		t.Errorf("Expected error for series of one image but got none")
+	}
+}
@@ -11,9 +11,10 @@ import (
 
 func main() {
 	flag.Parse()
-	if err := cmd.RootCmd.Execute(); err != nil {
+	err := cmd.Execute()
+	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
 	}
 	glog.Flush()
+	os.Exit(cmd.ExitStatus(err))
 }
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+// htmlReport is the HTML rendering of a job's results: the summary of a diff, if it is one,
+// followed by each differ's result.
+type htmlReport struct {
+	Title    string
+	Summary  *utils.ComparisonSummary
+	Skipped  []string
+	Sections []htmlSection
+}
+
+type htmlSection struct {
+	Name string
+	JSON string
+}
+
+const reportHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Skipped}}<p>Skipped differs which need an image file system, as an image was sourced from an SBOM: {{join .Skipped ", "}}</p>
+{{end}}{{with .Summary}}<h2>Summary</h2>
+<table>
+<tr><th>Differ</th><th>Added</th><th>Removed</th><th>Changed</th><th>Size change</th></tr>
+{{range .Differs}}<tr><td>{{.Differ}}</td><td>{{.Added}}</td><td>{{.Removed}}</td><td>{{.Changed}}</td><td>{{sizeDelta .SizeDelta}}</td></tr>
+{{end}}<tr><th>Total</th><th>{{.Added}}</th><th>{{.Removed}}</th><th>{{.Changed}}</th><th>{{sizeDelta .SizeDelta}}</th></tr>
+</table>
+{{end}}{{range .Sections}}<h2>{{.Name}}</h2>
+<pre>{{.JSON}}</pre>
+{{end}}</body>
+</html>
+`
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join":      strings.Join,
+	"sizeDelta": utils.HumanSizeDelta,
+}).Parse(reportHTML))
+
+func (r htmlReport) render() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := reportTemplate.Execute(&buffer, r); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+	"github.com/golang/glog"
+)
+
+// Types of job.
+const (
+	// JobDiff compares Image1 with Image2.
+	JobDiff = "diff"
+	// JobAnalyze analyzes Image.
+	JobAnalyze = "analyze"
+)
+
+// Statuses of a job.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// JobRequest is the body of a request to submit a job.
+type JobRequest struct {
+	// Type is JobDiff or JobAnalyze.
+	Type   string
+	Image1 string `json:",omitempty"`
+	Image2 string `json:",omitempty"`
+	Image  string `json:",omitempty"`
+	// Differs names the differs or analyzers to run.  The server's defaults are used if empty.
+	Differs []string `json:",omitempty"`
+	// Platform selects, as os/arch[/variant], the images pulled from manifest lists.
+	Platform string `json:",omitempty"`
+}
+
+// validate checks that the request names the images its type needs, as valid image sources
+// the server allows: see checkSource.
+func (r JobRequest) validate(localRoot string) error {
+	var sources []string
+	switch r.Type {
+	case JobDiff:
+		if r.Image1 == "" || r.Image2 == "" {
+			return fmt.Errorf("A %s job needs Image1 and Image2", JobDiff)
+		}
+		sources = []string{r.Image1, r.Image2}
+	case JobAnalyze:
+		if r.Image == "" {
+			return fmt.Errorf("An %s job needs Image", JobAnalyze)
+		}
+		sources = []string{r.Image}
+	default:
+		return fmt.Errorf("Unknown job type %q, expected %s or %s", r.Type, JobDiff, JobAnalyze)
+	}
+	for _, source := range sources {
+		ref, err := utils.ParseImageSource(source)
+		if err != nil {
+			return err
+		}
+		if err := checkSource(ref, localRoot); err != nil {
+			return err
+		}
+	}
+	if r.Platform != "" {
+		if _, err := utils.ParsePlatform(r.Platform); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSource allows images pulled from registries and, if localRoot is set, tars, OCI layouts,
+// SBOMs and directories beneath it.  Images and containers of the server's Docker daemon, and
+// files elsewhere on the server, are never read for a job.
+func checkSource(ref utils.ImageReference, localRoot string) error {
+	switch ref.Type {
+	case utils.SourceRegistry:
+		return nil
+	case utils.SourceTar, utils.SourceOCI, utils.SourceSBOM, utils.SourceDir:
+		if localRoot == "" {
+			return fmt.Errorf("%s images are not served, only images pulled from registries are", ref.Type)
+		}
+		path := ref.Ref
+		if ref.Type == utils.SourceTar {
+			path, _ = utils.SplitTarSource(path)
+		}
+		if !withinDir(localRoot, path) {
+			return fmt.Errorf("%s is not within %s, the only directory images are read from", path, localRoot)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s images are not served, only images pulled from registries are", ref.Type)
+}
+
+// withinDir reports whether the path, once any symlinks are resolved, is dir or beneath it.
+func withinDir(dir, path string) bool {
+	resolved := []string{}
+	for _, p := range []string{dir, path} {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return false
+		}
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			return false
+		}
+		resolved = append(resolved, abs)
+	}
+	rel, err := filepath.Rel(resolved[0], resolved[1])
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Job is the status of a submitted job, as returned by the API.
+type Job struct {
+	ID       string
+	Request  JobRequest
+	Status   string
+	Error    string `json:",omitempty"`
+	Created  time.Time
+	Started  *time.Time `json:",omitempty"`
+	Finished *time.Time `json:",omitempty"`
+}
+
+// job is a submitted job with its results, which are rendered when it finishes so that the
+// images can be cleaned up straight away.
+type job struct {
+	Job
+	result []byte
+	html   []byte
+}
+
+// execute runs the job in a workspace of its own under opts.WorkDir, which is removed once done.
+// It returns the job's results as JSON and HTML.
+func execute(ctx context.Context, request JobRequest, opts idiff.Options) ([]byte, []byte, error) {
+	workspace, err := ioutil.TempDir(opts.WorkDir, "idiff-job-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(workspace); err != nil {
+			glog.Error(err)
+		}
+	}()
+	opts.WorkDir = workspace
+	if len(request.Differs) > 0 {
+		opts.Differs = request.Differs
+	}
+	if request.Platform != "" {
+		opts.Platform = request.Platform
+	}
+
+	if request.Type == JobAnalyze {
+		return analyze(ctx, request, opts)
+	}
+	return diff(ctx, request, opts)
+}
+
+func diff(ctx context.Context, request JobRequest, opts idiff.Options) ([]byte, []byte, error) {
+	comparison, err := idiff.Diff(ctx, idiff.ImageSource(request.Image1), idiff.ImageSource(request.Image2), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := comparison.Cleanup(); err != nil {
+			glog.Error(err)
+		}
+	}()
+
+	names := []string{}
+	for name := range comparison.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	output := utils.ComparisonOutput{Summary: comparison.Summary(), Diffs: []utils.DiffResult{}}
+	results := []interface{}{}
+	for _, name := range names {
+		result := comparison.Results[name].GetStruct()
+		output.Diffs = append(output.Diffs, result)
+		results = append(results, result)
+	}
+	report := htmlReport{
+		Title:   fmt.Sprintf("Diff of %s and %s", comparison.Image1.Source, comparison.Image2.Source),
+		Summary: &output.Summary,
+		Skipped: comparison.Skipped,
+	}
+	return render(output, report, names, results)
+}
+
+func analyze(ctx context.Context, request JobRequest, opts idiff.Options) ([]byte, []byte, error) {
+	analysis, err := idiff.Analyze(ctx, idiff.ImageSource(request.Image), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := analysis.Cleanup(); err != nil {
+			glog.Error(err)
+		}
+	}()
+
+	names := []string{}
+	for name := range analysis.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	output := []utils.AnalyzeResult{}
+	results := []interface{}{}
+	for _, name := range names {
+		result := analysis.Results[name].GetStruct()
+		output = append(output, result)
+		results = append(results, result)
+	}
+	report := htmlReport{Title: fmt.Sprintf("Analysis of %s", analysis.Image.Source), Skipped: analysis.Skipped}
+	return render(output, report, names, results)
+}
+
+// render encodes the job's output as JSON, and as an HTML report with a section for each result.
+func render(output interface{}, report htmlReport, names []string, results []interface{}) ([]byte, []byte, error) {
+	contents, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, result := range results {
+		section, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		report.Sections = append(report.Sections, htmlSection{Name: names[i], JSON: string(section)})
+	}
+	html, err := report.render()
+	if err != nil {
+		return nil, nil, err
+	}
+	return contents, html, nil
+}
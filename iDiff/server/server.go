@@ -0,0 +1,322 @@
+// Package server runs iDiff as an HTTP service, so that images can be diffed and analyzed on a
+// shared host with Docker and the disk space for extraction.  Jobs are submitted to a bounded
+// queue and run by a fixed number of workers, each in a workspace of its own which is removed
+// when the job finishes.  Images used by several jobs are only extracted once, through an
+// idiff.ImageCache.
+//
+// The API is:
+//
+//	POST /jobs              submits a JobRequest, returning its Job with status 202
+//	GET  /jobs/<id>         returns the Job
+//	GET  /jobs/<id>/result  returns the job's results as JSON, or as HTML with ?format=html
+//
+// The API has no authentication, so jobs may only read images from registries, or from the
+// files beneath Config.LocalRoot, and never from the host's Docker daemon.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
+	"github.com/golang/glog"
+)
+
+// Defaults used for any setting of a Config which is not set.
+const (
+	DefaultWorkers     = 2
+	DefaultQueueSize   = 16
+	DefaultCacheImages = 8
+	DefaultRetention   = time.Hour
+)
+
+// maxRequestSize bounds the body of a job request.
+const maxRequestSize = 1 << 20
+
+// Config controls how jobs are queued and run.
+type Config struct {
+	// Options are used for every job.  A job's differs and platform replace those of Options.
+	// Job workspaces and cached images are created under Options.WorkDir.
+	Options idiff.Options
+	// Workers is how many jobs run at once.
+	Workers int
+	// QueueSize is how many jobs may wait to run.  Jobs submitted to a full queue are rejected.
+	QueueSize int
+	// CacheImages is how many extracted images are kept for later jobs once no job uses them.
+	CacheImages int
+	// Retention is how long a finished job's results are kept to be fetched.
+	Retention time.Duration
+	// LocalRoot, if set, is the directory jobs may read tars, OCI layouts, SBOMs and root file
+	// systems from.  Otherwise jobs may only diff and analyze images pulled from registries.
+	LocalRoot string
+}
+
+func (c Config) withDefaults() Config {
+	if c.Workers <= 0 {
+		c.Workers = DefaultWorkers
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+	if c.CacheImages <= 0 {
+		c.CacheImages = DefaultCacheImages
+	}
+	if c.Retention <= 0 {
+		c.Retention = DefaultRetention
+	}
+	return c
+}
+
+// Server is an http.Handler serving the job API.
+type Server struct {
+	config   Config
+	cache    *idiff.ImageCache
+	cacheDir string
+	mux      *http.ServeMux
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan *job
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	closed bool
+}
+
+// New starts a server's workers.  Close must be called to stop them and remove cached images.
+func New(config Config) (*Server, error) {
+	s, err := newServer(config)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	return s, nil
+}
+
+// newServer returns a server without any workers running its jobs.
+func newServer(config Config) (*Server, error) {
+	config = config.withDefaults()
+	cacheDir, err := ioutil.TempDir(config.Options.WorkDir, "idiff-cache-")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		config:   config,
+		cache:    idiff.NewImageCache(cacheDir, config.CacheImages),
+		cacheDir: cacheDir,
+		mux:      http.NewServeMux(),
+		ctx:      ctx,
+		cancel:   cancel,
+		queue:    make(chan *job, config.QueueSize),
+		jobs:     map[string]*job{},
+	}
+	s.config.Options.Cache = s.cache
+	s.mux.HandleFunc("/jobs", s.handleJobs)
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	return s, nil
+}
+
+// Close stops accepting jobs, cancels those queued or running, waits for them to finish and
+// removes the cached images.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+	err := s.cache.Close()
+	if rmErr := os.RemoveAll(s.cacheDir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Jobs are submitted with %s", http.MethodPost))
+		return
+	}
+	var request JobRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid job request: %s", err))
+		return
+	}
+	if err := request.validate(s.config.LocalRoot); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	j, err := s.submit(request)
+	if err != nil {
+		if err == errQueueFull {
+			w.Header().Set("Retry-After", "30")
+		}
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Jobs are read with %s", http.MethodGet))
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "result") {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	j, ok := s.jobs[parts[0]]
+	var status Job
+	var result, html []byte
+	if ok {
+		status, result, html = j.Job, j.result, j.html
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No job %s", parts[0]))
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+
+	if status.Status != StatusSucceeded {
+		writeError(w, http.StatusConflict, fmt.Errorf("Job %s has no result as it is %s", status.ID, status.Status))
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(result)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(html)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Unknown result format %q, expected json or html", r.URL.Query().Get("format")))
+	}
+}
+
+var errQueueFull = errors.New("The job queue is full")
+
+// submit queues a job, unless the queue is full.
+func (s *Server) submit(request JobRequest) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	j := &job{Job: Job{ID: id, Request: request, Status: StatusQueued, Created: time.Now()}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Job{}, errors.New("The server is shutting down")
+	}
+	s.prune()
+	select {
+	case s.queue <- j:
+	default:
+		return Job{}, errQueueFull
+	}
+	s.jobs[id] = j
+	glog.Infof("Queued %s job %s", request.Type, id)
+	return j.Job, nil
+}
+
+// prune forgets the jobs which finished longer ago than the retention period.
+// It must be called with s.mu held.
+func (s *Server) prune() {
+	for id, j := range s.jobs {
+		if j.Finished != nil && time.Since(*j.Finished) > s.config.Retention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *Server) work() {
+	defer s.wg.Done()
+	for j := range s.queue {
+		s.run(j)
+	}
+}
+
+func (s *Server) run(j *job) {
+	s.mu.Lock()
+	started := time.Now()
+	j.Status, j.Started = StatusRunning, &started
+	request := j.Request
+	s.mu.Unlock()
+
+	glog.Infof("Running %s job %s", request.Type, j.ID)
+	result, html, err := execute(s.ctx, request, s.config.Options)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := time.Now()
+	j.Finished = &finished
+	if err != nil {
+		glog.Errorf("Job %s failed: %s", j.ID, err)
+		j.Status, j.Error = StatusFailed, err.Error()
+		return
+	}
+	glog.Infof("Job %s succeeded", j.ID)
+	j.Status, j.result, j.html = StatusSucceeded, result, html
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	contents, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(contents)
+}
+
+// writeError responds with the error as a JSON object holding its message.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct{ Error string }{err.Error()})
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/idiff"
+	"github.com/GoogleCloudPlatform/runtimes-common/iDiff/utils"
+)
+
+const (
+	testTars = "../utils/testTars"
+	tar1     = testTars + "/la-croix1.tar"
+	tar2     = testTars + "/la-croix2.tar"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server, string) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	s, err := New(Config{Options: idiff.Options{WorkDir: workDir}, LocalRoot: testTars})
+	if err != nil {
+		t.Fatalf("Could not create server: %s", err)
+	}
+	return s, httptest.NewServer(s), workDir
+}
+
+func submit(t *testing.T, url string, request JobRequest) Job {
+	body, _ := json.Marshal(request)
+	resp, err := http.Post(url+"/jobs", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not submit job: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		contents, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("Expected job to be accepted but got %d: %s", resp.StatusCode, contents)
+	}
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatalf("Could not decode job: %s", err)
+	}
+	if location := resp.Header.Get("Location"); location != "/jobs/"+job.ID {
+		t.Errorf("Expected job location /jobs/%s but got %s", job.ID, location)
+	}
+	return job
+}
+
+// wait polls the job until it finishes.
+func wait(t *testing.T, url string, id string) Job {
+	for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		resp, err := http.Get(url + "/jobs/" + id)
+		if err != nil {
+			t.Fatalf("Could not get job: %s", err)
+		}
+		var job Job
+		err = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Could not decode job: %s", err)
+		}
+		if job.Status == StatusSucceeded || job.Status == StatusFailed {
+			return job
+		}
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return Job{}
+}
+
+func get(t *testing.T, url string) (int, string, []byte) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Could not get %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Could not read %s: %s", url, err)
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), contents
+}
+
+func TestServeDiff(t *testing.T) {
+	s, ts, workDir := newTestServer(t)
+	defer os.RemoveAll(workDir)
+	defer ts.Close()
+
+	job := submit(t, ts.URL, JobRequest{Type: JobDiff, Image1: tar1, Image2: tar2, Differs: []string{"file", "history"}})
+	if job.Status != StatusQueued {
+		t.Errorf("Expected submitted job to be queued but got %s", job.Status)
+	}
+	if job = wait(t, ts.URL, job.ID); job.Status != StatusSucceeded {
+		t.Fatalf("Expected job to succeed but got %s: %s", job.Status, job.Error)
+	}
+
+	status, contentType, contents := get(t, ts.URL+"/jobs/"+job.ID+"/result")
+	if status != http.StatusOK || contentType != "application/json" {
+		t.Fatalf("Expected JSON result but got %d %s: %s", status, contentType, contents)
+	}
+	var output struct {
+		Summary utils.ComparisonSummary
+		Diffs   []struct {
+			DiffType string
+			Diff     struct{ Adds []string }
+		}
+	}
+	if err := json.Unmarshal(contents, &output); err != nil {
+		t.Fatalf("Could not decode result: %s", err)
+	}
+	if len(output.Diffs) != 2 || output.Diffs[0].DiffType != "FileDiffer" || output.Diffs[1].DiffType != "HistoryDiffer" {
+		t.Fatalf("Expected file and history diffs but got: %s", contents)
+	}
+	if adds := output.Diffs[0].Diff.Adds; len(adds) != 1 || adds[0] != "nest/f1.txt" {
+		t.Errorf("Expected file adds [nest/f1.txt] but got: %v", adds)
+	}
+	if len(output.Summary.Differs) != 2 {
+		t.Errorf("Expected a summary of both differs but got: %+v", output.Summary)
+	}
+
+	status, contentType, contents = get(t, ts.URL+"/jobs/"+job.ID+"/result?format=html")
+	if status != http.StatusOK || !strings.HasPrefix(contentType, "text/html") {
+		t.Fatalf("Expected HTML result but got %d %s: %s", status, contentType, contents)
+	}
+	for _, expected := range []string{"<h2>Summary</h2>", "<h2>FileDiffer</h2>", "nest/f1.txt"} {
+		if !bytes.Contains(contents, []byte(expected)) {
+			t.Errorf("Expected HTML result to contain %q but got: %s", expected, contents)
+		}
+	}
+
+	// Once the job finishes only the cache is left in the work dir.
+	if contents, _ := ioutil.ReadDir(workDir); len(contents) != 1 || contents[0].Name() != filepath.Base(s.cacheDir) {
+		t.Errorf("Expected job workspace to be removed but found: %v", contents)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Got unexpected error closing server: %s", err)
+	}
+	if contents, _ := ioutil.ReadDir(workDir); len(contents) != 0 {
+		t.Errorf("Expected work dir to be empty after closing but found %d entries", len(contents))
+	}
+}
+
+func TestServeAnalyze(t *testing.T) {
+	s, ts, workDir := newTestServer(t)
+	defer os.RemoveAll(workDir)
+	defer s.Close()
+	defer ts.Close()
+
+	job := submit(t, ts.URL, JobRequest{Type: JobAnalyze, Image: tar2, Differs: []string{"file"}})
+	if job = wait(t, ts.URL, job.ID); job.Status != StatusSucceeded {
+		t.Fatalf("Expected job to succeed but got %s: %s", job.Status, job.Error)
+	}
+	_, _, contents := get(t, ts.URL+"/jobs/"+job.ID+"/result")
+	var output []struct {
+		AnalyzeType string
+		Analysis    []string
+	}
+	if err := json.Unmarshal(contents, &output); err != nil {
+		t.Fatalf("Could not decode result: %s", err)
+	}
+	if len(output) != 1 || output[0].AnalyzeType != "FileDiffer" || len(output[0].Analysis) == 0 {
+		t.Errorf("Expected the files of the image but got: %s", contents)
+	}
+}
+
+func TestServeFailedJob(t *testing.T) {
+	s, ts, workDir := newTestServer(t)
+	defer os.RemoveAll(workDir)
+	defer s.Close()
+	defer ts.Close()
+
+	job := submit(t, ts.URL, JobRequest{Type: JobDiff, Image1: tar1, Image2: tar2, Differs: []string{"nonexistent"}})
+	if job = wait(t, ts.URL, job.ID); job.Status != StatusFailed || job.Error == "" {
+		t.Fatalf("Expected job with an unknown differ to fail but got %s", job.Status)
+	}
+	if status, _, contents := get(t, ts.URL+"/jobs/"+job.ID+"/result"); status != http.StatusConflict {
+		t.Errorf("Expected no result for failed job but got %d: %s", status, contents)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	s, ts, workDir := newTestServer(t)
+	defer os.RemoveAll(workDir)
+	defer s.Close()
+	defer ts.Close()
+
+	for _, body := range []string{
+		`not json`,
+		`{"Type": "diff", "Image1": "` + tar1 + `"}`,
+		`{"Type": "analyze"}`,
+		`{"Type": "sbom", "Image": "` + tar1 + `"}`,
+		`{"Type": "diff", "Image1": "` + tar1 + `", "Image2": "?!bad"}`,
+		`{"Type": "analyze", "Image": "` + tar1 + `", "Unknown": true}`,
+		`{"Type": "analyze", "Image": "` + tar1 + `", "Platform": "linux"}`,
+	} {
+		resp, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Could not submit job: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected job %s to be rejected but got %d", body, resp.StatusCode)
+		}
+	}
+
+	if status, _, _ := get(t, ts.URL+"/jobs/unknown"); status != http.StatusNotFound {
+		t.Errorf("Expected unknown job not to be found but got %d", status)
+	}
+	if status, _, _ := get(t, ts.URL+"/jobs"); status != http.StatusMethodNotAllowed {
+		t.Errorf("Expected jobs to only be submitted with POST but got %d", status)
+	}
+}
+
+func TestServeLocalSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	os.Symlink("..", filepath.Join(root, "parent"))
+	contents, _ := ioutil.ReadFile(tar1)
+	ioutil.WriteFile(filepath.Join(root, "image.tar"), contents, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "outside.tar"), contents, 0644)
+
+	for _, test := range []struct {
+		descrip   string
+		source    string
+		localRoot string
+		allowed   bool
+	}{
+		{descrip: "Registry image", source: "gcr.io/google-appengine/python:latest", allowed: true},
+		{descrip: "Registry image with scheme", source: "docker://ubuntu", allowed: true},
+		{descrip: "Tar without a local root", source: tar1},
+		{descrip: "Tar with scheme without a local root", source: "tar://" + tar1},
+		{descrip: "Directory without a local root", source: "dir://" + dir},
+		{descrip: "Daemon image", source: "daemon://ubuntu", localRoot: root},
+		{descrip: "Daemon image ID", source: "0123456789ab", localRoot: root},
+		{descrip: "Container", source: "container://app", localRoot: root},
+		{descrip: "Tar in local root", source: filepath.Join(root, "image.tar"), localRoot: root, allowed: true},
+		{descrip: "Tar outside local root", source: filepath.Join(dir, "outside.tar"), localRoot: root},
+		{descrip: "Tar reached through a symlink", source: filepath.Join(root, "parent", "outside.tar"), localRoot: root},
+		{descrip: "Tar with a relative path out of local root", source: "tar://" + root + "/../outside.tar", localRoot: root},
+		{descrip: "Directory above local root", source: "dir://" + dir, localRoot: root},
+	} {
+		ref, err := utils.ParseImageSource(test.source)
+		if err != nil {
+			t.Fatalf("%s: could not parse source: %s", test.descrip, err)
+		}
+		if err := checkSource(ref, test.localRoot); test.allowed && err != nil {
+			t.Errorf("%s: got unexpected error: %s", test.descrip, err)
+		} else if !test.allowed && err == nil {
+			t.Errorf("%s: expected source %s to be rejected but got no error", test.descrip, test.source)
+		}
+	}
+
+	// Jobs with local sources are rejected when they are submitted.
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+	s, err := newServer(Config{Options: idiff.Options{WorkDir: workDir}})
+	if err != nil {
+		t.Fatalf("Could not create server: %s", err)
+	}
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	body, _ := json.Marshal(JobRequest{Type: JobDiff, Image1: tar1, Image2: "dir:///"})
+	resp, err := http.Post(ts.URL+"/jobs", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not submit job: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected job with local sources to be rejected but got %d", resp.StatusCode)
+	}
+}
+
+func TestServeQueueFull(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "idiff-test")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+	// Without workers nothing leaves the queue.
+	s, err := newServer(Config{Options: idiff.Options{WorkDir: workDir}, QueueSize: 1, LocalRoot: testTars})
+	if err != nil {
+		t.Fatalf("Could not create server: %s", err)
+	}
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	request := JobRequest{Type: JobAnalyze, Image: tar1}
+	submit(t, ts.URL, request)
+	body, _ := json.Marshal(request)
+	resp, err := http.Post(ts.URL+"/jobs", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not submit job: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected job submitted to a full queue to be rejected but got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,20 @@
+import json
+import sys
+
+
+def _process_test_diff(file_path):
+    with open(file_path) as f:
+        diffs = json.load(f)
+
+    for diff in diffs:
+        if diff["DiffType"] in ("AptDiffer", "PipDiffer", "NodeDiffer"):
+            # The history steps packages are attributed to depend on how
+            # the test images were built, so they are not compared.
+            diff["Diff"].pop("IntroducedBy", None)
+
+    with open(file_path, 'w') as f:
+        json.dump(diffs, f, indent=4)
+
+
+if __name__ == '__main__':
+    sys.exit(_process_test_diff(sys.argv[1]))
@@ -0,0 +1,24 @@
+import json
+import sys
+
+
+def _process_test_diff(file_path):
+    with open(file_path) as f:
+        output = json.load(f)
+
+    # The summary is derived from the diffs, and its size change depends on
+    # the layers of the test images, so only the diffs are compared once the
+    # summary is checked to cover each of them.
+    summary = output["Summary"]
+    diffs = output["Diffs"]
+    summarized = sorted(d["Differ"] for d in summary["Differs"])
+    if summarized != sorted(d["DiffType"] for d in diffs):
+        print("Summary of {0} does not cover its diffs".format(file_path))
+        return 1
+
+    with open(file_path, 'w') as f:
+        json.dump(diffs, f, indent=4)
+
+
+if __name__ == '__main__':
+    sys.exit(_process_test_diff(sys.argv[1]))
@@ -0,0 +1,25 @@
+package utils
+
+import "time"
+
+// CertDiff stores the changes to the trusted CA certificates between two images.
+type CertDiff struct {
+	Image1 string
+	Image2 string
+	// ExpiryDays is how far ahead certificates of the second image are checked for expiry.
+	ExpiryDays int
+	Added      []CertInfo
+	Removed    []CertInfo
+	// Expiring lists the certificates of the second image which have expired or expire within ExpiryDays.
+	Expiring []CertInfo
+}
+
+// CertInfo describes a CA certificate found in an image.
+type CertInfo struct {
+	Subject string
+	// Fingerprint is the hex encoded SHA-256 digest of the certificate's DER encoding.
+	Fingerprint string
+	NotAfter    time.Time
+	// Files lists the paths within the image of the bundles holding the certificate.
+	Files []string
+}
@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/golang/glog"
+)
+
+// ContainerScheme prefixes the ID or name of a running or stopped container given as an image source.
+const ContainerScheme = "container://"
+
+// containerLayer is the directory, alongside the image's own layers, holding what the container changed.
+const containerLayer = "container"
+
+// Kinds of change reported by the Engine API for a container's file system.
+const (
+	containerChangeModify = 0
+	containerChangeAdd    = 1
+	containerChangeDelete = 2
+)
+
+// CheckContainer returns whether the source names a container.
+func CheckContainer(source string) bool {
+	return strings.HasPrefix(source, ContainerScheme) && len(source) > len(ContainerScheme)
+}
+
+// ContainerPrepper prepares the file system of a container as its image with an extra top layer
+// holding the files the container added, modified or deleted.  The Docker Engine client is always used.
+type ContainerPrepper struct {
+	ImagePrepper
+}
+
+func (p ContainerPrepper) ImageToFS(ctx context.Context, dir string) error {
+	cli, err := client.NewEnvClient()
+	if err != nil {
+		return err
+	}
+	return ContainerToFS(ctx, cli, strings.TrimPrefix(p.Source, ContainerScheme), dir, p.Limits)
+}
+
+// ContainerImageID returns the ID of the image the container was created from.
+func ContainerImageID(ctx context.Context, cli client.APIClient, name string) (string, error) {
+	info, err := cli.ContainerInspect(ctx, strings.TrimPrefix(name, ContainerScheme))
+	if err != nil {
+		return "", err
+	}
+	return info.Image, nil
+}
+
+// ContainerToFS extracts the image of the container to dir and adds a layer on top of it
+// recording the changes the container made to its file system.  The limits apply to the image
+// and the container's layer together.
+func ContainerToFS(ctx context.Context, cli client.APIClient, name, dir string, limits ExtractLimits) error {
+	info, err := cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	tarPath, err := ImageToTar(ctx, cli, info.Image, dir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tarPath)
+	if err := getImageFromTar(ctx, tarPath, dir, "", limits); err != nil {
+		return err
+	}
+
+	glog.Infof("Exporting changes made by container %s", name)
+	changes, err := cli.ContainerDiff(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+	export := func() (io.ReadCloser, error) {
+		return cli.ContainerExport(ctx, info.ID)
+	}
+	layerTar := filepath.Join(dir, containerLayer, "layer.tar")
+	if err := writeContainerLayer(export, changes, layerTar); err != nil {
+		return err
+	}
+	// Tars written by the container are part of its file system, so only the layer itself is untarred.
+	if err := newTarExtractor(limits).untar(layerTar, filepath.Join(dir, containerLayer, "layer")); err != nil {
+		return err
+	}
+	if err := os.Remove(layerTar); err != nil {
+		return err
+	}
+	createdBy := fmt.Sprintf("container %s", strings.TrimPrefix(info.Name, "/"))
+	return addContainerLayer(dir, createdBy, info.Created)
+}
+
+// writeContainerLayer writes a layer tar holding the entries of the container's exported file system
+// which were added or modified, along with their parent directories, and whiteouts for deleted entries.
+// Hardlinks to files which are not in the layer are written as copies of those files, read from a
+// second export of the file system.
+func writeContainerLayer(export func() (io.ReadCloser, error), changes []container.ContainerChangeResponseItem, layerTar string) error {
+	changed := map[string]bool{}
+	parents := map[string]bool{}
+	deleted := []string{}
+	for _, change := range changes {
+		p := path.Clean("/" + change.Path)
+		switch change.Kind {
+		case containerChangeModify, containerChangeAdd:
+			changed[p] = true
+			for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+				parents[dir] = true
+			}
+		case containerChangeDelete:
+			deleted = append(deleted, p)
+		}
+	}
+	// A whiteout for a deleted directory already hides its contents, but needs its own parent.
+	isDeleted := map[string]bool{}
+	for _, p := range deleted {
+		isDeleted[p] = true
+	}
+	whiteouts := []string{}
+	for _, p := range deleted {
+		hidden := false
+		for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+			hidden = hidden || isDeleted[dir]
+		}
+		if hidden {
+			continue
+		}
+		whiteouts = append(whiteouts, p)
+		for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+			parents[dir] = true
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(layerTar), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(layerTar)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+
+	rc, err := export()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	written := map[string]bool{"/": true}
+	// unlinked holds the hardlinks whose targets are not in the layer, by target.
+	unlinked := map[string][]*tar.Header{}
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Could not read container export: %s", err)
+		}
+		p := path.Clean("/" + header.Name)
+		if !changed[p] && !(parents[p] && header.Typeflag == tar.TypeDir) {
+			continue
+		}
+		if header.Typeflag == tar.TypeLink {
+			if target := path.Clean("/" + header.Linkname); !written[target] {
+				unlinked[target] = append(unlinked[target], header)
+				continue
+			}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+		written[p] = true
+	}
+	if len(unlinked) > 0 {
+		if err := writeLinkCopies(tw, export, unlinked); err != nil {
+			return err
+		}
+	}
+	for _, p := range whiteouts {
+		if err := writeParentDirs(tw, path.Dir(p), written); err != nil {
+			return err
+		}
+		whiteout := &tar.Header{
+			Name:     strings.TrimPrefix(path.Join(path.Dir(p), ".wh."+path.Base(p)), "/"),
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+		}
+		if err := tw.WriteHeader(whiteout); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writeLinkCopies reads the container's file system again for the targets of the hardlinks, writing
+// the first link to each target as a regular file holding its content and the others as links to it.
+func writeLinkCopies(tw *tar.Writer, export func() (io.ReadCloser, error), links map[string][]*tar.Header) error {
+	rc, err := export()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for len(links) > 0 {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Could not read container export: %s", err)
+		}
+		p := path.Clean("/" + header.Name)
+		headers, ok := links[p]
+		if !ok || (header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA) {
+			continue
+		}
+		delete(links, p)
+		for i, link := range headers {
+			copied := *link
+			if i == 0 {
+				copied.Typeflag, copied.Linkname, copied.Size = tar.TypeReg, "", header.Size
+			} else {
+				copied.Linkname = headers[0].Name
+			}
+			if err := tw.WriteHeader(&copied); err != nil {
+				return err
+			}
+			if i == 0 {
+				if _, err := io.Copy(tw, tr); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for target, headers := range links {
+		return fmt.Errorf("Could not find %s, the target of hardlink %s, in the container export", target, headers[0].Name)
+	}
+	return nil
+}
+
+// writeParentDirs writes entries for the directory and its parents which are not yet in the layer.
+func writeParentDirs(tw *tar.Writer, dir string, written map[string]bool) error {
+	if written[dir] {
+		return nil
+	}
+	if err := writeParentDirs(tw, path.Dir(dir), written); err != nil {
+		return err
+	}
+	written[dir] = true
+	return tw.WriteHeader(&tar.Header{Name: strings.TrimPrefix(dir, "/") + "/", Typeflag: tar.TypeDir, Mode: 0755})
+}
+
+// addContainerLayer records the container's layer in the extracted image's manifest and history,
+// so that it is merged last and reported as a history step.
+func addContainerLayer(dir, createdBy, created string) error {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	if len(manifest) == 0 {
+		return fmt.Errorf("No image found in manifest of %s", dir)
+	}
+	manifest[0].Layers = append(manifest[0].Layers, containerLayer+"/layer.tar")
+	contents, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), contents, 0644); err != nil {
+		return err
+	}
+
+	configPath, err := getConfigPath(dir)
+	if err != nil {
+		return err
+	}
+	contents, err = ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	// Keep every field of the config, only the history is extended.
+	var config map[string]interface{}
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("Could not parse config %s: %s", configPath, err)
+	}
+	history, _ := config["history"].([]interface{})
+	config["history"] = append(history, map[string]interface{}{
+		"created":    created,
+		"created_by": createdBy,
+		"comment":    "Changes made by the container at runtime",
+	})
+	contents, err = json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configPath, contents, 0644)
+}
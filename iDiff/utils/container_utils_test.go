@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type tarEntry struct {
+	name    string
+	content string
+	dir     bool
+	// link is the target of a hardlink.
+	link string
+}
+
+func tarBytes(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.content))}
+		if entry.dir {
+			header = &tar.Header{Name: entry.name, Mode: 0755, Typeflag: tar.TypeDir}
+		} else if entry.link != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeLink, Linkname: entry.link}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Could not write tar header: %s", err)
+		}
+		tw.Write([]byte(entry.content))
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+// newFakeEngine serves the parts of the Docker Engine API used to prepare a container.
+func newFakeEngine(t *testing.T) *httptest.Server {
+	layer := tarBytes(t, []tarEntry{
+		{name: "etc/", dir: true},
+		{name: "etc/app.conf", content: "debug=false"},
+		{name: "etc/removed.conf", content: "old"},
+		{name: "var/", dir: true},
+		{name: "var/cache/", dir: true},
+		{name: "var/cache/pkg", content: "cache"},
+		{name: "usr/", dir: true},
+		{name: "usr/bin/", dir: true},
+		{name: "usr/bin/app", content: "binary"},
+	})
+	image := tarBytes(t, []tarEntry{
+		{name: "manifest.json", content: `[{"Config":"config.json","RepoTags":["app:latest"],"Layers":["layer1/layer.tar"]}]`},
+		{name: "config.json", content: `{"config":{"User":"app"},"history":[{"created_by":"ADD rootfs /"}],"rootfs":{"diff_ids":["sha256:layer1"]}}`},
+		{name: "layer1/", dir: true},
+		{name: "layer1/layer.tar", content: string(layer)},
+	})
+	export := tarBytes(t, []tarEntry{
+		{name: "etc/", dir: true},
+		{name: "etc/app.conf", content: "debug=true"},
+		{name: "tmp/", dir: true},
+		{name: "tmp/run/", dir: true},
+		{name: "tmp/run/app.pid", content: "42"},
+		{name: "usr/", dir: true},
+		{name: "usr/bin/", dir: true},
+		{name: "usr/bin/app", content: "binary"},
+		{name: "usr/bin/app-alias", link: "usr/bin/app"},
+		{name: "usr/bin/app-alias2", link: "usr/bin/app"},
+	})
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/web/json"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"Id":"c0ffee","Name":"/web","Image":"sha256:1234567890abcdef","Created":"2018-01-01T00:00:00Z"}`))
+		case strings.HasSuffix(r.URL.Path, "/images/get") && r.URL.Query().Get("names") == "sha256:1234567890abcdef":
+			w.Write(image)
+		case strings.HasSuffix(r.URL.Path, "/containers/c0ffee/changes"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"Kind":0,"Path":"/etc"},{"Kind":0,"Path":"/etc/app.conf"},{"Kind":2,"Path":"/etc/removed.conf"},` +
+				`{"Kind":1,"Path":"/tmp"},{"Kind":1,"Path":"/tmp/run"},{"Kind":1,"Path":"/tmp/run/app.pid"},` +
+				`{"Kind":2,"Path":"/var/cache"},{"Kind":2,"Path":"/var/cache/pkg"},` +
+				`{"Kind":0,"Path":"/usr/bin"},{"Kind":1,"Path":"/usr/bin/app-alias"},{"Kind":1,"Path":"/usr/bin/app-alias2"}]`))
+		case strings.HasSuffix(r.URL.Path, "/containers/c0ffee/export"):
+			w.Write(export)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestContainerPrepper(t *testing.T) {
+	server := newFakeEngine(t)
+	defer server.Close()
+	for key, value := range map[string]string{
+		"DOCKER_HOST":        "tcp://" + strings.TrimPrefix(server.URL, "http://"),
+		"DOCKER_API_VERSION": "1.24",
+		"DOCKER_CERT_PATH":   "",
+	} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+	workDir, err := ioutil.TempDir("", "container")
+	if err != nil {
+		t.Fatalf("Could not create work dir: %s", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	if !CheckContainer("container://web") || CheckImageURL("container://web") {
+		t.Fatalf("Expected container://web to be classified as a container")
+	}
+	image, err := ImagePrepper{Source: "container://web", WorkDir: workDir}.GetImage(context.Background())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	files, err := GetImageFiles(image.FSPath)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	for p, expected := range map[string]string{
+		"/etc/app.conf":    "debug=true",
+		"/tmp/run/app.pid": "42",
+		"/usr/bin/app":     "binary",
+		// Hardlinks to unchanged files hold a copy of the file in the container's layer.
+		"/usr/bin/app-alias":  "binary",
+		"/usr/bin/app-alias2": "binary",
+	} {
+		file, ok := files[p]
+		if !ok {
+			t.Errorf("Expected %s in the container's file system", p)
+			continue
+		}
+		if content, _ := ioutil.ReadFile(file.FSPath); string(content) != expected {
+			t.Errorf("Expected %s to contain %q but got %q", p, expected, content)
+		}
+	}
+	for _, p := range []string{"/etc/removed.conf", "/var/cache", "/var/cache/pkg"} {
+		if _, ok := files[p]; ok {
+			t.Errorf("Expected %s to be deleted by the container", p)
+		}
+	}
+	if file := files["/usr/bin/app"]; filepath.Base(filepath.Dir(file.Layer)) != "layer1" {
+		t.Errorf("Expected unchanged /usr/bin/app to come from the image layer but got %s", file.Layer)
+	}
+
+	if len(image.Steps) != 2 || image.Steps[1].CreatedBy != "container web" || image.Steps[1].Layer != containerLayer {
+		t.Errorf("Expected the container's changes as the last history step but got: %v", image.Steps)
+	}
+	if config, err := GetImageConfig(image.FSPath); err != nil || config.Config.User != "app" {
+		t.Errorf("Expected the image config to be kept but got: %v, %v", config, err)
+	}
+}
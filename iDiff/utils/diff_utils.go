@@ -1,9 +1,43 @@
 package utils
 
 import (
+	"bytes"
+	"strings"
+
 	"github.com/pmezard/go-difflib/difflib"
 )
 
+// PluginDiff stores the result reported by an external differ plugin.
+type PluginDiff struct {
+	Image1 string
+	Image2 string
+	Adds   []string
+	Dels   []string
+	Mods   []string
+}
+
+// DifferListing lists the available differs, as shown by `iDiff differs list`.
+type DifferListing struct {
+	Differs []DifferDescription
+}
+
+func (l DifferListing) OutputText() error {
+	return TemplateOutput(l)
+}
+
+// DifferDescription describes a differ and how it is selected.
+type DifferDescription struct {
+	Name string
+	// Flag is the command line flag selecting the differ.
+	Flag string
+	// Default differs are run when none are selected.
+	Default bool
+	// Analyzer differs can also describe a single image.
+	Analyzer    bool
+	DiffType    string
+	Description string
+}
+
 // Modification of difflib's unified differ
 func GetAdditions(a, b []string) []string {
 	matcher := difflib.NewMatcher(a, b)
@@ -57,3 +91,41 @@ func GetMatches(a, b []string) []string {
 	}
 	return matches
 }
+
+// binarySniffLen is how much of a file is checked for NUL bytes when deciding if it is binary, as git does.
+const binarySniffLen = 8000
+
+// IsBinary reports whether content looks like binary rather than text.
+func IsBinary(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// GetUnifiedDiff returns a unified diff with three lines of context between two text contents.
+func GetUnifiedDiff(name1, name2 string, content1, content2 []byte) (string, error) {
+	diff := difflib.UnifiedDiff{
+		A:        splitLines(string(content1)),
+		B:        splitLines(string(content2)),
+		FromFile: name1,
+		ToFile:   name2,
+		Context:  3,
+	}
+	return difflib.GetUnifiedDiffString(diff)
+}
+
+// splitLines splits text into lines which keep their line endings.  Unlike difflib.SplitLines it
+// does not add an empty line after a trailing newline, and marks a missing one as diff does.
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if last := lines[len(lines)-1]; last == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] = last + "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// dirLayer names the single layer a root file system directory is copied into.
+const dirLayer = "rootfs"
+
+// DirPrepper prepares images from a plain root file system directory, such as the unpacked
+// rootfs of a build, as an image with a single layer.  The directory is copied rather than
+// read in place, so it is extracted with the same checks and limits as an image tar and
+// removing the prepared image leaves it untouched.  The image's config is read from a sidecar
+// <dir>.json next to the directory if there is one.
+type DirPrepper struct {
+	ImagePrepper
+}
+
+func (p DirPrepper) ImageToFS(ctx context.Context, dir string) error {
+	root := filepath.Clean(p.Source)
+	glog.Info("Copying root file system directory to obtain image file system")
+	if err := copyDirLayer(ctx, root, filepath.Join(dir, dirLayer, "layer"), p.Limits); err != nil {
+		return err
+	}
+
+	config, err := ioutil.ReadFile(root + ".json")
+	if os.IsNotExist(err) {
+		// Without a config the directory is recorded as the only step of the image's history.
+		config, err = json.Marshal(map[string]interface{}{
+			"history": []map[string]string{{"created_by": fmt.Sprintf("dir %s", root)}},
+		})
+	} else if err == nil && !json.Valid(config) {
+		err = fmt.Errorf("Config %s.json is not valid JSON", root)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), config, 0644); err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal([]manifestJSON{{Config: "config.json", Layers: []string{dirLayer + "/layer.tar"}}})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "manifest.json"), contents, 0644)
+}
+
+// copyDirLayer copies the directory at root into target by streaming it through a tar.
+func copyDirLayer(ctx context.Context, root, target string, limits ExtractLimits) error {
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeDirTar(ctx, w, root))
+	}()
+	err := newTarExtractor(limits).untarReader(r, root, target)
+	// Stop the writer if extraction failed part way through.
+	r.CloseWithError(fmt.Errorf("Extraction of %s stopped", root))
+	return err
+}
+
+// writeDirTar writes the contents of the directory at root to w as a tar, with paths relative
+// to root.  Symlinks are written as links and are not followed.
+func writeDirTar(ctx context.Context, w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if info.Mode()&os.ModeSocket != 0 {
+			glog.Warningf("Skipping socket %s", path)
+			return nil
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if !info.Mode().IsRegular() {
+			return tw.WriteHeader(header)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, file, header.Size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
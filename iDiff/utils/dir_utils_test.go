@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDirPrepper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "rootfs")
+	os.MkdirAll(filepath.Join(root, "etc", "app"), 0755)
+	os.MkdirAll(filepath.Join(root, "bin"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "etc", "app", "app.conf"), []byte("debug=false"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "bin", "app"), []byte("binary"), 0755)
+	os.Symlink("/bin/app", filepath.Join(root, "bin", "run"))
+
+	image, err := ImagePrepper{Source: "dir://" + root, WorkDir: dir}.GetImage(context.Background())
+	if err != nil {
+		t.Fatalf("Got unexpected error preparing directory: %s", err)
+	}
+	if expected := []string{"dir " + root}; !reflect.DeepEqual(image.History, expected) {
+		t.Errorf("Expected history: %v but got: %v", expected, image.History)
+	}
+	if layers := GetImageLayers(image.FSPath); !reflect.DeepEqual(layers, []string{dirLayer}) {
+		t.Errorf("Expected a single layer but got: %v", layers)
+	}
+	files, err := GetImageFiles(image.FSPath)
+	if err != nil {
+		t.Fatalf("Got unexpected error merging layers: %s", err)
+	}
+	for path, mode := range map[string]os.FileMode{
+		"/etc/app/app.conf": 0644,
+		"/bin/app":          0755,
+	} {
+		if file, ok := files[path]; !ok || file.Info.Mode().Perm() != mode {
+			t.Errorf("Expected %s with mode %s in image but got: %v", path, mode, file.Info)
+		}
+	}
+	if link, err := os.Readlink(files["/bin/run"].FSPath); err != nil || link != "/bin/app" {
+		t.Errorf("Expected /bin/run to be copied as a symlink but got: %s, %v", link, err)
+	}
+	os.RemoveAll(image.FSPath)
+	if _, err := os.Stat(filepath.Join(root, "bin", "app")); err != nil {
+		t.Errorf("Expected the directory to be left in place after removing the image but got: %s", err)
+	}
+
+	// A sidecar config supplies the image's history and container config.
+	ioutil.WriteFile(root+".json", []byte(`{"config":{"User":"app"},"history":[{"created_by":"bazel rootfs"}]}`), 0644)
+	image, err = ImagePrepper{Source: "dir://" + root, WorkDir: dir}.GetImage(context.Background())
+	if err != nil {
+		t.Fatalf("Got unexpected error preparing directory with config: %s", err)
+	}
+	defer os.RemoveAll(image.FSPath)
+	if expected := []string{"bazel rootfs"}; !reflect.DeepEqual(image.History, expected) {
+		t.Errorf("Expected history: %v but got: %v", expected, image.History)
+	}
+	if config, err := GetImageConfig(image.FSPath); err != nil || config.Config.User != "app" {
+		t.Errorf("Expected config with user app but got: %v, %v", config, err)
+	}
+
+	if _, err := (ImagePrepper{Source: "dir://" + root, WorkDir: dir, Limits: ExtractLimits{MaxEntries: 2}}).GetImage(context.Background()); err == nil {
+		t.Errorf("Expected error copying a directory with more entries than allowed but got none")
+	}
+}
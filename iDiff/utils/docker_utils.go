@@ -8,33 +8,26 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"path"
 	"regexp"
-	"strings"
 	"syscall"
 
+	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
-	img "github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 	"github.com/golang/glog"
 )
 
-var eng bool
-
-func SetDockerEngine(useDocker bool) {
-	eng = useDocker
-}
-
-// ValidDockerVersion determines if there is a Docker client of the necessary version locally installed.
-func ValidDockerVersion() (bool, error) {
+// ValidDockerVersion determines if there is a Docker client of the necessary version locally installed
+// and whether it should be used instead of shelling out to the docker CLI.
+func ValidDockerVersion(useEngine bool) (bool, error) {
 	_, err := client.NewEnvClient()
 	if err != nil {
 		return false, fmt.Errorf("Docker client error: %s", err)
 	}
-	if eng {
-		return true, nil
-	}
-	return false, nil
+	return useEngine, nil
 }
+
 func getImagePullResponse(image string, response []Event) (string, error) {
 	var imageDigest string
 	for _, event := range response {
@@ -59,11 +52,15 @@ func processImagePullEvents(image string, events []Event) (string, string, error
 		return "", "", err
 	}
 
-	URLPattern := regexp.MustCompile("^.+/(.+(:.+){0,1})$")
-	URLMatch := URLPattern.FindStringSubmatch(image)
-	imageName := strings.Replace(URLMatch[1], ":", "", -1)
-	imageURL := strings.TrimSuffix(image, URLMatch[2])
-	imageID := imageURL + "@" + imageDigest
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", "", err
+	}
+	imageName := path.Base(reference.Path(named))
+	if tagged, ok := named.(reference.Tagged); ok {
+		imageName += tagged.Tag()
+	}
+	imageID := reference.FamiliarName(named) + "@" + imageDigest
 
 	return imageID, imageName, nil
 }
@@ -78,10 +75,13 @@ type Event struct {
 	} `json:"progressDetail"`
 }
 
-func pullImageFromRepo(image string) (string, string, error) {
+func pullImageFromRepo(ctx context.Context, image string) (string, string, error) {
 	glog.Info("Pulling image")
 	cli, err := client.NewEnvClient()
-	response, err := cli.ImagePull(context.Background(), image, types.ImagePullOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	response, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
 	if err != nil {
 		return "", "", err
 	}
@@ -108,34 +108,8 @@ type HistDiff struct {
 	Image2 string
 	Adds   []string
 	Dels   []string
-}
-
-func processHistOutput(response bytes.Buffer) ([]img.HistoryResponseItem, error) {
-	respReader := bytes.NewReader(response.Bytes())
-	reader := bufio.NewReader(respReader)
-	var history []img.HistoryResponseItem
-	var CreatedByIndex int
-	var SizeIndex int
-	for {
-		var event img.HistoryResponseItem
-		text, _, err := reader.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return history, err
-		}
-
-		line := string(text)
-		if CreatedByIndex == 0 {
-			CreatedByIndex = strings.Index(line, "CREATED BY")
-			SizeIndex = strings.Index(line, "SIZE")
-			continue
-		}
-		event.CreatedBy = line[CreatedByIndex:SizeIndex]
-		history = append(history, event)
-	}
-	return history, nil
+	// Steps lists the Dockerfile steps added, removed or changed, with the size impact of each.
+	Steps []HistoryStepDiff `json:",omitempty"`
 }
 
 func processPullCmdOutput(image string, response bytes.Buffer) (string, string, error) {
@@ -158,10 +132,15 @@ func processPullCmdOutput(image string, response bytes.Buffer) (string, string,
 	return processImagePullEvents(image, events)
 }
 
-func pullImageCmd(image string) (string, string, error) {
+// pullImageCmd pulls the image with the docker CLI, for the given os/arch[/variant] platform
+// unless it is empty.
+func pullImageCmd(ctx context.Context, image, platform string) (string, string, error) {
 	glog.Info("Pulling image")
 	pullArgs := []string{"pull", image}
-	dockerPullCmd := exec.Command("docker", pullArgs...)
+	if platform != "" {
+		pullArgs = []string{"pull", "--platform", platform, image}
+	}
+	dockerPullCmd := exec.CommandContext(ctx, "docker", pullArgs...)
 	var response bytes.Buffer
 	dockerPullCmd.Stdout = &response
 	if err := dockerPullCmd.Run(); err != nil {
@@ -176,10 +155,10 @@ func pullImageCmd(image string) (string, string, error) {
 	return processPullCmdOutput(image, response)
 }
 
-func imageToTarCmd(imageID, imageName string) (string, error) {
+func imageToTarCmd(ctx context.Context, imageID, imageName string) (string, error) {
 	glog.Info("Saving image")
 	cmdArgs := []string{"save", imageID}
-	dockerSaveCmd := exec.Command("docker", cmdArgs...)
+	dockerSaveCmd := exec.CommandContext(ctx, "docker", cmdArgs...)
 	var out bytes.Buffer
 	dockerSaveCmd.Stdout = &out
 	if err := dockerSaveCmd.Run(); err != nil {
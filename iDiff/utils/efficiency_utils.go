@@ -0,0 +1,53 @@
+package utils
+
+// Efficiency describes how much of the content stored in an image's layers is visible in its
+// merged file system, and how much is wasted on files later overwritten or deleted.
+type Efficiency struct {
+	Image string
+	// TotalSize is the size in bytes of all regular files stored across the image's layers.
+	TotalSize int64
+	// WastedSize is the size in bytes of the stored files hidden by a later layer.
+	WastedSize int64
+	// Score is the fraction of TotalSize visible in the merged file system, 1 for an image without waste.
+	Score  float64
+	Layers []LayerEfficiency
+	// Duplicates lists content stored more than once across the image's layers.
+	Duplicates []DuplicateContent
+}
+
+// LayerEfficiency describes the bytes a layer stores which later layers overwrite or delete.
+type LayerEfficiency struct {
+	Layer     string
+	CreatedBy string
+	Size      int64
+	// OverwrittenSize is the size of the layer's files replaced by a later layer.
+	OverwrittenSize int64
+	// DeletedSize is the size of the layer's files removed by a whiteout in a later layer.
+	DeletedSize int64
+}
+
+// DuplicateContent is a file content, identified by its SHA-256 hash, stored at several paths or layers.
+type DuplicateContent struct {
+	Hash  string
+	Size  int64
+	Files []DuplicateFile
+	// WastedSize is the size of all copies but one.
+	WastedSize int64
+}
+
+// DuplicateFile is one stored copy of a duplicated content.
+type DuplicateFile struct {
+	Path  string
+	Layer string
+}
+
+// EfficiencyDiff compares the efficiency of two images.
+type EfficiencyDiff struct {
+	Image1      string
+	Image2      string
+	Efficiency1 Efficiency
+	Efficiency2 Efficiency
+	// ScoreDelta is positive when the second image is more efficient than the first.
+	ScoreDelta      float64
+	WastedSizeDelta int64
+}
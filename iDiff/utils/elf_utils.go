@@ -0,0 +1,34 @@
+package utils
+
+// ElfInfo stores the dynamic linking information of an ELF file.
+type ElfInfo struct {
+	// Needed lists the DT_NEEDED libraries in the order the file declares them.
+	Needed  []string
+	Soname  string
+	Rpath   []string
+	Runpath []string
+}
+
+// ElfDiff stores the differences in dynamic linking between two images.
+type ElfDiff struct {
+	Image1 string
+	Image2 string
+	// Changed lists files present in both images whose linking information differs.
+	Changed []ElfChange
+	// Unresolved lists files in the second image with needed libraries which cannot be found in it,
+	// but could be found for the same file in the first image or which are new.
+	Unresolved []ElfUnresolved
+}
+
+// ElfChange stores the linking information of one file in two different images.
+type ElfChange struct {
+	Path  string
+	Info1 ElfInfo
+	Info2 ElfInfo
+}
+
+// ElfUnresolved stores the needed libraries of a file which the dynamic linker would not find.
+type ElfUnresolved struct {
+	Path      string
+	Libraries []string
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DiffFilters drop the files and packages a comparison should not report.
+type DiffFilters struct {
+	// ExcludePaths are glob patterns, as matched by path.Match, of the files the file differ
+	// does not report.  A pattern matching a directory excludes everything beneath it, and a
+	// pattern without a slash, such as *.pyc, matches file names in any directory.
+	ExcludePaths []string
+	// IgnorePackages are glob patterns of the names of packages the package differs do not report.
+	IgnorePackages []string
+}
+
+// Validate checks that the filters' patterns are well formed.
+func (f DiffFilters) Validate() error {
+	for _, pattern := range append(append([]string{}, f.ExcludePaths...), f.IgnorePackages...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid filter pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether the filters drop nothing.
+func (f DiffFilters) IsEmpty() bool {
+	return len(f.ExcludePaths) == 0 && len(f.IgnorePackages) == 0
+}
+
+// Apply drops the excluded files and ignored packages from the result in place.
+// Results of differs which list neither are left as they are.
+func (f DiffFilters) Apply(result DiffResult) {
+	switch r := result.(type) {
+	case *DirDiffResult:
+		f.filterDirDiff(&r.Diff)
+	case *PackageDiffResult:
+		f.filterPackageDiff(&r.Diff)
+	case *MultiVersionPackageDiffResult:
+		f.filterMultiVersionPackageDiff(&r.Diff)
+	}
+}
+
+// PathExcluded reports whether the path, or a directory containing it, matches one of the patterns.
+// Patterns without a slash are matched against the name of the file or directory alone.
+func PathExcluded(patterns []string, p string) bool {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	for ; p != "." && p != ""; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			target := p
+			if !strings.Contains(pattern, "/") {
+				target = path.Base(p)
+			}
+			if matched, _ := path.Match(strings.TrimPrefix(pattern, "/"), target); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PackageMatches reports whether the package name matches one of the patterns.
+func PackageMatches(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (f DiffFilters) filterPaths(paths []string) []string {
+	if len(f.ExcludePaths) == 0 {
+		return paths
+	}
+	kept := []string{}
+	for _, p := range paths {
+		if !PathExcluded(f.ExcludePaths, p) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func (f DiffFilters) filterDirDiff(diff *DirDiff) {
+	if len(f.ExcludePaths) == 0 {
+		return
+	}
+	diff.Adds = f.filterPaths(diff.Adds)
+	diff.Dels = f.filterPaths(diff.Dels)
+	if diff.Mods != nil {
+		diff.Mods = f.filterPaths(diff.Mods)
+	}
+	if diff.ContentDiffs != nil {
+		contentDiffs := []FileContentDiff{}
+		for _, contentDiff := range diff.ContentDiffs {
+			if !PathExcluded(f.ExcludePaths, contentDiff.Path) {
+				contentDiffs = append(contentDiffs, contentDiff)
+			}
+		}
+		diff.ContentDiffs = contentDiffs
+	}
+	if diff.Packages != nil {
+		packages := []PackageFiles{}
+		for _, files := range diff.Packages {
+			if files = f.filterPackageFiles(files); len(files.Adds)+len(files.Dels)+len(files.Mods) > 0 {
+				packages = append(packages, files)
+			}
+		}
+		diff.Packages = packages
+	}
+	if diff.Unmanaged != nil {
+		unmanaged := f.filterPackageFiles(*diff.Unmanaged)
+		diff.Unmanaged = &unmanaged
+	}
+}
+
+func (f DiffFilters) filterPackageFiles(files PackageFiles) PackageFiles {
+	files.Adds = f.filterPaths(files.Adds)
+	files.Dels = f.filterPaths(files.Dels)
+	files.Mods = f.filterPaths(files.Mods)
+	return files
+}
+
+func (f DiffFilters) filterPackageDiff(diff *PackageDiff) {
+	if len(f.IgnorePackages) == 0 {
+		return
+	}
+	for _, packages := range []map[string]PackageInfo{diff.Packages1, diff.Packages2} {
+		for name := range packages {
+			if PackageMatches(f.IgnorePackages, name) {
+				delete(packages, name)
+			}
+		}
+	}
+	infoDiff := []Info{}
+	for _, info := range diff.InfoDiff {
+		if !PackageMatches(f.IgnorePackages, info.Package) {
+			infoDiff = append(infoDiff, info)
+		}
+	}
+	diff.InfoDiff = infoDiff
+	for name := range diff.IntroducedBy {
+		if PackageMatches(f.IgnorePackages, name) {
+			delete(diff.IntroducedBy, name)
+		}
+	}
+}
+
+func (f DiffFilters) filterMultiVersionPackageDiff(diff *MultiVersionPackageDiff) {
+	if len(f.IgnorePackages) == 0 {
+		return
+	}
+	for _, packages := range []map[string]map[string]PackageInfo{diff.Packages1, diff.Packages2} {
+		for name := range packages {
+			if PackageMatches(f.IgnorePackages, name) {
+				delete(packages, name)
+			}
+		}
+	}
+	infoDiff := []MultiVersionInfo{}
+	for _, info := range diff.InfoDiff {
+		if !PackageMatches(f.IgnorePackages, info.Package) {
+			infoDiff = append(infoDiff, info)
+		}
+	}
+	diff.InfoDiff = infoDiff
+	for name := range diff.IntroducedBy {
+		if PackageMatches(f.IgnorePackages, name) {
+			delete(diff.IntroducedBy, name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathExcluded(t *testing.T) {
+	patterns := []string{"/var/lib/apt/lists", "*.pyc", "tmp/*"}
+	for p, expected := range map[string]bool{
+		"var/lib/apt/lists":              true,
+		"/var/lib/apt/lists/archive_gpg": true,
+		"var/lib/apt":                    false,
+		"app.pyc":                        true,
+		"app/main.pyc":                   true,
+		"app/main.py":                    false,
+		"tmp/cache/file":                 true,
+		"tmp":                            false,
+		"app/tmp/file":                   false,
+		"nest/f1.txt":                    false,
+	} {
+		if actual := PathExcluded(patterns, p); actual != expected {
+			t.Errorf("Expected PathExcluded(%s) to be %t but got %t", p, expected, actual)
+		}
+	}
+}
+
+func TestDiffFiltersApply(t *testing.T) {
+	filters := DiffFilters{ExcludePaths: []string{"var/cache"}, IgnorePackages: []string{"tzdata", "lib*"}}
+
+	dirResult := &DirDiffResult{Diff: DirDiff{
+		Adds:         []string{"app/main.py", "var/cache/apt/pkgcache.bin"},
+		Dels:         []string{"var/cache/old"},
+		Mods:         []string{"etc/hosts", "var/cache/ldconfig/aux-cache"},
+		ContentDiffs: []FileContentDiff{{Path: "etc/hosts"}, {Path: "var/cache/ldconfig/aux-cache"}},
+		Packages:     []PackageFiles{{Package: "apt", Adds: []string{"var/cache/apt/pkgcache.bin"}}},
+		Unmanaged:    &PackageFiles{Adds: []string{"app/main.py"}},
+	}}
+	filters.Apply(dirResult)
+	expectedDir := DirDiff{
+		Adds:         []string{"app/main.py"},
+		Dels:         []string{},
+		Mods:         []string{"etc/hosts"},
+		ContentDiffs: []FileContentDiff{{Path: "etc/hosts"}},
+		Packages:     []PackageFiles{},
+		Unmanaged:    &PackageFiles{Adds: []string{"app/main.py"}, Dels: []string{}, Mods: []string{}},
+	}
+	if !reflect.DeepEqual(dirResult.Diff, expectedDir) {
+		t.Errorf("Expected filtered file diff %+v but got %+v", expectedDir, dirResult.Diff)
+	}
+
+	packageResult := &PackageDiffResult{Diff: PackageDiff{
+		Packages1:    map[string]PackageInfo{"tzdata": {Version: "1"}, "curl": {Version: "7"}},
+		Packages2:    map[string]PackageInfo{"libssl": {Version: "1.1"}},
+		InfoDiff:     []Info{{Package: "libc6"}, {Package: "bash"}},
+		IntroducedBy: map[string]string{"libssl": "RUN apt-get install libssl", "bash": "RUN apt-get upgrade"},
+	}}
+	filters.Apply(packageResult)
+	expectedPackages := PackageDiff{
+		Packages1:    map[string]PackageInfo{"curl": {Version: "7"}},
+		Packages2:    map[string]PackageInfo{},
+		InfoDiff:     []Info{{Package: "bash"}},
+		IntroducedBy: map[string]string{"bash": "RUN apt-get upgrade"},
+	}
+	if !reflect.DeepEqual(packageResult.Diff, expectedPackages) {
+		t.Errorf("Expected filtered package diff %+v but got %+v", expectedPackages, packageResult.Diff)
+	}
+
+	multiResult := &MultiVersionPackageDiffResult{Diff: MultiVersionPackageDiff{
+		Packages1: map[string]map[string]PackageInfo{"libxml": {"/a": {Version: "2"}}},
+		Packages2: map[string]map[string]PackageInfo{"express": {"/b": {Version: "4"}}},
+		InfoDiff:  []MultiVersionInfo{{Package: "libfoo"}},
+	}}
+	filters.Apply(multiResult)
+	if len(multiResult.Diff.Packages1) != 0 || len(multiResult.Diff.Packages2) != 1 || len(multiResult.Diff.InfoDiff) != 0 {
+		t.Errorf("Expected ignored packages to be dropped from multi-version diff but got %+v", multiResult.Diff)
+	}
+}
+
+func TestDiffFiltersValidate(t *testing.T) {
+	if err := (DiffFilters{ExcludePaths: []string{"var/*"}, IgnorePackages: []string{"lib?"}}).Validate(); err != nil {
+		t.Errorf("Got unexpected error: %s", err)
+	}
+	if err := (DiffFilters{IgnorePackages: []string{"lib["}}).Validate(); err == nil {
+		t.Errorf("Expected error for malformed pattern but got none")
+	}
+}
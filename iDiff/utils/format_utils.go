@@ -4,20 +4,49 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"html/template"
+	"io"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"text/tabwriter"
+	"text/template"
 
 	"github.com/golang/glog"
 )
 
+// templates maps the type of each result to the template it is printed with as text.  The
+// templates of differs' results are added as the differs are registered.
 var templates = map[string]string{
-	"utils.PackageDiffResult":             SingleVersionOutput,
-	"utils.MultiVersionPackageDiffResult": MultiVersionOutput,
-	"utils.HistDiffResult":                HistoryOutput,
-	"utils.DirDiffResult":                 FSOutput,
+	"utils.PluginDiffResult":                 PluginOutput,
+	"utils.EfficiencyAnalyzeResult":          EfficiencyAnalysisOutput,
+	"utils.ReproDiffResult":                  ReproOutput,
+	"utils.ComparisonSummary":                SummaryOutput,
+	"utils.DifferListing":                    DifferListOutput,
+	"utils.ListAnalyzeResult":                ListAnalysisOutput,
+	"utils.PackageAnalyzeResult":             SingleVersionPackageAnalysisOutput,
+	"utils.MultiVersionPackageAnalyzeResult": MultiVersionPackageAnalysisOutput,
+}
+
+var templatesMu sync.RWMutex
+
+// RegisterTemplate sets the template a result type is printed with as text.  A type's template
+// may be registered again, as by differs sharing a result type, but not replaced.
+func RegisterTemplate(result interface{}, tmpl string) error {
+	resultType := reflect.TypeOf(result)
+	if resultType.Kind() == reflect.Ptr {
+		resultType = resultType.Elem()
+	}
+	if _, err := template.New("tmpl").Funcs(templateFuncs).Parse(tmpl); err != nil {
+		return fmt.Errorf("Invalid template for %s: %s", resultType, err)
+	}
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	if existing, ok := templates[resultType.String()]; ok && existing != tmpl {
+		return fmt.Errorf("A different template is registered for %s", resultType)
+	}
+	templates[resultType.String()] = tmpl
+	return nil
 }
 
 func JSONify(diff interface{}) error {
@@ -33,20 +62,44 @@ func JSONify(diff interface{}) error {
 
 func getTemplate(diff interface{}) (string, error) {
 	diffType := reflect.TypeOf(diff).String()
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
 	if template, ok := templates[diffType]; ok {
 		return template, nil
 	}
 	return "", fmt.Errorf("No available template")
 }
 
+// MarkdownOutput writes the data to stdout rendered through the given Markdown template.
+func MarkdownOutput(data interface{}, markdownTmpl string) error {
+	f := bufio.NewWriter(os.Stdout)
+	defer f.Flush()
+	return writeMarkdown(f, data, markdownTmpl)
+}
+
+func writeMarkdown(w io.Writer, data interface{}, markdownTmpl string) error {
+	funcs := template.FuncMap{"md": escapeMarkdownCell, "size": HumanSize}
+	tmpl, err := template.New("markdown").Funcs(funcs).Parse(markdownTmpl)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
+
+// escapeMarkdownCell makes text safe to place in a Markdown table cell.
+func escapeMarkdownCell(text string) string {
+	return strings.Replace(strings.Replace(text, "|", "\\|", -1), "\n", " ", -1)
+}
+
+var templateFuncs = template.FuncMap{"join": strings.Join, "size": HumanSize, "sizeDelta": HumanSizeDelta}
+
 func TemplateOutput(diff interface{}) error {
 	outputTmpl, err := getTemplate(diff)
 	if err != nil {
 		glog.Error(err)
 
 	}
-	funcs := template.FuncMap{"join": strings.Join}
-	tmpl, err := template.New("tmpl").Funcs(funcs).Parse(outputTmpl)
+	tmpl, err := template.New("tmpl").Funcs(templateFuncs).Parse(outputTmpl)
 	if err != nil {
 		glog.Error(err)
 		return err
@@ -14,10 +14,13 @@ import (
 func GetDirectorySize(path string) (int64, error) {
 	var size int64
 	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if !info.IsDir() {
 			size += info.Size()
 		}
-		return err
+		return nil
 	})
 	return size, err
 }
@@ -76,11 +79,28 @@ func GetDeletedEntries(d1, d2 Directory) []string {
 }
 
 type DirDiff struct {
-	Image1 string
-	Image2 string
-	Adds   []string
-	Dels   []string
-	Mods   []string
+	Image1       string
+	Image2       string
+	Adds         []string
+	Dels         []string
+	Mods         []string
+	ContentDiffs []FileContentDiff `json:",omitempty"`
+	// Packages groups the changed files by the dpkg or apk package owning them,
+	// and Unmanaged lists the changed files no package owns.
+	Packages  []PackageFiles `json:",omitempty"`
+	Unmanaged *PackageFiles  `json:",omitempty"`
+}
+
+// FileContentDiff describes how the content of a file modified between two images changed.
+type FileContentDiff struct {
+	Path  string
+	Size1 int64
+	Size2 int64
+	// Binary is set when either version of the file is not text, in which case Diff is empty.
+	Binary bool
+	// Skipped explains why Diff is empty for a text file, e.g. because of a size limit.
+	Skipped string `json:",omitempty"`
+	Diff    string `json:",omitempty"`
 }
 
 func compareDirEntries(d1, d2 Directory) DirDiff {
@@ -88,7 +108,12 @@ func compareDirEntries(d1, d2 Directory) DirDiff {
 	dels := GetDeletedEntries(d1, d2)
 	mods := GetModifiedEntries(d1, d2)
 
-	return DirDiff{d1.Root, d2.Root, adds, dels, mods}
+	return DirDiff{Image1: d1.Root, Image2: d2.Root, Adds: adds, Dels: dels, Mods: mods}
+}
+
+// CheckSameFile reports whether two files have the same contents.
+func CheckSameFile(f1name, f2name string) (bool, error) {
+	return checkSameFile(f1name, f2name)
 }
 
 func checkSameFile(f1name, f2name string) (bool, error) {
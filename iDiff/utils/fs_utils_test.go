@@ -115,7 +115,7 @@ func TestCheckSameFile(t *testing.T) {
 				t.Errorf("Expected error but got none")
 			} else {
 				if output != test.expected_output {
-					t.Errorf("\nExpected: %s\nGot: %s\n", test.expected_output, output)
+					t.Errorf("\nExpected: %t\nGot: %t\n", test.expected_output, output)
 				}
 			}
 		}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// HistoryStep is an entry of an image's config history, paired with the layer it created.
+type HistoryStep struct {
+	Created    string
+	CreatedBy  string
+	Comment    string `json:",omitempty"`
+	EmptyLayer bool
+	// Layer identifies the layer the step created, by its diff ID where the config lists one.
+	// It is empty for steps, such as ENV or CMD, which create no layer.
+	Layer string `json:",omitempty"`
+	// Size is the total size in bytes of the files in the step's layer.
+	Size int64
+}
+
+// HistoryStepDiff is a Dockerfile step added, removed or changed between two images.
+type HistoryStepDiff struct {
+	// Change is one of "added", "removed" or "changed".
+	Change string
+	Step1  *HistoryStep `json:",omitempty"`
+	Step2  *HistoryStep `json:",omitempty"`
+	// SizeDelta is the change in bytes the step makes to the size of the image.
+	SizeDelta int64
+}
+
+// Description returns the command of the step, showing both commands when it changed.
+func (d HistoryStepDiff) Description() string {
+	switch {
+	case d.Step1 == nil:
+		return d.Step2.CreatedBy
+	case d.Step2 == nil || d.Step1.CreatedBy == d.Step2.CreatedBy:
+		return d.Step1.CreatedBy
+	default:
+		return fmt.Sprintf("%s -> %s", d.Step1.CreatedBy, d.Step2.CreatedBy)
+	}
+}
+
+type historyConfig struct {
+	History []historyEntry `json:"history"`
+	RootFS  struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+type historyEntry struct {
+	Created    string `json:"created"`
+	CreatedBy  string `json:"created_by"`
+	Comment    string `json:"comment"`
+	EmptyLayer bool   `json:"empty_layer"`
+}
+
+// GetHistorySteps reads the history of an extracted image from its config, pairing each step
+// which is not an empty layer with the next layer listed in the image's manifest.json.
+func GetHistorySteps(imgPath string) ([]HistoryStep, error) {
+	glog.Info("Obtaining image history")
+	steps := []HistoryStep{}
+	if _, err := ioutil.ReadDir(imgPath); err != nil {
+		return steps, err
+	}
+	configPath, err := getConfigPath(imgPath)
+	if err != nil {
+		// Images without a config, such as plain file system tars, have no history.
+		return steps, nil
+	}
+	contents, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return steps, err
+	}
+	var config historyConfig
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return steps, fmt.Errorf("Could not parse config %s: %s", configPath, err)
+	}
+
+	layers := getManifestLayers(imgPath)
+	layer := 0
+	for _, entry := range config.History {
+		step := HistoryStep{
+			Created:    entry.Created,
+			CreatedBy:  entry.CreatedBy,
+			Comment:    entry.Comment,
+			EmptyLayer: entry.EmptyLayer,
+		}
+		if !entry.EmptyLayer {
+			if layer < len(config.RootFS.DiffIDs) {
+				step.Layer = config.RootFS.DiffIDs[layer]
+			} else if layer < len(layers) {
+				step.Layer = filepath.Dir(layers[layer])
+			}
+			if layer < len(layers) {
+				size, err := GetDirectorySize(filepath.Join(imgPath, filepath.Dir(layers[layer]), "layer"))
+				if err != nil {
+					glog.Warningf("Could not get size of layer %s: %s", layers[layer], err)
+				}
+				step.Size = size
+			}
+			layer++
+		}
+		steps = append(steps, step)
+	}
+	if layer != len(layers) {
+		glog.Warningf("Image at %s has %d history steps creating layers but %d layers, step sizes may be incorrect", imgPath, layer, len(layers))
+	}
+	return steps, nil
+}
+
+func getManifestLayers(imgPath string) []string {
+	manifest, err := readManifest(imgPath)
+	if err != nil || len(manifest) == 0 {
+		return nil
+	}
+	return manifest[0].Layers
+}
+
+// GetHistoryStepDiff aligns two histories on their longest common sequence of commands.
+// Unmatched steps between two aligned steps are paired up as changed, with any left over
+// added or removed, and aligned steps whose layers differ are reported as changed.
+func GetHistoryStepDiff(steps1, steps2 []HistoryStep) []HistoryStepDiff {
+	// lcs[i][j] is the length of the longest common sequence of steps1[i:] and steps2[j:].
+	lcs := make([][]int, len(steps1)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(steps2)+1)
+	}
+	for i := len(steps1) - 1; i >= 0; i-- {
+		for j := len(steps2) - 1; j >= 0; j-- {
+			if steps1[i].CreatedBy == steps2[j].CreatedBy {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diffs := []HistoryStepDiff{}
+	dels, adds := []int{}, []int{}
+	flush := func() {
+		for k := 0; k < len(dels) || k < len(adds); k++ {
+			switch {
+			case k >= len(adds):
+				diffs = append(diffs, newStepDiff("removed", &steps1[dels[k]], nil))
+			case k >= len(dels):
+				diffs = append(diffs, newStepDiff("added", nil, &steps2[adds[k]]))
+			default:
+				diffs = append(diffs, newStepDiff("changed", &steps1[dels[k]], &steps2[adds[k]]))
+			}
+		}
+		dels, adds = []int{}, []int{}
+	}
+	i, j := 0, 0
+	for i < len(steps1) || j < len(steps2) {
+		switch {
+		case i < len(steps1) && j < len(steps2) && steps1[i].CreatedBy == steps2[j].CreatedBy:
+			flush()
+			if steps1[i].Layer != steps2[j].Layer || steps1[i].Size != steps2[j].Size {
+				diffs = append(diffs, newStepDiff("changed", &steps1[i], &steps2[j]))
+			}
+			i++
+			j++
+		case j >= len(steps2) || (i < len(steps1) && lcs[i+1][j] >= lcs[i][j+1]):
+			dels = append(dels, i)
+			i++
+		default:
+			adds = append(adds, j)
+			j++
+		}
+	}
+	flush()
+	return diffs
+}
+
+func newStepDiff(change string, step1, step2 *HistoryStep) HistoryStepDiff {
+	diff := HistoryStepDiff{Change: change, Step1: step1, Step2: step2}
+	if step1 != nil {
+		diff.SizeDelta -= step1.Size
+	}
+	if step2 != nil {
+		diff.SizeDelta += step2.Size
+	}
+	return diff
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetHistorySteps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeLayers(t, dir, []map[string]string{
+		{"bin/sh": "shell"},
+		{"app/main.py": "print(1)\n", "app/README": "readme"},
+	})
+	config := `{
+		"history": [
+			{"created": "2017-06-01T00:00:00Z", "created_by": "ADD rootfs.tar /"},
+			{"created": "2017-06-02T00:00:00Z", "created_by": "ENV A=b", "empty_layer": true},
+			{"created": "2017-06-03T00:00:00Z", "created_by": "COPY app /app", "comment": "app"}
+		],
+		"rootfs": {"type": "layers", "diff_ids": ["sha256:aaa", "sha256:bbb"]}
+	}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	steps, err := GetHistorySteps(dir)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := []HistoryStep{
+		{Created: "2017-06-01T00:00:00Z", CreatedBy: "ADD rootfs.tar /", Layer: "sha256:aaa", Size: 5},
+		{Created: "2017-06-02T00:00:00Z", CreatedBy: "ENV A=b", EmptyLayer: true},
+		{Created: "2017-06-03T00:00:00Z", CreatedBy: "COPY app /app", Comment: "app", Layer: "sha256:bbb", Size: 15},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Expected steps: %v but got: %v", expected, steps)
+	}
+}
+
+func TestGetHistoryStepDiff(t *testing.T) {
+	base := HistoryStep{CreatedBy: "ADD rootfs.tar /", Layer: "sha256:base", Size: 100}
+	env := HistoryStep{CreatedBy: "ENV A=b", EmptyLayer: true}
+	apt1 := HistoryStep{CreatedBy: "RUN apt-get install -y curl", Layer: "sha256:apt1", Size: 30}
+	apt2 := HistoryStep{CreatedBy: "RUN apt-get install -y curl wget", Layer: "sha256:apt2", Size: 45}
+	copy1 := HistoryStep{CreatedBy: "COPY app /app", Layer: "sha256:copy1", Size: 10}
+	copy2 := HistoryStep{CreatedBy: "COPY app /app", Layer: "sha256:copy2", Size: 12}
+	user := HistoryStep{CreatedBy: "USER app", EmptyLayer: true}
+
+	for _, test := range []struct {
+		descrip  string
+		steps1   []HistoryStep
+		steps2   []HistoryStep
+		expected []HistoryStepDiff
+	}{
+		{
+			descrip:  "identical",
+			steps1:   []HistoryStep{base, env},
+			steps2:   []HistoryStep{base, env},
+			expected: []HistoryStepDiff{},
+		},
+		{
+			descrip: "changed command, rebuilt layer and added step",
+			steps1:  []HistoryStep{base, apt1, copy1},
+			steps2:  []HistoryStep{base, apt2, copy2, user},
+			expected: []HistoryStepDiff{
+				{Change: "changed", Step1: &apt1, Step2: &apt2, SizeDelta: 15},
+				{Change: "changed", Step1: &copy1, Step2: &copy2, SizeDelta: 2},
+				{Change: "added", Step2: &user},
+			},
+		},
+		{
+			descrip: "removed steps",
+			steps1:  []HistoryStep{base, env, apt1, copy1},
+			steps2:  []HistoryStep{base, copy1},
+			expected: []HistoryStepDiff{
+				{Change: "removed", Step1: &env},
+				{Change: "removed", Step1: &apt1, SizeDelta: -30},
+			},
+		},
+	} {
+		diff := GetHistoryStepDiff(test.steps1, test.steps2)
+		if !reflect.DeepEqual(diff, test.expected) {
+			t.Errorf("%s: Expected: %v but got: %v", test.descrip, test.expected, diff)
+		}
+	}
+}
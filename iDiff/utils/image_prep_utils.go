@@ -1,126 +1,195 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
-	"strings"
 
 	"github.com/golang/glog"
 )
 
 var sourceToPrepMap = map[string]Prepper{
-	"ID":  IDPrepper{},
-	"URL": CloudPrepper{},
-	"tar": TarPrepper{},
-}
-
-var sourceCheckMap = map[string]func(string) bool{
-	"ID":  CheckImageID,
-	"URL": CheckImageURL,
-	"tar": CheckTar,
+	SourceDaemon:    IDPrepper{},
+	SourceRegistry:  CloudPrepper{},
+	SourceTar:       TarPrepper{},
+	SourceOCI:       OCIPrepper{},
+	SourceDir:       DirPrepper{},
+	SourceSBOM:      SBOMPrepper{},
+	SourceContainer: ContainerPrepper{},
 }
 
 type Image struct {
 	Source  string
 	FSPath  string
 	History []string
-	Layers  []string
+	// Steps pairs each entry of the image's config history with the layer it created.
+	Steps  []HistoryStep
+	Layers []string
+	// SBOM lists the packages of an image sourced from a software bill of materials.
+	// Such images have no file system, so only the package differs can be run on them.
+	SBOM []SBOMPackage
 }
 
 type ImagePrepper struct {
 	Source string
+	// WorkDir is the directory the image is saved and extracted under.
+	// The system temp directory is used if it is empty.
+	WorkDir string
+	// Engine selects the Docker Engine client over shelling out to the local docker CLI.
+	Engine bool
+	// Limits bounds the size and number of entries extracted from the image.
+	// DefaultExtractLimits is used for any limit which is not set.
+	Limits ExtractLimits
+	// TarImage selects the image read from a tar saved with several images, by repo tag or ID,
+	// unless the source selects one itself as <tar>#<image>.
+	TarImage string
+	// Platform selects the image pulled from a manifest list or read from an OCI image index,
+	// as os/arch[/variant], and is checked against the platform recorded in the image's config.
+	// The Docker daemon's platform is used, unchecked, if it is empty.
+	Platform string
 }
 
+// Prepper writes the file system of an image to the directory it is given.
 type Prepper interface {
-	ImageToFS() (string, error)
+	ImageToFS(ctx context.Context, dir string) error
+}
+
+// packageLister is implemented by preppers whose sources list an image's packages
+// rather than holding its file system.
+type packageLister interface {
+	listPackages(dir string) ([]SBOMPackage, error)
 }
 
-func (p ImagePrepper) GetImage() (Image, error) {
+// GetImage retrieves the image from its source and extracts it into a new directory under WorkDir.
+// The returned Image's FSPath is owned by the caller, who is responsible for removing it.
+func (p ImagePrepper) GetImage(ctx context.Context) (Image, error) {
 	glog.Infof("Starting prep for image %s", p.Source)
 	img := p.Source
 
-	var prepper Prepper
-	for source, check := range sourceCheckMap {
-		if check(img) {
-			typePrepper := reflect.TypeOf(sourceToPrepMap[source])
-			prepper = reflect.New(typePrepper).Interface().(Prepper)
-			reflect.ValueOf(prepper).Elem().Field(0).Set(reflect.ValueOf(p))
-			break
-		}
+	ref, err := ParseImageSource(img)
+	if err != nil {
+		return Image{}, err
+	}
+	source, ok := sourceToPrepMap[ref.Type]
+	if !ok {
+		return Image{}, fmt.Errorf("Could not retrieve image %s: %s:// sources are not supported", img, ref.Type)
 	}
-	if prepper == nil {
-		return Image{}, errors.New("Could not retrieve image from source")
+	if p.Platform != "" {
+		if ref.Type == SourceRegistry || ref.Type == SourceOCI {
+			// Images of different platforms from the same source are told apart in the output.
+			img = fmt.Sprintf("%s (%s)", img, p.Platform)
+		} else {
+			glog.Warningf("Ignoring platform %s for image %s, which is not pulled from a registry or read from an OCI layout", p.Platform, img)
+		}
 	}
+	// Preppers read the source without its scheme.
+	typed := p
+	typed.Source = ref.Ref
+	prepper := reflect.New(reflect.TypeOf(source)).Interface().(Prepper)
+	reflect.ValueOf(prepper).Elem().Field(0).Set(reflect.ValueOf(typed))
 
-	imgPath, err := prepper.ImageToFS()
+	imgPath, err := ioutil.TempDir(p.WorkDir, "idiff-")
 	if err != nil {
 		return Image{}, err
 	}
+	if err := prepper.ImageToFS(ctx, imgPath); err != nil {
+		os.RemoveAll(imgPath)
+		return Image{}, err
+	}
+	if p.Platform != "" && (ref.Type == SourceRegistry || ref.Type == SourceOCI) {
+		// ImageToFS has already checked that the platform parses.
+		platform, _ := ParsePlatform(p.Platform)
+		if err := checkImagePlatform(imgPath, platform); err != nil {
+			os.RemoveAll(imgPath)
+			return Image{}, fmt.Errorf("Could not retrieve image %s: %s", img, err)
+		}
+	}
+
+	if lister, ok := prepper.(packageLister); ok {
+		packages, err := lister.listPackages(imgPath)
+		if err != nil {
+			os.RemoveAll(imgPath)
+			return Image{}, err
+		}
+		glog.Infof("Finished reading %d packages from SBOM %s", len(packages), p.Source)
+		return Image{
+			Source:  img,
+			FSPath:  imgPath,
+			History: []string{},
+			SBOM:    packages,
+		}, nil
+	}
 
-	history, err := getHistory(imgPath)
+	steps, err := GetHistorySteps(imgPath)
 	if err != nil {
+		os.RemoveAll(imgPath)
 		return Image{}, err
 	}
+	history := []string{}
+	for _, step := range steps {
+		history = append(history, step.CreatedBy)
+	}
 
 	glog.Infof("Finished prepping image %s", p.Source)
 	return Image{
 		Source:  img,
 		FSPath:  imgPath,
 		History: history,
+		Steps:   steps,
 	}, nil
 }
 
-type histJSON struct {
-	History []histLayer `json:"history"`
+// ImageConfig holds the parts of an image's config JSON used by the differs.
+type ImageConfig struct {
+	Config ContainerConfig `json:"config"`
 }
 
-type histLayer struct {
-	Created    string `json:"created"`
-	CreatedBy  string `json:"created_by"`
-	EmptyLayer bool   `json:"empty_layer"`
+// ContainerConfig holds the default settings containers of an image are run with.
+type ContainerConfig struct {
+	User       string   `json:"User"`
+	Env        []string `json:"Env"`
+	Cmd        []string `json:"Cmd"`
+	Entrypoint []string `json:"Entrypoint"`
 }
 
-func getHistory(imgPath string) ([]string, error) {
-	glog.Info("Obtaining image history")
-	histList := []string{}
-	contents, err := ioutil.ReadDir(imgPath)
+// GetImageConfig reads the config JSON of an extracted image, as referenced by its manifest.json.
+func GetImageConfig(imgPath string) (ImageConfig, error) {
+	var config ImageConfig
+	configPath, err := getConfigPath(imgPath)
+	if err != nil {
+		return config, err
+	}
+	contents, err := ioutil.ReadFile(configPath)
 	if err != nil {
-		return histList, err
+		return config, err
 	}
+	err = json.Unmarshal(contents, &config)
+	return config, err
+}
 
+func getConfigPath(imgPath string) (string, error) {
+	if manifest, err := readManifest(imgPath); err == nil && len(manifest) > 0 && manifest[0].Config != "" {
+		return filepath.Join(imgPath, manifest[0].Config), nil
+	}
+	contents, err := ioutil.ReadDir(imgPath)
+	if err != nil {
+		return "", err
+	}
 	for _, item := range contents {
 		if filepath.Ext(item.Name()) == ".json" && item.Name() != "manifest.json" {
-			if len(histList) != 0 {
-				// Another <hash>.json file has already been processed and the history determined is uncertain.
-				glog.Error("Multiple history sources detected for image at " + imgPath + ", history diff may be incorrect.")
-				break
-			}
-			file, err := ioutil.ReadFile(filepath.Join(imgPath, item.Name()))
-			if err != nil {
-				return histList, err
-			}
-			var histJ histJSON
-			json.Unmarshal(file, &histJ)
-			for _, layer := range histJ.History {
-				histList = append(histList, layer.CreatedBy)
-			}
+			return filepath.Join(imgPath, item.Name()), nil
 		}
 	}
-	return histList, nil
+	return "", fmt.Errorf("No config found for image at %s", imgPath)
 }
 
-func getImageFromTar(tarPath string) (string, error) {
+func getImageFromTar(ctx context.Context, tarPath, dir, image string, limits ExtractLimits) error {
 	glog.Info("Extracting image tar to obtain image file system")
-	err := ExtractTar(tarPath)
-	if err != nil {
-		return "", err
-	}
-	path := strings.TrimSuffix(tarPath, filepath.Ext(tarPath))
-	return path, nil
+	return ExtractTarImage(ctx, tarPath, dir, image, limits)
 }
 
 // CloudPrepper prepares images sourced from a Cloud registry
@@ -128,64 +197,100 @@ type CloudPrepper struct {
 	ImagePrepper
 }
 
-func (p CloudPrepper) ImageToFS() (string, error) {
+func (p CloudPrepper) ImageToFS(ctx context.Context, dir string) error {
 	// check client compatibility with Docker API
-	valid, err := ValidDockerVersion()
+	valid, err := ValidDockerVersion(p.Engine)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if p.Platform != "" {
+		if _, err := ParsePlatform(p.Platform); err != nil {
+			return err
+		}
+		if valid {
+			glog.Info("The Docker Engine client cannot pull a platform, shelling out to local Docker client.")
+			valid = false
+		}
+		platformPulls.Lock()
+		defer platformPulls.Unlock()
 	}
 	var tarPath string
 	if !valid {
 		glog.Info("Docker version incompatible with api, shelling out to local Docker client.")
-		imageID, imageName, err := pullImageCmd(p.Source)
+		imageID, _, err := pullImageCmd(ctx, p.Source, p.Platform)
 		if err != nil {
-			return "", err
+			return err
 		}
-		tarPath, err = imageToTarCmd(imageID, imageName)
+		tarPath, err = imageToTarCmd(ctx, imageID, dir)
 	} else {
-		imageID, imageName, err := pullImageFromRepo(p.Source)
+		imageID, _, err := pullImageFromRepo(ctx, p.Source)
 		if err != nil {
-			return "", err
+			return err
 		}
-		tarPath, err = saveImageToTar(imageID, imageName)
+		tarPath, err = saveImageToTar(ctx, imageID, dir)
 	}
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	defer os.Remove(tarPath)
-	return getImageFromTar(tarPath)
+	return getImageFromTar(ctx, tarPath, dir, "", p.Limits)
 }
 
 type IDPrepper struct {
 	ImagePrepper
 }
 
-func (p IDPrepper) ImageToFS() (string, error) {
+func (p IDPrepper) ImageToFS(ctx context.Context, dir string) error {
 	// check client compatibility with Docker API
-	valid, err := ValidDockerVersion()
+	valid, err := ValidDockerVersion(p.Engine)
 	if err != nil {
-		return "", err
+		return err
 	}
 	var tarPath string
 	if !valid {
 		glog.Info("Docker version incompatible with api, shelling out to local Docker client.")
-		tarPath, err = imageToTarCmd(p.Source, p.Source)
+		tarPath, err = imageToTarCmd(ctx, p.Source, dir)
 	} else {
-		tarPath, err = saveImageToTar(p.Source, p.Source)
+		tarPath, err = saveImageToTar(ctx, p.Source, dir)
 	}
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	defer os.Remove(tarPath)
-	return getImageFromTar(tarPath)
+	return getImageFromTar(ctx, tarPath, dir, "", p.Limits)
 }
 
 type TarPrepper struct {
 	ImagePrepper
 }
 
-func (p TarPrepper) ImageToFS() (string, error) {
-	return getImageFromTar(p.Source)
+func (p TarPrepper) ImageToFS(ctx context.Context, dir string) error {
+	tarPath, image := SplitTarSource(p.Source)
+	if image == "" {
+		image = p.TarImage
+	}
+	return getImageFromTar(ctx, tarPath, dir, image, p.Limits)
+}
+
+// SBOMPrepper prepares images from their SPDX or CycloneDX JSON software bill of materials.
+// The document is copied into the image directory, which holds no layers.
+type SBOMPrepper struct {
+	ImagePrepper
+}
+
+const sbomFileName = "sbom.json"
+
+func (p SBOMPrepper) ImageToFS(ctx context.Context, dir string) error {
+	src, err := os.Open(p.Source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return copyToFile(filepath.Join(dir, sbomFileName), src)
+}
+
+func (p SBOMPrepper) listPackages(dir string) ([]SBOMPackage, error) {
+	return ReadSBOM(filepath.Join(dir, sbomFileName))
 }
@@ -6,7 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strings"
 
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/system"
@@ -28,13 +28,13 @@ func GetImageLayers(pathToImage string) []string {
 	return layers
 }
 
-func saveImageToTar(image, dest string) (string, error) {
+func saveImageToTar(ctx context.Context, image, dest string) (string, error) {
 	cli, err := client.NewEnvClient()
 	if err != nil {
 		return "", err
 	}
 
-	imageTarPath, err := ImageToTar(cli, image, dest)
+	imageTarPath, err := ImageToTar(ctx, cli, image, dest)
 	if err != nil {
 		return "", err
 	}
@@ -42,9 +42,9 @@ func saveImageToTar(image, dest string) (string, error) {
 }
 
 // ImageToTar writes an image to a .tar file
-func ImageToTar(cli client.APIClient, image, tarName string) (string, error) {
+func ImageToTar(ctx context.Context, cli client.APIClient, image, tarName string) (string, error) {
 	glog.Info("Saving image")
-	imgBytes, err := cli.ImageSave(context.Background(), []string{image})
+	imgBytes, err := cli.ImageSave(ctx, []string{image})
 	if err != nil {
 		return "", err
 	}
@@ -53,20 +53,15 @@ func ImageToTar(cli client.APIClient, image, tarName string) (string, error) {
 	return newpath, copyToFile(newpath, imgBytes)
 }
 
+// CheckImageID returns whether the image is a short or full image ID.
 func CheckImageID(image string) bool {
-	pattern := regexp.MustCompile("[a-z|0-9]{12}")
-	if exp := pattern.FindString(image); exp != image {
-		return false
-	}
-	return true
+	return imageIDPattern.MatchString(image)
 }
 
+// CheckImageURL returns whether the image, given without a scheme, is pulled from a registry.
 func CheckImageURL(image string) bool {
-	pattern := regexp.MustCompile("^.+/.+(:.+){0,1}$")
-	if exp := pattern.FindString(image); exp != image || CheckTar(image) {
-		return false
-	}
-	return true
+	ref, err := ParseImageSource(image)
+	return err == nil && ref.Type == SourceRegistry && !strings.Contains(image, "://")
 }
 
 // copyToFile writes the content of the reader to the specified file
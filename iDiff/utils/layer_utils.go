@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// ImageFile describes an entry in the merged file system of an image.
+type ImageFile struct {
+	// Path is the absolute path of the entry within the image, e.g. /etc/passwd.
+	Path string
+	// FSPath is where the topmost copy of the entry was extracted to on disk.
+	FSPath string
+	// Layer is the root directory of the layer the topmost copy comes from.
+	Layer string
+	Info  os.FileInfo
+	// Xattrs holds the extended attributes recorded for the entry in its layer tar.
+	Xattrs map[string][]byte
+	// Metadata is the owner and mode recorded for the entry in its layer tar, if they were recorded.
+	Metadata *EntryMetadata
+}
+
+// Mode returns the mode of the entry recorded in its layer tar, or else that of its extracted copy.
+// Extraction can only approximate the modes of directories and devices.
+func (f ImageFile) Mode() os.FileMode {
+	if f.Metadata != nil {
+		return f.Metadata.Mode
+	}
+	return f.Info.Mode()
+}
+
+type manifestJSON struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// name describes the image by its first repo tag, or by its ID for untagged images.
+func (m manifestJSON) name() string {
+	if len(m.RepoTags) > 0 {
+		return m.RepoTags[0]
+	}
+	return m.id()
+}
+
+// id returns the ID of the image, which names its config file.
+func (m manifestJSON) id() string {
+	return strings.TrimSuffix(path.Base(filepath.ToSlash(m.Config)), ".json")
+}
+
+// matches returns whether the image is selected by a repo tag or a prefix of its ID.
+func (m manifestJSON) matches(image string) bool {
+	for _, tag := range m.RepoTags {
+		if normalizeTag(tag) == normalizeTag(image) {
+			return true
+		}
+	}
+	id := strings.TrimPrefix(image, "sha256:")
+	return len(id) >= 12 && strings.HasPrefix(m.id(), id)
+}
+
+// normalizeTag returns the familiar form of a tagged reference, adding the latest tag if none is given.
+func normalizeTag(tag string) string {
+	named, err := reference.ParseNormalizedNamed(tag)
+	if err != nil {
+		return tag
+	}
+	return reference.FamiliarString(reference.TagNameOnly(named))
+}
+
+func readManifest(pathToImage string) ([]manifestJSON, error) {
+	var manifest []manifestJSON
+	contents, err := ioutil.ReadFile(filepath.Join(pathToImage, "manifest.json"))
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(contents, &manifest)
+	return manifest, err
+}
+
+// GetLayerRoots returns the directories holding the file system of each layer of an extracted image,
+// ordered from the base layer up.  The order is taken from manifest.json when the image has one.
+func GetLayerRoots(pathToImage string) []string {
+	roots := []string{}
+	if manifest, err := readManifest(pathToImage); err == nil && len(manifest) > 0 {
+		for _, layer := range manifest[0].Layers {
+			roots = append(roots, filepath.Join(pathToImage, strings.TrimSuffix(layer, filepath.Ext(layer))))
+		}
+		return roots
+	}
+	for _, layer := range GetImageLayers(pathToImage) {
+		root := filepath.Join(pathToImage, layer, "layer")
+		if _, err := os.Stat(root); err == nil {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// GetImageFiles merges the layers of an extracted image, applying whiteouts, and returns the
+// resulting file system entries keyed by their path within the image.
+func GetImageFiles(pathToImage string) (map[string]ImageFile, error) {
+	files := map[string]ImageFile{}
+	for _, root := range GetLayerRoots(pathToImage) {
+		if err := applyLayer(files, root); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// LayerChanges holds what a single layer changes in the file systems of the layers below it.
+type LayerChanges struct {
+	// Files holds the entries stored in the layer, keyed by their path within the image.
+	Files map[string]ImageFile
+	// Whiteouts lists the paths the layer deletes.
+	Whiteouts []string
+	// OpaqueDirs lists the directories whose contents in lower layers the layer hides.
+	OpaqueDirs []string
+}
+
+// GetLayerChanges reads the entries and whiteouts of the layer extracted at root.
+func GetLayerChanges(root string) (LayerChanges, error) {
+	changes := LayerChanges{Files: map[string]ImageFile{}, Whiteouts: []string{}, OpaqueDirs: []string{}}
+	xattrs, err := GetXattrs(root)
+	if err != nil {
+		return changes, err
+	}
+	metadata, err := GetMetadata(root)
+	if err != nil {
+		return changes, err
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		imagePath := "/" + filepath.ToSlash(strings.TrimPrefix(path, root+string(os.PathSeparator)))
+		name := info.Name()
+		switch {
+		case name == opaqueWhiteout:
+			changes.OpaqueDirs = append(changes.OpaqueDirs, filepath.Dir(imagePath))
+		case strings.HasPrefix(name, whiteoutPrefix):
+			changes.Whiteouts = append(changes.Whiteouts, filepath.Join(filepath.Dir(imagePath), strings.TrimPrefix(name, whiteoutPrefix)))
+		default:
+			file := ImageFile{Path: imagePath, FSPath: path, Layer: root, Info: info, Xattrs: xattrs[imagePath]}
+			if entry, ok := metadata[imagePath]; ok {
+				file.Metadata = &entry
+			}
+			changes.Files[imagePath] = file
+		}
+		return nil
+	})
+	return changes, err
+}
+
+func applyLayer(files map[string]ImageFile, root string) error {
+	changes, err := GetLayerChanges(root)
+	if err != nil {
+		return err
+	}
+	for _, dir := range changes.OpaqueDirs {
+		removeTree(files, dir, false)
+	}
+	for _, path := range changes.Whiteouts {
+		removeTree(files, path, true)
+	}
+	for path, file := range changes.Files {
+		files[path] = file
+	}
+	return nil
+}
+
+// removeTree removes everything below dir from files, and dir itself if self is set.
+func removeTree(files map[string]ImageFile, dir string, self bool) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for path := range files {
+		if (self && path == dir) || strings.HasPrefix(path, prefix) {
+			delete(files, path)
+		}
+	}
+}
+
+// SortedImagePaths returns the paths of the given image files in alphabetical order.
+func SortedImagePaths(files map[string]ImageFile) []string {
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// maxSymlinks bounds symlink resolution, as the kernel's MAXSYMLINKS does.
+const maxSymlinks = 40
+
+// ResolveImagePath looks up path in the merged file system of an image, following symlinks
+// in any of its components within the image rather than on the host.
+func ResolveImagePath(files map[string]ImageFile, path string) (ImageFile, bool) {
+	remaining := strings.Split(strings.Trim(filepath.ToSlash(path), "/"), "/")
+	current := "/"
+	for hops := 0; len(remaining) > 0; {
+		component := remaining[0]
+		remaining = remaining[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+		next := filepath.Join(current, component)
+		file, ok := files[next]
+		if !ok {
+			return ImageFile{}, false
+		}
+		if file.Info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+		if hops++; hops > maxSymlinks {
+			return ImageFile{}, false
+		}
+		target, err := os.Readlink(file.FSPath)
+		if err != nil {
+			return ImageFile{}, false
+		}
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		remaining = append(strings.Split(strings.Trim(filepath.ToSlash(target), "/"), "/"), remaining...)
+	}
+	file, ok := files[current]
+	return file, ok
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeLayers lays out an extracted docker save image with the given layers under dir.
+func writeLayers(t *testing.T, dir string, layers []map[string]string) {
+	manifest := `[{"Config": "config.json", "Layers": [`
+	for i, layer := range layers {
+		name := fmt.Sprintf("layer%d/layer.tar", i)
+		if i > 0 {
+			manifest += ", "
+		}
+		manifest += `"` + name + `"`
+		for path, content := range layer {
+			full := filepath.Join(dir, fmt.Sprintf("layer%d", i), "layer", path)
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	manifest += "]}]"
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetImageFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeLayers(t, dir, []map[string]string{
+		{"etc/hosts": "one", "etc/motd": "hello", "opt/app/a": "a", "opt/app/b": "b", "tmp/junk": "junk"},
+		{"etc/hosts": "two", "etc/.wh.motd": "", "opt/app/.wh..wh..opq": "", "opt/app/c": "c", ".wh.tmp": ""},
+	})
+
+	files, err := GetImageFiles(dir)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := []string{"/etc", "/etc/hosts", "/opt", "/opt/app", "/opt/app/c"}
+	if paths := SortedImagePaths(files); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected: %s but got: %s", expected, paths)
+	}
+	if content, _ := ioutil.ReadFile(files["/etc/hosts"].FSPath); string(content) != "two" {
+		t.Errorf("Expected topmost /etc/hosts but got content %q", content)
+	}
+	if layer := files["/etc/hosts"].Layer; layer != filepath.Join(dir, "layer1", "layer") {
+		t.Errorf("Expected /etc/hosts to come from the second layer but got %s", layer)
+	}
+}
+
+func TestResolveImagePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeLayers(t, dir, []map[string]string{{"usr/lib/libc.so.6": "libc", "usr/lib/loop-target": ""}})
+	layer := filepath.Join(dir, "layer0", "layer")
+	os.Symlink("usr/lib", filepath.Join(layer, "lib"))
+	os.Symlink("/lib/libc.so.6", filepath.Join(layer, "usr/lib/libc.so"))
+	os.Symlink("loop", filepath.Join(layer, "usr/lib/loop"))
+
+	files, err := GetImageFiles(dir)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	for _, test := range []struct {
+		path     string
+		expected string
+	}{
+		{path: "/lib/libc.so.6", expected: "/usr/lib/libc.so.6"},
+		{path: "/usr/lib/libc.so", expected: "/usr/lib/libc.so.6"},
+		{path: "/lib/../lib/libc.so.6", expected: "/usr/lib/libc.so.6"},
+		{path: "/usr/lib/missing.so"},
+		{path: "/usr/lib/loop"},
+	} {
+		file, ok := ResolveImagePath(files, test.path)
+		if ok != (test.expected != "") || file.Path != test.expected {
+			t.Errorf("Expected %s to resolve to %q but got %q", test.path, test.expected, file.Path)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// OCIPrepper prepares images from an OCI image layout directory, such as one written by
+// skopeo or buildah.  Each layer blob is verified against its digest as it is extracted.
+type OCIPrepper struct {
+	ImagePrepper
+}
+
+func (p OCIPrepper) ImageToFS(ctx context.Context, dir string) error {
+	platform := defaultPlatform(ctx, p.Engine)
+	if p.Platform != "" {
+		var err error
+		if platform, err = ParsePlatform(p.Platform); err != nil {
+			return err
+		}
+	}
+	manifest, err := resolveOCIManifest(p.Source, platform)
+	if err != nil {
+		return err
+	}
+
+	configPath, err := ociBlobPath(p.Source, manifest.Config.Digest)
+	if err != nil {
+		return err
+	}
+	config, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), config, 0644); err != nil {
+		return err
+	}
+
+	glog.Info("Extracting OCI image layers to obtain image file system")
+	e := newTarExtractor(p.Limits)
+	saved := manifestJSON{Config: "config.json", Layers: []string{}}
+	for _, layer := range manifest.Layers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := extractOCILayer(e, p.Source, layer.Digest, filepath.Join(dir, layer.Digest.Hex(), "layer")); err != nil {
+			return err
+		}
+		saved.Layers = append(saved.Layers, layer.Digest.Hex()+"/layer.tar")
+	}
+
+	// The layers are recorded the way `docker save` lists them, so they are read in order.
+	contents, err := json.Marshal([]manifestJSON{saved})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "manifest.json"), contents, 0644)
+}
+
+// resolveOCIManifest reads the image manifest of an OCI layout, following nested indexes.
+// Indexes listing several manifests are resolved to the one for the given platform.
+func resolveOCIManifest(layout string, platform specs.Platform) (specs.Manifest, error) {
+	var manifest specs.Manifest
+	var index specs.Index
+	if err := readOCIJSON(filepath.Join(layout, "index.json"), &index); err != nil {
+		return manifest, err
+	}
+	for {
+		desc, err := selectOCIManifest(index.Manifests, platform)
+		if err != nil {
+			return manifest, fmt.Errorf("OCI layout %s: %s", layout, err)
+		}
+		path, err := ociBlobPath(layout, desc.Digest)
+		if err != nil {
+			return manifest, err
+		}
+		if desc.MediaType != specs.MediaTypeImageIndex {
+			err := readOCIJSON(path, &manifest)
+			return manifest, err
+		}
+		index = specs.Index{}
+		if err := readOCIJSON(path, &index); err != nil {
+			return manifest, err
+		}
+	}
+}
+
+func selectOCIManifest(manifests []specs.Descriptor, platform specs.Platform) (specs.Descriptor, error) {
+	if len(manifests) == 0 {
+		return specs.Descriptor{}, fmt.Errorf("No image manifests found")
+	}
+	for _, desc := range manifests {
+		if platformMatches(desc.Platform, platform) {
+			return desc, nil
+		}
+	}
+	// Single platform images often do not record their platform in the index.
+	if len(manifests) == 1 && manifests[0].Platform == nil {
+		return manifests[0], nil
+	}
+	return specs.Descriptor{}, fmt.Errorf("No image manifest found for platform %s", formatPlatform(platform))
+}
+
+func readOCIJSON(path string, v interface{}) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(contents, v); err != nil {
+		return fmt.Errorf("Could not parse %s: %s", path, err)
+	}
+	return nil
+}
+
+// ociBlobPath returns where the blob with the given digest is stored in an OCI layout.
+func ociBlobPath(layout string, dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", fmt.Errorf("Invalid digest %q: %s", dgst, err)
+	}
+	return filepath.Join(layout, "blobs", dgst.Algorithm().String(), dgst.Hex()), nil
+}
+
+// extractOCILayer extracts a layer blob, which may be gzipped, into root and checks that the
+// blob matches its digest.
+func extractOCILayer(e *tarExtractor, layout string, dgst digest.Digest, root string) error {
+	path, err := ociBlobPath(layout, dgst)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	verifier := dgst.Verifier()
+	buffered := bufio.NewReader(io.TeeReader(file, verifier))
+	var r io.Reader = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("Layer %s: %s", dgst, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if err := e.untarReader(r, path, root); err != nil {
+		return err
+	}
+	// Read any padding after the end of the tar so the whole blob is verified.
+	if _, err := io.Copy(ioutil.Discard, buffered); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("Layer %s does not match its digest", dgst)
+	}
+	return nil
+}
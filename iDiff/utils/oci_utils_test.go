@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func writeBlob(t *testing.T, layout string, contents []byte) digest.Digest {
+	dgst := digest.FromBytes(contents)
+	dir := filepath.Join(layout, "blobs", "sha256")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Could not create blob dir: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, dgst.Hex()), contents, 0644); err != nil {
+		t.Fatalf("Could not write blob: %s", err)
+	}
+	return dgst
+}
+
+func writeJSONBlob(t *testing.T, layout string, v interface{}) digest.Digest {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Could not marshal blob: %s", err)
+	}
+	return writeBlob(t, layout, contents)
+}
+
+// writeOCILayout writes an OCI layout holding an index which lists a gzipped and an
+// uncompressed layer image, and returns the layer blob digests.
+func writeOCILayout(t *testing.T, layout string) []digest.Digest {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(tarBytes(t, []tarEntry{
+		{name: "etc/", dir: true},
+		{name: "etc/os-release", content: "ID=debian"},
+	}))
+	gz.Close()
+	layers := []digest.Digest{
+		writeBlob(t, layout, gzipped.Bytes()),
+		writeBlob(t, layout, tarBytes(t, []tarEntry{{name: "app", content: "binary"}})),
+	}
+	config := writeBlob(t, layout, []byte(`{"config":{"User":"app"},"history":[{"created_by":"ADD rootfs /"},{"created_by":"COPY app /"}]}`))
+
+	manifest := specs.Manifest{Config: specs.Descriptor{MediaType: specs.MediaTypeImageConfig, Digest: config}}
+	manifest.SchemaVersion = 2
+	manifest.Layers = []specs.Descriptor{
+		{MediaType: specs.MediaTypeImageLayerGzip, Digest: layers[0]},
+		{MediaType: specs.MediaTypeImageLayer, Digest: layers[1]},
+	}
+	nested := specs.Index{Manifests: []specs.Descriptor{{MediaType: specs.MediaTypeImageManifest, Digest: writeJSONBlob(t, layout, manifest)}}}
+	index := specs.Index{Manifests: []specs.Descriptor{{MediaType: specs.MediaTypeImageIndex, Digest: writeJSONBlob(t, layout, nested)}}}
+	contents, _ := json.Marshal(index)
+	ioutil.WriteFile(filepath.Join(layout, "index.json"), contents, 0644)
+	ioutil.WriteFile(filepath.Join(layout, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	return layers
+}
+
+func TestOCIPrepper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	layout := filepath.Join(dir, "layout")
+	layers := writeOCILayout(t, layout)
+
+	image, err := ImagePrepper{Source: "oci://" + layout, WorkDir: dir}.GetImage(context.Background())
+	if err != nil {
+		t.Fatalf("Got unexpected error preparing OCI image: %s", err)
+	}
+	if image.Source != "oci://"+layout {
+		t.Errorf("Expected source to be kept as given but got: %s", image.Source)
+	}
+	expectedHistory := []string{"ADD rootfs /", "COPY app /"}
+	if !reflect.DeepEqual(image.History, expectedHistory) {
+		t.Errorf("Expected history: %v but got: %v", expectedHistory, image.History)
+	}
+	expectedRoots := []string{
+		filepath.Join(image.FSPath, layers[0].Hex(), "layer"),
+		filepath.Join(image.FSPath, layers[1].Hex(), "layer"),
+	}
+	if roots := GetLayerRoots(image.FSPath); !reflect.DeepEqual(roots, expectedRoots) {
+		t.Errorf("Expected layer roots: %v but got: %v", expectedRoots, roots)
+	}
+	files, err := GetImageFiles(image.FSPath)
+	if err != nil {
+		t.Fatalf("Got unexpected error merging layers: %s", err)
+	}
+	for _, path := range []string{"/etc/os-release", "/app"} {
+		if _, ok := files[path]; !ok {
+			t.Errorf("Expected %s in image file system", path)
+		}
+	}
+	if config, err := GetImageConfig(image.FSPath); err != nil || config.Config.User != "app" {
+		t.Errorf("Expected config with user app but got: %v, %v", config, err)
+	}
+
+	// A layer which no longer matches its digest is rejected.
+	ioutil.WriteFile(filepath.Join(layout, "blobs", "sha256", layers[1].Hex()), tarBytes(t, []tarEntry{{name: "app", content: "tampered"}}), 0644)
+	if _, err := (ImagePrepper{Source: layout, WorkDir: dir}).GetImage(context.Background()); err == nil {
+		t.Errorf("Expected error preparing image with a tampered layer but got none")
+	}
+}
+
+// writeMultiArchLayout writes an OCI layout whose index lists a linux/amd64 and a linux/arm64/v8
+// image, each holding the dynamic loader for its architecture.
+func writeMultiArchLayout(t *testing.T, layout string) {
+	index := specs.Index{}
+	for _, platform := range []struct {
+		arch, variant, loader string
+	}{
+		{"amd64", "", "lib/ld-linux-x86-64.so.2"},
+		{"arm64", "v8", "lib/ld-linux-aarch64.so.1"},
+	} {
+		layer := writeBlob(t, layout, tarBytes(t, []tarEntry{{name: "lib/", dir: true}, {name: platform.loader, content: platform.arch}}))
+		config := writeBlob(t, layout, []byte(`{"architecture":"`+platform.arch+`","os":"linux","history":[{"created_by":"ADD rootfs /"}]}`))
+		manifest := specs.Manifest{
+			Config: specs.Descriptor{MediaType: specs.MediaTypeImageConfig, Digest: config},
+			Layers: []specs.Descriptor{{MediaType: specs.MediaTypeImageLayer, Digest: layer}},
+		}
+		manifest.SchemaVersion = 2
+		index.Manifests = append(index.Manifests, specs.Descriptor{
+			MediaType: specs.MediaTypeImageManifest,
+			Digest:    writeJSONBlob(t, layout, manifest),
+			Platform:  &specs.Platform{OS: "linux", Architecture: platform.arch, Variant: platform.variant},
+		})
+	}
+	contents, _ := json.Marshal(index)
+	ioutil.WriteFile(filepath.Join(layout, "index.json"), contents, 0644)
+	ioutil.WriteFile(filepath.Join(layout, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+}
+
+func TestOCIPrepperPlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	layout := filepath.Join(dir, "layout")
+	writeMultiArchLayout(t, layout)
+
+	for _, test := range []struct {
+		platform string
+		loader   string
+	}{
+		{"linux/amd64", "/lib/ld-linux-x86-64.so.2"},
+		{"linux/arm64", "/lib/ld-linux-aarch64.so.1"},
+		{"linux/arm64/v8", "/lib/ld-linux-aarch64.so.1"},
+		{"linux/arm64/v7", ""},
+		{"linux/s390x", ""},
+		{"linux", ""},
+	} {
+		image, err := ImagePrepper{Source: layout, WorkDir: dir, Platform: test.platform}.GetImage(context.Background())
+		if test.loader == "" {
+			if err == nil {
+				t.Errorf("Expected error preparing platform %s but got none", test.platform)
+				os.RemoveAll(image.FSPath)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Got unexpected error preparing platform %s: %s", test.platform, err)
+			continue
+		}
+		if expected := layout + " (" + test.platform + ")"; image.Source != expected {
+			t.Errorf("Expected source %s but got: %s", expected, image.Source)
+		}
+		files, err := GetImageFiles(image.FSPath)
+		if err != nil {
+			t.Errorf("Got unexpected error merging layers: %s", err)
+		} else if _, ok := files[test.loader]; !ok {
+			t.Errorf("Expected %s in the %s image", test.loader, test.platform)
+		}
+		os.RemoveAll(image.FSPath)
+	}
+}
+
+func TestOCIPrepperSingleManifestPlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	layout := filepath.Join(dir, "layout")
+
+	// The index does not record the platform of its only manifest, so it is read from the config.
+	layer := writeBlob(t, layout, tarBytes(t, []tarEntry{{name: "app", content: "binary"}}))
+	config := writeBlob(t, layout, []byte(`{"architecture":"amd64","os":"linux","history":[{"created_by":"ADD rootfs /"}]}`))
+	manifest := specs.Manifest{
+		Config: specs.Descriptor{MediaType: specs.MediaTypeImageConfig, Digest: config},
+		Layers: []specs.Descriptor{{MediaType: specs.MediaTypeImageLayer, Digest: layer}},
+	}
+	manifest.SchemaVersion = 2
+	index := specs.Index{Manifests: []specs.Descriptor{{MediaType: specs.MediaTypeImageManifest, Digest: writeJSONBlob(t, layout, manifest)}}}
+	contents, _ := json.Marshal(index)
+	ioutil.WriteFile(filepath.Join(layout, "index.json"), contents, 0644)
+	ioutil.WriteFile(filepath.Join(layout, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+
+	image, err := ImagePrepper{Source: layout, WorkDir: dir, Platform: "linux/amd64"}.GetImage(context.Background())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	os.RemoveAll(image.FSPath)
+	if image, err := (ImagePrepper{Source: layout, WorkDir: dir, Platform: "linux/arm64"}).GetImage(context.Background()); err == nil {
+		t.Errorf("Expected error preparing an amd64 image for linux/arm64 but got none")
+		os.RemoveAll(image.FSPath)
+	}
+}
@@ -3,6 +3,10 @@ package utils
 type DiffResult interface {
 	GetStruct() DiffResult
 	OutputText(diffType string) error
+	// Summary counts what the differ found changed between the images.
+	Summary() DiffSummary
+	// IsEmpty reports whether the differ found no difference between the images.
+	IsEmpty() bool
 }
 
 type MultiVersionPackageDiffResult struct {
@@ -18,6 +22,24 @@ func (m MultiVersionPackageDiffResult) OutputText(diffType string) error {
 	return TemplateOutput(m)
 }
 
+// Summary counts packages found only in either image, and packages whose installed versions differ.
+func (m MultiVersionPackageDiffResult) Summary() DiffSummary {
+	summary := DiffSummary{
+		Added:     len(m.Diff.Packages2),
+		Removed:   len(m.Diff.Packages1),
+		Changed:   len(m.Diff.InfoDiff),
+		SizeDelta: multiVersionPackageSizes(m.Diff.Packages2) - multiVersionPackageSizes(m.Diff.Packages1),
+	}
+	for _, info := range m.Diff.InfoDiff {
+		summary.SizeDelta += packageListSizes(info.Info2) - packageListSizes(info.Info1)
+	}
+	return summary
+}
+
+func (m MultiVersionPackageDiffResult) IsEmpty() bool {
+	return len(m.Diff.Packages1) == 0 && len(m.Diff.Packages2) == 0 && len(m.Diff.InfoDiff) == 0
+}
+
 type PackageDiffResult struct {
 	DiffType string
 	Diff     PackageDiff
@@ -31,6 +53,24 @@ func (m PackageDiffResult) OutputText(diffType string) error {
 	return TemplateOutput(m)
 }
 
+// Summary counts packages found only in either image, and packages whose version or size differ.
+func (m PackageDiffResult) Summary() DiffSummary {
+	summary := DiffSummary{
+		Added:     len(m.Diff.Packages2),
+		Removed:   len(m.Diff.Packages1),
+		Changed:   len(m.Diff.InfoDiff),
+		SizeDelta: packageSizes(m.Diff.Packages2) - packageSizes(m.Diff.Packages1),
+	}
+	for _, info := range m.Diff.InfoDiff {
+		summary.SizeDelta += info.Info2.Size - info.Info1.Size
+	}
+	return summary
+}
+
+func (m PackageDiffResult) IsEmpty() bool {
+	return len(m.Diff.Packages1) == 0 && len(m.Diff.Packages2) == 0 && len(m.Diff.InfoDiff) == 0
+}
+
 type HistDiffResult struct {
 	DiffType string
 	Diff     HistDiff
@@ -44,6 +84,31 @@ func (m HistDiffResult) OutputText(diffType string) error {
 	return TemplateOutput(m)
 }
 
+// Summary counts the Dockerfile steps added, removed or changed, or the history lines
+// found only in either image if the images' steps are unknown.
+func (m HistDiffResult) Summary() DiffSummary {
+	if m.Diff.Steps == nil {
+		return DiffSummary{Added: len(m.Diff.Adds), Removed: len(m.Diff.Dels)}
+	}
+	summary := DiffSummary{}
+	for _, step := range m.Diff.Steps {
+		switch step.Change {
+		case "added":
+			summary.Added++
+		case "removed":
+			summary.Removed++
+		default:
+			summary.Changed++
+		}
+		summary.SizeDelta += step.SizeDelta
+	}
+	return summary
+}
+
+func (m HistDiffResult) IsEmpty() bool {
+	return len(m.Diff.Adds) == 0 && len(m.Diff.Dels) == 0 && len(m.Diff.Steps) == 0
+}
+
 type DirDiffResult struct {
 	DiffType string
 	Diff     DirDiff
@@ -56,3 +121,214 @@ func (m DirDiffResult) GetStruct() DiffResult {
 func (m DirDiffResult) OutputText(diffType string) error {
 	return TemplateOutput(m)
 }
+
+func (m DirDiffResult) Summary() DiffSummary {
+	return DiffSummary{Added: len(m.Diff.Adds), Removed: len(m.Diff.Dels), Changed: len(m.Diff.Mods)}
+}
+
+func (m DirDiffResult) IsEmpty() bool {
+	return len(m.Diff.Adds) == 0 && len(m.Diff.Dels) == 0 && len(m.Diff.Mods) == 0
+}
+
+type AnalyzeResult interface {
+	GetStruct() AnalyzeResult
+	OutputText(analyzeType string) error
+}
+
+// EfficiencyAnalyzeResult holds the wasted space analysis of an image.
+type EfficiencyAnalyzeResult struct {
+	Image       string
+	AnalyzeType string
+	Analysis    Efficiency
+}
+
+func (r EfficiencyAnalyzeResult) GetStruct() AnalyzeResult {
+	return r
+}
+
+func (r EfficiencyAnalyzeResult) OutputText(analyzeType string) error {
+	return TemplateOutput(r)
+}
+
+// ListAnalyzeResult holds an analysis that is a plain list of entries, such as history lines or files.
+type ListAnalyzeResult struct {
+	Image       string
+	AnalyzeType string
+	Analysis    []string
+}
+
+func (r ListAnalyzeResult) GetStruct() AnalyzeResult {
+	return r
+}
+
+func (r ListAnalyzeResult) OutputText(analyzeType string) error {
+	return TemplateOutput(r)
+}
+
+type PackageAnalyzeResult struct {
+	Image       string
+	AnalyzeType string
+	Analysis    map[string]PackageInfo
+}
+
+func (r PackageAnalyzeResult) GetStruct() AnalyzeResult {
+	return r
+}
+
+func (r PackageAnalyzeResult) OutputText(analyzeType string) error {
+	return TemplateOutput(r)
+}
+
+type MultiVersionPackageAnalyzeResult struct {
+	Image       string
+	AnalyzeType string
+	Analysis    map[string]map[string]PackageInfo
+}
+
+func (r MultiVersionPackageAnalyzeResult) GetStruct() AnalyzeResult {
+	return r
+}
+
+func (r MultiVersionPackageAnalyzeResult) OutputText(analyzeType string) error {
+	return TemplateOutput(r)
+}
+
+type PluginDiffResult struct {
+	DiffType string
+	Diff     PluginDiff
+}
+
+func (m PluginDiffResult) GetStruct() DiffResult {
+	return m
+}
+
+func (m PluginDiffResult) OutputText(diffType string) error {
+	return TemplateOutput(m)
+}
+
+func (m PluginDiffResult) Summary() DiffSummary {
+	return DiffSummary{Added: len(m.Diff.Adds), Removed: len(m.Diff.Dels), Changed: len(m.Diff.Mods)}
+}
+
+func (m PluginDiffResult) IsEmpty() bool {
+	return len(m.Diff.Adds) == 0 && len(m.Diff.Dels) == 0 && len(m.Diff.Mods) == 0
+}
+
+type SecurityDiffResult struct {
+	DiffType string
+	Diff     SecurityDiff
+}
+
+func (m SecurityDiffResult) GetStruct() DiffResult {
+	return m
+}
+
+func (m SecurityDiffResult) OutputText(diffType string) error {
+	return TemplateOutput(m)
+}
+
+// Summary counts each security finding as a change.
+func (m SecurityDiffResult) Summary() DiffSummary {
+	return DiffSummary{Changed: len(m.Diff.Findings)}
+}
+
+func (m SecurityDiffResult) IsEmpty() bool {
+	return len(m.Diff.Findings) == 0
+}
+
+type CertDiffResult struct {
+	DiffType string
+	Diff     CertDiff
+}
+
+func (m CertDiffResult) GetStruct() DiffResult {
+	return m
+}
+
+func (m CertDiffResult) OutputText(diffType string) error {
+	return TemplateOutput(m)
+}
+
+// Summary counts the CA certificates added and removed, and the expired or expiring
+// certificates as changed.
+func (m CertDiffResult) Summary() DiffSummary {
+	return DiffSummary{Added: len(m.Diff.Added), Removed: len(m.Diff.Removed), Changed: len(m.Diff.Expiring)}
+}
+
+// IsEmpty ignores expiring certificates, which are reported whether or not the first image has them.
+func (m CertDiffResult) IsEmpty() bool {
+	return len(m.Diff.Added) == 0 && len(m.Diff.Removed) == 0
+}
+
+type ElfDiffResult struct {
+	DiffType string
+	Diff     ElfDiff
+}
+
+func (m ElfDiffResult) GetStruct() DiffResult {
+	return m
+}
+
+func (m ElfDiffResult) OutputText(diffType string) error {
+	return TemplateOutput(m)
+}
+
+// Summary counts the binaries whose dependencies changed or no longer resolve.
+func (m ElfDiffResult) Summary() DiffSummary {
+	paths := map[string]bool{}
+	for _, change := range m.Diff.Changed {
+		paths[change.Path] = true
+	}
+	for _, unresolved := range m.Diff.Unresolved {
+		paths[unresolved.Path] = true
+	}
+	return DiffSummary{Changed: len(paths)}
+}
+
+func (m ElfDiffResult) IsEmpty() bool {
+	return len(m.Diff.Changed) == 0 && len(m.Diff.Unresolved) == 0
+}
+
+type EfficiencyDiffResult struct {
+	DiffType string
+	Diff     EfficiencyDiff
+}
+
+func (m EfficiencyDiffResult) GetStruct() DiffResult {
+	return m
+}
+
+func (m EfficiencyDiffResult) OutputText(diffType string) error {
+	return TemplateOutput(m)
+}
+
+// Summary reports the change in the total size stored across the images' layers.
+func (m EfficiencyDiffResult) Summary() DiffSummary {
+	return DiffSummary{SizeDelta: m.Diff.Efficiency2.TotalSize - m.Diff.Efficiency1.TotalSize}
+}
+
+// IsEmpty reports whether the images store and waste the same number of bytes across their layers.
+func (m EfficiencyDiffResult) IsEmpty() bool {
+	return m.Diff.Efficiency1.TotalSize == m.Diff.Efficiency2.TotalSize && m.Diff.WastedSizeDelta == 0
+}
+
+type ReproDiffResult struct {
+	DiffType string
+	Diff     ReproDiff
+}
+
+func (m ReproDiffResult) GetStruct() DiffResult {
+	return m
+}
+
+func (m ReproDiffResult) OutputText(diffType string) error {
+	return TemplateOutput(m)
+}
+
+func (m ReproDiffResult) Summary() DiffSummary {
+	return DiffSummary{Changed: len(m.Diff.Files)}
+}
+
+func (m ReproDiffResult) IsEmpty() bool {
+	return len(m.Diff.Files) == 0
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	dpkgInfoDir = "/var/lib/dpkg/info"
+	apkDB       = "/lib/apk/db/installed"
+)
+
+// PackageFiles lists the files added, removed and modified between two images which belong to a package.
+type PackageFiles struct {
+	Package string
+	Adds    []string
+	Dels    []string
+	Mods    []string
+}
+
+// GetPackageOwners maps the paths of the files installed by dpkg or apk in an image to the
+// name of the package owning them. A path listed by several packages, as directories
+// commonly are, is attributed to the first package by name.
+func GetPackageOwners(files map[string]ImageFile) (map[string]string, error) {
+	owners := map[string]string{}
+	for _, p := range SortedImagePaths(files) {
+		if path.Dir(p) != dpkgInfoDir || path.Ext(p) != ".list" {
+			continue
+		}
+		pkg := strings.TrimSuffix(path.Base(p), ".list")
+		// Multi-arch packages are listed as <name>:<arch>.list.
+		pkg = strings.SplitN(pkg, ":", 2)[0]
+		if err := readDpkgList(files[p].FSPath, pkg, owners); err != nil {
+			return owners, err
+		}
+	}
+	if db, ok := files[apkDB]; ok {
+		if err := readApkDB(db.FSPath, owners); err != nil {
+			return owners, err
+		}
+	}
+	return owners, nil
+}
+
+// readDpkgList reads a dpkg info .list file, which lists the path of each file the package installed.
+func readDpkgList(listPath, pkg string, owners map[string]string) error {
+	file, err := os.Open(listPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		addOwner(owners, scanner.Text(), pkg)
+	}
+	return scanner.Err()
+}
+
+// readApkDB reads the apk installed database, in which each package record starts with a
+// P: line naming the package, and its files are listed as R: lines under the preceding F: directory.
+func readApkDB(dbPath string, owners map[string]string) error {
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var pkg, dir string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 || line[1] != ':' {
+			if line == "" {
+				pkg, dir = "", ""
+			}
+			continue
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			pkg = value
+		case 'F':
+			dir = value
+			addOwner(owners, dir, pkg)
+		case 'R':
+			addOwner(owners, path.Join(dir, value), pkg)
+		}
+	}
+	return scanner.Err()
+}
+
+func addOwner(owners map[string]string, p, pkg string) {
+	if p == "" || pkg == "" {
+		return
+	}
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return
+	}
+	if _, ok := owners[p]; !ok {
+		owners[p] = pkg
+	}
+}
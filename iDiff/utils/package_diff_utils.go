@@ -17,6 +17,9 @@ type MultiVersionPackageDiff struct {
 	Image2    string
 	Packages2 map[string]map[string]PackageInfo
 	InfoDiff  []MultiVersionInfo
+	// IntroducedBy maps each package added or changed in Image2, and each of its new versions,
+	// to the history step which created the first layer containing that version.
+	IntroducedBy map[string]map[string]string `json:",omitempty"`
 }
 
 // MultiVersionInfo stores the information for one multi-version package in two different images.
@@ -33,6 +36,9 @@ type PackageDiff struct {
 	Image2    string
 	Packages2 map[string]PackageInfo
 	InfoDiff  []Info
+	// IntroducedBy maps each package added or changed in Image2 to the history step
+	// which created the first layer containing its new version.
+	IntroducedBy map[string]string `json:",omitempty"`
 }
 
 // Info stores the information for one package in two different images.
@@ -45,7 +51,8 @@ type Info struct {
 // PackageInfo stores the specific metadata about a package.
 type PackageInfo struct {
 	Version string
-	Size    string
+	// Size is the installed size of the package in bytes.
+	Size int64
 }
 
 func contains(info1 []PackageInfo, keys1 []string, key string, value PackageInfo) (int, bool) {
@@ -34,46 +34,46 @@ func TestDiffMaps(t *testing.T) {
 		{
 			descrip: "Missing Packages.",
 			map1: map[string]PackageInfo{
-				"pac1": {"1.0", "40"},
-				"pac3": {"3.0", "60"}},
+				"pac1": {"1.0", 40},
+				"pac3": {"3.0", 60}},
 			map2: map[string]PackageInfo{
-				"pac4": {"4.0", "70"},
-				"pac5": {"5.0", "80"}},
+				"pac4": {"4.0", 70},
+				"pac5": {"5.0", 80}},
 			expected: PackageDiff{
 				Packages1: map[string]PackageInfo{
-					"pac1": {"1.0", "40"},
-					"pac3": {"3.0", "60"}},
+					"pac1": {"1.0", 40},
+					"pac3": {"3.0", 60}},
 				Packages2: map[string]PackageInfo{
-					"pac4": {"4.0", "70"},
-					"pac5": {"5.0", "80"}},
+					"pac4": {"4.0", 70},
+					"pac5": {"5.0", 80}},
 				InfoDiff: []Info{}},
 		},
 		{
 			descrip: "Different Versions and Sizes.",
 			map1: map[string]PackageInfo{
-				"pac2": {"2.0", "50"},
-				"pac3": {"3.0", "60"}},
+				"pac2": {"2.0", 50},
+				"pac3": {"3.0", 60}},
 			map2: map[string]PackageInfo{
-				"pac2": {"2.0", "45"},
-				"pac3": {"4.0", "60"}},
+				"pac2": {"2.0", 45},
+				"pac3": {"4.0", 60}},
 			expected: PackageDiff{
 				Packages1: map[string]PackageInfo{},
 				Packages2: map[string]PackageInfo{},
 				InfoDiff: []Info{
-					{"pac2", PackageInfo{"2.0", "50"}, PackageInfo{"2.0", "45"}},
-					{"pac3", PackageInfo{"3.0", "60"}, PackageInfo{"4.0", "60"}}},
+					{"pac2", PackageInfo{"2.0", 50}, PackageInfo{"2.0", 45}},
+					{"pac3", PackageInfo{"3.0", 60}, PackageInfo{"4.0", 60}}},
 			},
 		},
 		{
 			descrip: "Identical packages, versions, and sizes",
 			map1: map[string]PackageInfo{
-				"pac1": {"1.0", "40"},
-				"pac2": {"2.0", "50"},
-				"pac3": {"3.0", "60"}},
+				"pac1": {"1.0", 40},
+				"pac2": {"2.0", 50},
+				"pac3": {"3.0", 60}},
 			map2: map[string]PackageInfo{
-				"pac1": {"1.0", "40"},
-				"pac2": {"2.0", "50"},
-				"pac3": {"3.0", "60"}},
+				"pac1": {"1.0", 40},
+				"pac2": {"2.0", 50},
+				"pac3": {"3.0", 60}},
 			expected: PackageDiff{
 				Packages1: map[string]PackageInfo{},
 				Packages2: map[string]PackageInfo{},
@@ -82,13 +82,13 @@ func TestDiffMaps(t *testing.T) {
 		{
 			descrip: "MultiVersion call with identical Packages in different layers",
 			map1: map[string]map[string]PackageInfo{
-				"pac5": {"img/hash1/globalPath": {"version", "size"}},
-				"pac3": {"img/hash1/notquite/localPath": {"version", "size"}},
-				"pac4": {"img/samePlace": {"version", "size"}}},
+				"pac5": {"img/hash1/globalPath": {"version", 10}},
+				"pac3": {"img/hash1/notquite/localPath": {"version", 10}},
+				"pac4": {"img/samePlace": {"version", 10}}},
 			map2: map[string]map[string]PackageInfo{
-				"pac5": {"img/hash2/globalPath": {"version", "size"}},
-				"pac3": {"img/hash2/notquite/localPath": {"version", "size"}},
-				"pac4": {"img/samePlace": {"version", "size"}}},
+				"pac5": {"img/hash2/globalPath": {"version", 10}},
+				"pac3": {"img/hash2/notquite/localPath": {"version", 10}},
+				"pac4": {"img/samePlace": {"version", 10}}},
 			expected: MultiVersionPackageDiff{
 				Packages1: map[string]map[string]PackageInfo{},
 				Packages2: map[string]map[string]PackageInfo{},
@@ -98,33 +98,33 @@ func TestDiffMaps(t *testing.T) {
 		{
 			descrip: "MultiVersion Packages",
 			map1: map[string]map[string]PackageInfo{
-				"pac5": {"img/onlyImg1": {"version", "size"}},
-				"pac4": {"img/hash1/samePlace": {"version", "size"}},
-				"pac1": {"img/layer1/layer/node_modules/pac1": {"1.0", "40"}},
-				"pac2": {"img/layer1/layer/usr/local/lib/node_modules/pac2": {"2.0", "50"},
-					"img/layer2/layer/usr/local/lib/node_modules/pac2": {"3.0", "50"}}},
+				"pac5": {"img/onlyImg1": {"version", 10}},
+				"pac4": {"img/hash1/samePlace": {"version", 10}},
+				"pac1": {"img/layer1/layer/node_modules/pac1": {"1.0", 40}},
+				"pac2": {"img/layer1/layer/usr/local/lib/node_modules/pac2": {"2.0", 50},
+					"img/layer2/layer/usr/local/lib/node_modules/pac2": {"3.0", 50}}},
 			map2: map[string]map[string]PackageInfo{
-				"pac4": {"img/hash2/samePlace": {"version", "size"}},
-				"pac1": {"img/layer2/layer/node_modules/pac1": {"2.0", "40"}},
-				"pac2": {"img/layer3/layer/usr/local/lib/node_modules/pac2": {"4.0", "50"}},
-				"pac3": {"img/layer2/layer/usr/local/lib/node_modules/pac2": {"5.0", "100"}}},
+				"pac4": {"img/hash2/samePlace": {"version", 10}},
+				"pac1": {"img/layer2/layer/node_modules/pac1": {"2.0", 40}},
+				"pac2": {"img/layer3/layer/usr/local/lib/node_modules/pac2": {"4.0", 50}},
+				"pac3": {"img/layer2/layer/usr/local/lib/node_modules/pac2": {"5.0", 100}}},
 			expected: MultiVersionPackageDiff{
 				Packages1: map[string]map[string]PackageInfo{
-					"pac5": {"img/onlyImg1": {"version", "size"}},
+					"pac5": {"img/onlyImg1": {"version", 10}},
 				},
 				Packages2: map[string]map[string]PackageInfo{
-					"pac3": {"img/layer2/layer/usr/local/lib/node_modules/pac2": {"5.0", "100"}},
+					"pac3": {"img/layer2/layer/usr/local/lib/node_modules/pac2": {"5.0", 100}},
 				},
 				InfoDiff: []MultiVersionInfo{
 					{
 						Package: "pac1",
-						Info1:   []PackageInfo{{"1.0", "40"}},
-						Info2:   []PackageInfo{{"2.0", "40"}},
+						Info1:   []PackageInfo{{"1.0", 40}},
+						Info2:   []PackageInfo{{"2.0", 40}},
 					},
 					{
 						Package: "pac2",
-						Info1:   []PackageInfo{{"2.0", "50"}, {"3.0", "50"}},
-						Info2:   []PackageInfo{{"4.0", "50"}},
+						Info1:   []PackageInfo{{"2.0", 50}, {"3.0", 50}},
+						Info2:   []PackageInfo{{"4.0", 50}},
 					},
 				},
 			},
@@ -141,7 +141,7 @@ func TestDiffMaps(t *testing.T) {
 			sort.Sort(ByPackage(expected.InfoDiff))
 			sort.Sort(ByPackage(actual.InfoDiff))
 			if !reflect.DeepEqual(expected, actual) {
-				t.Errorf("expected Diff to be: %s but got:%s", expected, actual)
+				t.Errorf("expected Diff to be: %v but got:%v", expected, actual)
 				return
 			}
 		case MultiVersionPackageDiff:
@@ -158,7 +158,7 @@ func TestDiffMaps(t *testing.T) {
 				sort.Sort(ByPackageInfo(pack2.Info2))
 			}
 			if !reflect.DeepEqual(expected, actual) {
-				t.Errorf("expected Diff to be: %s but got:%s", expected, actual)
+				t.Errorf("expected Diff to be: %v but got:%v", expected, actual)
 				return
 			}
 		}
@@ -177,37 +177,37 @@ func TestContains(t *testing.T) {
 	}{
 		{
 			descrip:     "Does contain",
-			VersionList: []PackageInfo{{Version: "2", Size: "b"}, {Version: "1", Size: "a"}},
+			VersionList: []PackageInfo{{Version: "2", Size: 2}, {Version: "1", Size: 1}},
 			Layers:      []string{"img/1/global", "img/2/local"},
 			currLayer:   "img/3/local",
-			currVersion: PackageInfo{Version: "1", Size: "a"},
+			currVersion: PackageInfo{Version: "1", Size: 1},
 			index:       1,
 			ok:          true,
 		},
 		{
 			descrip:     "Not contained",
-			VersionList: []PackageInfo{{Version: "1", Size: "a"}, {Version: "2", Size: "b"}},
+			VersionList: []PackageInfo{{Version: "1", Size: 1}, {Version: "2", Size: 2}},
 			Layers:      []string{"img/1/global", "img/2/local"},
 			currLayer:   "img/3/global",
-			currVersion: PackageInfo{Version: "2", Size: "a"},
+			currVersion: PackageInfo{Version: "2", Size: 1},
 			index:       0,
 			ok:          false,
 		},
 		{
 			descrip:     "Does contain but path doesn't match",
-			VersionList: []PackageInfo{{Version: "1", Size: "a"}, {Version: "2", Size: "b"}},
+			VersionList: []PackageInfo{{Version: "1", Size: 1}, {Version: "2", Size: 2}},
 			Layers:      []string{"img/1/local", "img/2/local"},
 			currLayer:   "img/3/global",
-			currVersion: PackageInfo{Version: "1", Size: "a"},
+			currVersion: PackageInfo{Version: "1", Size: 1},
 			index:       0,
 			ok:          false,
 		},
 		{
 			descrip:     "Layers and Versions not of same length",
-			VersionList: []PackageInfo{{Version: "1", Size: "a"}, {Version: "2", Size: "b"}},
+			VersionList: []PackageInfo{{Version: "1", Size: 1}, {Version: "2", Size: 2}},
 			Layers:      []string{"img/1/local"},
 			currLayer:   "img/3/global",
-			currVersion: PackageInfo{Version: "1", Size: "a"},
+			currVersion: PackageInfo{Version: "1", Size: 1},
 			index:       0,
 			ok:          false,
 		},
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/golang/glog"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// platformPulls serialises pulling and saving registry images for a platform.  The daemon tags
+// a pulled image with the reference it was pulled by, so pulling another platform of the same
+// reference before the first has been saved would replace it.
+var platformPulls sync.Mutex
+
+// ParsePlatform parses a platform given as os/arch[/variant], such as linux/arm64/v8.
+func ParsePlatform(platform string) (specs.Platform, error) {
+	parts := strings.Split(strings.ToLower(platform), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return specs.Platform{}, fmt.Errorf("Invalid platform %q, expected os/arch[/variant]", platform)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return specs.Platform{}, fmt.Errorf("Invalid platform %q, expected os/arch[/variant]", platform)
+		}
+	}
+	parsed := specs.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		parsed.Variant = parts[2]
+	}
+	return parsed, nil
+}
+
+// defaultPlatform is the platform the Docker daemon pulls when none is given.  The daemon is
+// asked for its platform if the Docker Engine client is used; otherwise, or if the daemon cannot
+// be reached, the platform iDiff runs on is assumed.
+func defaultPlatform(ctx context.Context, engine bool) specs.Platform {
+	platform := specs.Platform{OS: "linux", Architecture: runtime.GOARCH}
+	if !engine {
+		return platform
+	}
+	cli, err := client.NewEnvClient()
+	if err == nil {
+		var info types.Info
+		if info, err = cli.Info(ctx); err == nil {
+			return daemonPlatform(info)
+		}
+	}
+	glog.Warningf("Could not get the Docker daemon's platform, assuming %s: %s", formatPlatform(platform), err)
+	return platform
+}
+
+// unameArchitectures maps the machine names the daemon reports, as by uname -m, to the
+// architectures and variants images are published for.
+var unameArchitectures = map[string]specs.Platform{
+	"x86_64":  {Architecture: "amd64"},
+	"i386":    {Architecture: "386"},
+	"i686":    {Architecture: "386"},
+	"aarch64": {Architecture: "arm64"},
+	"armv6l":  {Architecture: "arm", Variant: "v6"},
+	"armv7l":  {Architecture: "arm", Variant: "v7"},
+}
+
+// daemonPlatform returns the platform described by the Docker daemon's info.
+func daemonPlatform(info types.Info) specs.Platform {
+	platform := specs.Platform{OS: strings.ToLower(info.OSType), Architecture: strings.ToLower(info.Architecture)}
+	if platform.OS == "" {
+		platform.OS = "linux"
+	}
+	if arch, ok := unameArchitectures[platform.Architecture]; ok {
+		platform.Architecture, platform.Variant = arch.Architecture, arch.Variant
+	}
+	return platform
+}
+
+func formatPlatform(platform specs.Platform) string {
+	if platform.Variant == "" {
+		return platform.OS + "/" + platform.Architecture
+	}
+	return platform.OS + "/" + platform.Architecture + "/" + platform.Variant
+}
+
+// platformMatches returns whether an image built for the given platform runs on the wanted one.
+// Any variant matches if none is wanted.
+func platformMatches(platform *specs.Platform, want specs.Platform) bool {
+	if platform == nil || platform.OS != want.OS || platform.Architecture != want.Architecture {
+		return false
+	}
+	return want.Variant == "" || platform.Variant == want.Variant
+}
+
+// checkImagePlatform checks that the config of the image extracted to imgPath records the wanted
+// platform, as a manifest need not list the platform it was built for.  The variant is only
+// compared if the config records one.
+func checkImagePlatform(imgPath string, want specs.Platform) error {
+	configPath, err := getConfigPath(imgPath)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	var config struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	}
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return fmt.Errorf("Could not parse image config: %s", err)
+	}
+	if config.OS == "" || config.Architecture == "" {
+		return fmt.Errorf("Image config does not record its platform, so it cannot be checked against %s", formatPlatform(want))
+	}
+	platform := specs.Platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}
+	if config.Variant == "" {
+		want.Variant = ""
+	}
+	if !platformMatches(&platform, want) {
+		return fmt.Errorf("Image is built for platform %s, not %s", formatPlatform(platform), formatPlatform(want))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParsePlatform(t *testing.T) {
+	for platform, expected := range map[string]specs.Platform{
+		"linux/amd64":    {OS: "linux", Architecture: "amd64"},
+		"linux/arm64/v8": {OS: "linux", Architecture: "arm64", Variant: "v8"},
+		"Linux/ARM":      {OS: "linux", Architecture: "arm"},
+	} {
+		parsed, err := ParsePlatform(platform)
+		if err != nil {
+			t.Errorf("Got unexpected error parsing %s: %s", platform, err)
+		} else if parsed.OS != expected.OS || parsed.Architecture != expected.Architecture || parsed.Variant != expected.Variant {
+			t.Errorf("Expected %s to parse as %v but got: %v", platform, expected, parsed)
+		}
+	}
+	for _, platform := range []string{"", "linux", "linux/", "/amd64", "linux/arm/v7/extra"} {
+		if _, err := ParsePlatform(platform); err == nil {
+			t.Errorf("Expected error parsing %q but got none", platform)
+		}
+	}
+}
+
+func TestDefaultPlatform(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/info") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"OSType":"linux","Architecture":"armv7l"}`))
+	}))
+	defer server.Close()
+	for key, value := range map[string]string{
+		"DOCKER_HOST":        "tcp://" + strings.TrimPrefix(server.URL, "http://"),
+		"DOCKER_API_VERSION": "1.24",
+		"DOCKER_CERT_PATH":   "",
+	} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+
+	if platform := defaultPlatform(context.Background(), true); formatPlatform(platform) != "linux/arm/v7" {
+		t.Errorf("Expected the daemon's platform linux/arm/v7 but got: %s", formatPlatform(platform))
+	}
+	server.Close()
+	if platform := defaultPlatform(context.Background(), true); platform.OS != "linux" || platform.Architecture == "" {
+		t.Errorf("Expected a fallback platform when the daemon cannot be reached but got: %v", platform)
+	}
+}
+
+func TestCheckImagePlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platform")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`[{"Config":"config.json","Layers":[]}]`), 0644)
+
+	for _, test := range []struct {
+		config   string
+		platform string
+		valid    bool
+	}{
+		{`{"os":"linux","architecture":"amd64"}`, "linux/amd64", true},
+		{`{"os":"linux","architecture":"arm64"}`, "linux/arm64/v8", true},
+		{`{"os":"linux","architecture":"arm","variant":"v7"}`, "linux/arm/v7", true},
+		{`{"os":"linux","architecture":"arm","variant":"v6"}`, "linux/arm/v7", false},
+		{`{"os":"linux","architecture":"amd64"}`, "linux/arm64", false},
+		{`{"os":"windows","architecture":"amd64"}`, "linux/amd64", false},
+		{`{"config":{}}`, "linux/amd64", false},
+	} {
+		ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(test.config), 0644)
+		platform, _ := ParsePlatform(test.platform)
+		err := checkImagePlatform(dir, platform)
+		if test.valid && err != nil {
+			t.Errorf("Got unexpected error checking %s against %s: %s", test.config, test.platform, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("Expected error checking %s against %s but got none", test.config, test.platform)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+// Types of image source, each of which may also be given explicitly as a <type>:// prefix.
+const (
+	// SourceRegistry images are pulled from a registry by reference.
+	SourceRegistry = "docker"
+	// SourceDaemon images are saved from the local Docker daemon by ID or reference.
+	SourceDaemon = "daemon"
+	// SourceTar images are read from a tarball produced by `docker save`.
+	SourceTar = "tar"
+	// SourceOCI images are read from an OCI image layout directory.
+	SourceOCI = "oci"
+	// SourceDir images are read from a plain root file system directory.
+	SourceDir = "dir"
+	// SourceSBOM images are listed by an SPDX or CycloneDX JSON software bill of materials.
+	SourceSBOM = "sbom"
+	// SourceContainer images are the file systems of running or stopped containers.
+	SourceContainer = "container"
+)
+
+var sourceTypes = []string{SourceRegistry, SourceDaemon, SourceTar, SourceOCI, SourceDir, SourceSBOM, SourceContainer}
+
+// ImageReference is an image source classified by where the image is read from.
+type ImageReference struct {
+	Type string
+	// Ref is the source without any scheme: a reference or ID for registry and daemon images,
+	// a path for tar, OCI, dir and SBOM images, and the ID or name of a container.
+	// Tar paths may be followed by #<image> to select one of the images saved in the tar.
+	Ref string
+}
+
+// imageIDPattern matches short and full image IDs, with or without their algorithm.
+var imageIDPattern = regexp.MustCompile(`^(?:sha256:[a-f0-9]{64}|[a-f0-9]{12,64})$`)
+
+// ParseImageSource classifies an image source.  Sources with a scheme, such as docker://ubuntu
+// or tar://image.tar, are read as that type.  Otherwise existing tars, SBOMs and OCI layouts
+// are read from disk, image IDs from the local daemon, and anything else matching the
+// distribution reference grammar, such as ubuntu:16.04 or localhost:5000/app@sha256:..., is pulled.
+func ParseImageSource(source string) (ImageReference, error) {
+	if i := strings.Index(source, "://"); i >= 0 {
+		ref := ImageReference{Type: source[:i], Ref: source[i+len("://"):]}
+		return ref, ref.validate()
+	}
+	switch {
+	case CheckTar(source):
+		return ImageReference{Type: SourceTar, Ref: source}, nil
+	case CheckSBOM(source):
+		return ImageReference{Type: SourceSBOM, Ref: source}, nil
+	case isOCILayout(source):
+		return ImageReference{Type: SourceOCI, Ref: source}, nil
+	case CheckImageID(source):
+		return ImageReference{Type: SourceDaemon, Ref: source}, nil
+	}
+	if _, err := reference.ParseNormalizedNamed(source); err != nil {
+		return ImageReference{}, fmt.Errorf("%s is not an image ID, reference, tar, OCI layout or SBOM: %s", source, err)
+	}
+	return ImageReference{Type: SourceRegistry, Ref: source}, nil
+}
+
+func (r ImageReference) validate() error {
+	if r.Ref == "" {
+		return fmt.Errorf("No image given after %s://", r.Type)
+	}
+	switch r.Type {
+	case SourceRegistry:
+		if _, err := reference.ParseNormalizedNamed(r.Ref); err != nil {
+			return fmt.Errorf("%s is not an image reference: %s", r.Ref, err)
+		}
+	case SourceDaemon:
+		if CheckImageID(r.Ref) {
+			return nil
+		}
+		if _, err := reference.ParseNormalizedNamed(r.Ref); err != nil {
+			return fmt.Errorf("%s is not an image ID or reference: %s", r.Ref, err)
+		}
+	case SourceTar:
+		if path, _ := SplitTarSource(r.Ref); !isFile(path) {
+			return fmt.Errorf("%s is not a file", path)
+		}
+	case SourceSBOM:
+		if !isFile(r.Ref) {
+			return fmt.Errorf("%s is not a file", r.Ref)
+		}
+	case SourceOCI:
+		if !isOCILayout(r.Ref) {
+			return fmt.Errorf("%s is not an OCI image layout", r.Ref)
+		}
+	case SourceDir:
+		if info, err := os.Stat(r.Ref); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", r.Ref)
+		}
+	case SourceContainer:
+	default:
+		return fmt.Errorf("Unknown image source scheme %s://, expected one of %s://", r.Type, strings.Join(sourceTypes, "://, "))
+	}
+	return nil
+}
+
+// CheckImageSource returns whether the source can be classified as an image.
+func CheckImageSource(source string) bool {
+	_, err := ParseImageSource(source)
+	return err == nil
+}
+
+// isOCILayout returns whether the path is an OCI image layout directory.
+func isOCILayout(path string) bool {
+	info, err := os.Stat(filepath.Join(path, "oci-layout"))
+	return err == nil && info.Mode().IsRegular()
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
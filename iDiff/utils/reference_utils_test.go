@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImageSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	tarPath := filepath.Join(dir, "image.tar")
+	layoutPath := filepath.Join(dir, "layout")
+	os.MkdirAll(layoutPath, 0755)
+	ioutil.WriteFile(tarPath, []byte{}, 0644)
+	ioutil.WriteFile(filepath.Join(layoutPath, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+
+	id := strings.Repeat("ab", 32)
+	tests := []struct {
+		source string
+		ref    ImageReference
+	}{
+		{"ubuntu:16.04", ImageReference{SourceRegistry, "ubuntu:16.04"}},
+		{"gcr.io/google-appengine/python", ImageReference{SourceRegistry, "gcr.io/google-appengine/python"}},
+		{"localhost:5000/app", ImageReference{SourceRegistry, "localhost:5000/app"}},
+		{"ubuntu@sha256:" + id, ImageReference{SourceRegistry, "ubuntu@sha256:" + id}},
+		{"sha256:" + id, ImageReference{SourceDaemon, "sha256:" + id}},
+		{id, ImageReference{SourceDaemon, id}},
+		{"123456789012", ImageReference{SourceDaemon, "123456789012"}},
+		{tarPath, ImageReference{SourceTar, tarPath}},
+		{layoutPath, ImageReference{SourceOCI, layoutPath}},
+		{"docker://ubuntu", ImageReference{SourceRegistry, "ubuntu"}},
+		{"daemon://ubuntu:16.04", ImageReference{SourceDaemon, "ubuntu:16.04"}},
+		{"tar://" + tarPath, ImageReference{SourceTar, tarPath}},
+		{tarPath + "#app:1", ImageReference{SourceTar, tarPath + "#app:1"}},
+		{"tar://" + tarPath + "#app:1", ImageReference{SourceTar, tarPath + "#app:1"}},
+		{"oci://" + layoutPath, ImageReference{SourceOCI, layoutPath}},
+		{"dir://" + dir, ImageReference{SourceDir, dir}},
+		{"container://web", ImageReference{SourceContainer, "web"}},
+	}
+	for _, test := range tests {
+		ref, err := ParseImageSource(test.source)
+		if err != nil {
+			t.Errorf("Got unexpected error parsing %s: %s", test.source, err)
+		} else if ref != test.ref {
+			t.Errorf("Expected %s to parse as %v but got: %v", test.source, test.ref, ref)
+		}
+	}
+
+	for _, source := range []string{
+		"badID",
+		"?!badDiffer71",
+		"ftp://ubuntu",
+		"docker://",
+		"docker://Ubuntu",
+		"tar://" + filepath.Join(dir, "missing.tar"),
+		"oci://" + dir,
+		"dir://" + tarPath,
+	} {
+		if ref, err := ParseImageSource(source); err == nil {
+			t.Errorf("Expected error parsing %s but got: %v", source, ref)
+		}
+	}
+}
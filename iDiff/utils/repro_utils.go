@@ -0,0 +1,20 @@
+package utils
+
+// ReproDiff lists the files which differ between two builds of the same image once known
+// sources of non-determinism are normalised away.
+type ReproDiff struct {
+	Image1 string
+	Image2 string
+	Files  []ReproFile
+}
+
+// ReproFile is a file which is not reproducible between two builds.
+type ReproFile struct {
+	Path   string
+	Reason string
+	// Offset is the first byte at which the normalised contents differ, or -1 when not applicable.
+	Offset int64
+	// Hash1 and Hash2 are the SHA-256 hashes of the normalised contents, when they were compared.
+	Hash1 string `json:",omitempty"`
+	Hash2 string `json:",omitempty"`
+}
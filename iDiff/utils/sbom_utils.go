@@ -0,0 +1,578 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SBOM formats supported by NewSBOM.
+const (
+	SPDXJSON      = "spdx-json"
+	CycloneDXJSON = "cyclonedx-json"
+)
+
+// SBOMPackage is a package installed in an image, as listed in a software bill of materials.
+type SBOMPackage struct {
+	Name    string
+	Version string
+	// Type is the package URL type of the package manager which installed it: deb, pypi or npm.
+	Type string
+	// Namespace qualifies the package URL, such as the distribution of a deb package.
+	Namespace string
+	// Licenses holds the package's licenses as declared by the package, all of which apply.
+	// Each is a license name or an expression of names joined by AND and OR, such as
+	// "GPL-1+ OR Artistic".
+	Licenses []string
+}
+
+// PURL returns the package URL identifying the package.
+func (p SBOMPackage) PURL() string {
+	name := escapePURL(p.Name)
+	if p.Type == "npm" && strings.HasPrefix(p.Name, "@") {
+		// Scoped npm packages keep the scope as the namespace.
+		parts := strings.SplitN(p.Name, "/", 2)
+		if len(parts) == 2 {
+			name = escapePURL(parts[0]) + "/" + escapePURL(parts[1])
+		}
+	}
+	if p.Type == "pypi" {
+		name = strings.ToLower(strings.Replace(name, "_", "-", -1))
+	}
+	namespace := ""
+	if p.Namespace != "" {
+		namespace = escapePURL(p.Namespace) + "/"
+	}
+	return fmt.Sprintf("pkg:%s/%s%s@%s", p.Type, namespace, name, escapePURL(p.Version))
+}
+
+func escapePURL(s string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		if ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') || strings.IndexByte("-._~", b) >= 0 {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// ParsePURL parses a package URL into the package it identifies.
+func ParsePURL(purl string) (SBOMPackage, error) {
+	if !strings.HasPrefix(purl, "pkg:") {
+		return SBOMPackage{}, fmt.Errorf("%s is not a package URL", purl)
+	}
+	rest := strings.TrimPrefix(purl, "pkg:")
+	// Qualifiers and subpaths do not identify the package itself.
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	version := ""
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest, version = rest[:i], rest[i+1:]
+	}
+	segments := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(segments) < 2 {
+		return SBOMPackage{}, fmt.Errorf("Package URL %s has no type or name", purl)
+	}
+	for i, segment := range append(segments, version) {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return SBOMPackage{}, fmt.Errorf("Could not parse package URL %s: %s", purl, err)
+		}
+		if i < len(segments) {
+			segments[i] = unescaped
+		} else {
+			version = unescaped
+		}
+	}
+	pkg := SBOMPackage{
+		Type:      strings.ToLower(segments[0]),
+		Namespace: strings.Join(segments[1:len(segments)-1], "/"),
+		Name:      segments[len(segments)-1],
+		Version:   version,
+	}
+	if pkg.Type == "npm" && strings.HasPrefix(pkg.Namespace, "@") {
+		pkg.Name = pkg.Namespace + "/" + pkg.Name
+		pkg.Namespace = ""
+	}
+	return pkg, nil
+}
+
+// sbomInput holds the parts of an SPDX or CycloneDX JSON document read by ReadSBOM.
+type sbomInput struct {
+	SPDXVersion       string                 `json:"spdxVersion"`
+	Packages          []SPDXPackage          `json:"packages"`
+	ExtractedLicenses []SPDXExtractedLicense `json:"hasExtractedLicensingInfos"`
+	BOMFormat         string                 `json:"bomFormat"`
+	Components        []CycloneDXComponent   `json:"components"`
+}
+
+func readSBOMInput(path string) (sbomInput, error) {
+	var doc sbomInput
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return doc, err
+	}
+	if err := json.Unmarshal(contents, &doc); err != nil {
+		return doc, err
+	}
+	if doc.SPDXVersion == "" && doc.BOMFormat != "CycloneDX" {
+		return doc, errors.New("Not an SPDX or CycloneDX JSON document")
+	}
+	return doc, nil
+}
+
+// CheckSBOM returns whether the path is an SPDX or CycloneDX JSON document.
+func CheckSBOM(path string) bool {
+	if filepath.Ext(path) != ".json" {
+		return false
+	}
+	_, err := readSBOMInput(path)
+	return err == nil
+}
+
+// ReadSBOM lists the packages of an SPDX or CycloneDX JSON document.  Packages are identified by
+// their package URLs, and those without one are skipped as no differ could compare them.
+func ReadSBOM(path string) ([]SBOMPackage, error) {
+	doc, err := readSBOMInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read SBOM %s: %s", path, err)
+	}
+	packages := []SBOMPackage{}
+	add := func(name, purl string, licenses []string) {
+		if purl == "" {
+			glog.Warningf("Skipping package %s of SBOM %s, which has no package URL", name, path)
+			return
+		}
+		pkg, err := ParsePURL(purl)
+		if err != nil {
+			glog.Warningf("Skipping package %s of SBOM %s: %s", name, path, err)
+			return
+		}
+		pkg.Licenses = licenses
+		packages = append(packages, pkg)
+	}
+
+	extracted := map[string]string{}
+	for _, license := range doc.ExtractedLicenses {
+		extracted[license.LicenseID] = license.Name
+	}
+	for _, p := range doc.Packages {
+		purl := ""
+		for _, ref := range p.ExternalRefs {
+			if ref.ReferenceType == "purl" {
+				purl = ref.ReferenceLocator
+				break
+			}
+		}
+		add(p.Name, purl, spdxLicenseNames(p.LicenseDeclared, extracted))
+	}
+	for _, c := range doc.Components {
+		licenses := []string{}
+		for _, license := range c.Licenses {
+			if license.Expression != "" {
+				licenses = append(licenses, license.Expression)
+			} else if license.License == nil {
+				continue
+			} else if license.License.ID != "" {
+				licenses = append(licenses, license.License.ID)
+			} else if license.License.Name != "" {
+				licenses = append(licenses, license.License.Name)
+			}
+		}
+		add(c.Name, c.PURL, licenses)
+	}
+	return packages, nil
+}
+
+var spdxLicenseOperator = regexp.MustCompile(`\s+(?:AND|OR|WITH)\s+|[()]`)
+
+// spdxLicenseNames splits an SPDX license expression into its licenses, naming LicenseRef-
+// licenses as the document's extracted licensing information does.
+func spdxLicenseNames(expression string, extracted map[string]string) []string {
+	licenses := []string{}
+	if expression == spdxNoAssertion || expression == "NONE" {
+		return licenses
+	}
+	for _, license := range spdxLicenseOperator.Split(expression, -1) {
+		if license = strings.TrimSpace(license); license == "" {
+			continue
+		}
+		if name, ok := extracted[license]; ok && name != "" {
+			license = name
+		}
+		licenses = append(licenses, license)
+	}
+	return licenses
+}
+
+// CheckSBOMFormat returns an error if format is not a supported SBOM format.
+func CheckSBOMFormat(format string) error {
+	if format != SPDXJSON && format != CycloneDXJSON {
+		return fmt.Errorf("Unknown SBOM format %s, expected %s or %s", format, SPDXJSON, CycloneDXJSON)
+	}
+	return nil
+}
+
+// NewSBOM builds a software bill of materials for the named image in the given format.
+func NewSBOM(format, imageName string, packages []SBOMPackage) (interface{}, error) {
+	if err := CheckSBOMFormat(format); err != nil {
+		return nil, err
+	}
+	sorted := append([]SBOMPackage{}, packages...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].PURL() < sorted[j].PURL()
+	})
+	created := time.Now().UTC()
+	if format == CycloneDXJSON {
+		return newCycloneDXDocument(imageName, sorted, created), nil
+	}
+	return newSPDXDocument(imageName, sorted, created), nil
+}
+
+// SPDXDocument is an SPDX 2.3 document in its JSON serialisation.
+type SPDXDocument struct {
+	SPDXVersion       string                 `json:"spdxVersion"`
+	DataLicense       string                 `json:"dataLicense"`
+	SPDXID            string                 `json:"SPDXID"`
+	Name              string                 `json:"name"`
+	DocumentNamespace string                 `json:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo       `json:"creationInfo"`
+	Packages          []SPDXPackage          `json:"packages"`
+	Relationships     []SPDXRelationship     `json:"relationships"`
+	ExtractedLicenses []SPDXExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+type SPDXCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type SPDXPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []SPDXExternalRef `json:"externalRefs"`
+}
+
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SPDXExtractedLicense declares a license which has no SPDX license identifier.
+type SPDXExtractedLicense struct {
+	LicenseID     string `json:"licenseId"`
+	ExtractedText string `json:"extractedText"`
+	Name          string `json:"name"`
+}
+
+const spdxNoAssertion = "NOASSERTION"
+
+var spdxIDInvalid = regexp.MustCompile("[^A-Za-z0-9.-]+")
+
+func newSPDXDocument(imageName string, packages []SBOMPackage, created time.Time) SPDXDocument {
+	doc := SPDXDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              imageName,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/idiff-%s-%s", spdxIDInvalid.ReplaceAllString(imageName, "-"), newUUID()),
+		CreationInfo: SPDXCreationInfo{
+			Created:  created.Format(time.RFC3339),
+			Creators: []string{"Tool: iDiff"},
+		},
+		Packages:      []SPDXPackage{},
+		Relationships: []SPDXRelationship{},
+	}
+	extracted := map[string]string{}
+	for i, pkg := range packages {
+		id := fmt.Sprintf("SPDXRef-Package-%s-%s-%d", pkg.Type, spdxIDInvalid.ReplaceAllString(pkg.Name, "-"), i)
+		declared := spdxNoAssertion
+		if len(pkg.Licenses) > 0 {
+			declared = spdxLicenseExpression(pkg.Licenses, extracted)
+		}
+		doc.Packages = append(doc.Packages, SPDXPackage{
+			Name:             pkg.Name,
+			SPDXID:           id,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: spdxNoAssertion,
+			FilesAnalyzed:    false,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  declared,
+			CopyrightText:    spdxNoAssertion,
+			ExternalRefs: []SPDXExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  pkg.PURL(),
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, SPDXRelationship{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: id,
+		})
+	}
+	licenseIDs := []string{}
+	for id := range extracted {
+		licenseIDs = append(licenseIDs, id)
+	}
+	sort.Strings(licenseIDs)
+	for _, id := range licenseIDs {
+		doc.ExtractedLicenses = append(doc.ExtractedLicenses, SPDXExtractedLicense{
+			LicenseID:     id,
+			ExtractedText: "The license named " + extracted[id] + " by the package",
+			Name:          extracted[id],
+		})
+	}
+	return doc
+}
+
+// spdxLicenses maps the lower case names packages commonly declare to SPDX license identifiers.
+var spdxLicenses = map[string]string{
+	"apache-2.0":     "Apache-2.0",
+	"apache 2.0":     "Apache-2.0",
+	"apache2":        "Apache-2.0",
+	"artistic":       "Artistic-1.0-Perl",
+	"artistic-2.0":   "Artistic-2.0",
+	"bsd-2-clause":   "BSD-2-Clause",
+	"bsd-3-clause":   "BSD-3-Clause",
+	"bsd":            "BSD-3-Clause",
+	"cc0-1.0":        "CC0-1.0",
+	"expat":          "MIT",
+	"gpl-1":          "GPL-1.0-only",
+	"gpl-1+":         "GPL-1.0-or-later",
+	"gpl-2":          "GPL-2.0-only",
+	"gpl-2.0":        "GPL-2.0-only",
+	"gpl-2+":         "GPL-2.0-or-later",
+	"gpl-2.0+":       "GPL-2.0-or-later",
+	"gpl-3":          "GPL-3.0-only",
+	"gpl-3.0":        "GPL-3.0-only",
+	"gpl-3+":         "GPL-3.0-or-later",
+	"gpl-3.0+":       "GPL-3.0-or-later",
+	"isc":            "ISC",
+	"lgpl-2":         "LGPL-2.0-only",
+	"lgpl-2+":        "LGPL-2.0-or-later",
+	"lgpl-2.1":       "LGPL-2.1-only",
+	"lgpl-2.1+":      "LGPL-2.1-or-later",
+	"lgpl-3":         "LGPL-3.0-only",
+	"lgpl-3+":        "LGPL-3.0-or-later",
+	"lgpl-3.0+":      "LGPL-3.0-or-later",
+	"mit":            "MIT",
+	"mpl-1.1":        "MPL-1.1",
+	"mpl-2.0":        "MPL-2.0",
+	"psf":            "PSF-2.0",
+	"python-2.0":     "Python-2.0",
+	"unlicense":      "Unlicense",
+	"zlib":           "Zlib",
+	"zlib/libpng":    "Zlib",
+	"0bsd":           "0BSD",
+	"bsl-1.0":        "BSL-1.0",
+	"openssl":        "OpenSSL",
+	"wtfpl":          "WTFPL",
+	"curl":           "curl",
+	"mit/x11":        "MIT",
+	"x11":            "X11",
+	"epl-1.0":        "EPL-1.0",
+	"epl-2.0":        "EPL-2.0",
+	"cddl-1.0":       "CDDL-1.0",
+	"agpl-3":         "AGPL-3.0-only",
+	"agpl-3+":        "AGPL-3.0-or-later",
+	"gfdl-1.2+":      "GFDL-1.2-or-later",
+	"gfdl-1.3+":      "GFDL-1.3-or-later",
+	"ofl-1.1":        "OFL-1.1",
+	"python":         "Python-2.0",
+	"bsd-4-clause":   "BSD-4-Clause",
+	"apache license": "Apache-2.0",
+	"mit license":    "MIT",
+}
+
+// SPDXLicenseID returns the SPDX license identifier for a license name declared by a package,
+// and whether one is known.  Unknown licenses are given a LicenseRef- identifier, made from a
+// hash of the name if it has no characters an identifier may hold.
+func SPDXLicenseID(name string) (string, bool) {
+	if id, ok := spdxLicenses[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return id, true
+	}
+	ref := strings.Trim(spdxIDInvalid.ReplaceAllString(name, "-"), "-")
+	if ref == "" {
+		ref = fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[:16]
+	}
+	return "LicenseRef-" + ref, false
+}
+
+var licenseExpressionToken = regexp.MustCompile(`\s+(?:AND|OR)\s+|[()]`)
+
+// GroupLicenseExpression parenthesises a license expression joining several licenses, so that
+// it can be joined with others.
+func GroupLicenseExpression(expression string) string {
+	if licenseExpressionToken.MatchString(expression) {
+		return "(" + expression + ")"
+	}
+	return expression
+}
+
+func hasLicenseExpression(licenses []string) bool {
+	for _, license := range licenses {
+		if licenseExpressionToken.MatchString(license) {
+			return true
+		}
+	}
+	return false
+}
+
+// spdxLicenseExpression returns the SPDX license expression declaring all of a package's
+// licenses.  Licenses without an SPDX license identifier are added to extracted.
+func spdxLicenseExpression(licenses []string, extracted map[string]string) string {
+	expressions := []string{}
+	for _, license := range licenses {
+		expression := spdxLicenseIDs(license, extracted)
+		if len(licenses) > 1 {
+			expression = GroupLicenseExpression(expression)
+		}
+		expressions = append(expressions, expression)
+	}
+	return strings.Join(expressions, " AND ")
+}
+
+// spdxLicenseIDs replaces each license name of an expression with its SPDX license identifier,
+// keeping the expression's operators and parentheses.
+func spdxLicenseIDs(expression string, extracted map[string]string) string {
+	ids := ""
+	addLicense := func(name string) {
+		if name = strings.TrimSpace(name); name == "" {
+			return
+		}
+		id, known := SPDXLicenseID(name)
+		if !known {
+			extracted[id] = name
+		}
+		ids += id
+	}
+	last := 0
+	for _, token := range licenseExpressionToken.FindAllStringIndex(expression, -1) {
+		addLicense(expression[last:token[0]])
+		if operator := strings.TrimSpace(expression[token[0]:token[1]]); operator == "(" || operator == ")" {
+			ids += operator
+		} else {
+			ids += " " + operator + " "
+		}
+		last = token[1]
+	}
+	addLicense(expression[last:])
+	return ids
+}
+
+// CycloneDXDocument is a CycloneDX 1.5 bill of materials in its JSON serialisation.
+type CycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     CycloneDXMetadata    `json:"metadata"`
+	Components   []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []CycloneDXTool    `json:"tools"`
+	Component CycloneDXComponent `json:"component"`
+}
+
+type CycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type CycloneDXComponent struct {
+	Type     string             `json:"type"`
+	BOMRef   string             `json:"bom-ref,omitempty"`
+	Name     string             `json:"name"`
+	Version  string             `json:"version,omitempty"`
+	PURL     string             `json:"purl,omitempty"`
+	Licenses []CycloneDXLicense `json:"licenses,omitempty"`
+}
+
+// CycloneDXLicense holds either a license or an SPDX license expression.
+type CycloneDXLicense struct {
+	License    *CycloneDXLicenseChoice `json:"license,omitempty"`
+	Expression string                  `json:"expression,omitempty"`
+}
+
+// CycloneDXLicenseChoice holds either the SPDX identifier or the name of a license.
+type CycloneDXLicenseChoice struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func newCycloneDXDocument(imageName string, packages []SBOMPackage, created time.Time) CycloneDXDocument {
+	doc := CycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: CycloneDXMetadata{
+			Timestamp: created.Format(time.RFC3339),
+			Tools:     []CycloneDXTool{{Name: "iDiff"}},
+			Component: CycloneDXComponent{Type: "container", Name: imageName},
+		},
+		Components: []CycloneDXComponent{},
+	}
+	seen := map[string]bool{}
+	for _, pkg := range packages {
+		purl := pkg.PURL()
+		if seen[purl] {
+			// bom-refs must be unique, and the same package may be installed at several paths.
+			continue
+		}
+		seen[purl] = true
+		component := CycloneDXComponent{Type: "library", BOMRef: purl, Name: pkg.Name, Version: pkg.Version, PURL: purl}
+		if hasLicenseExpression(pkg.Licenses) {
+			// A component's licenses are either listed or given as a single expression.
+			component.Licenses = []CycloneDXLicense{{Expression: spdxLicenseExpression(pkg.Licenses, map[string]string{})}}
+		} else {
+			for _, license := range pkg.Licenses {
+				if id, known := SPDXLicenseID(license); known {
+					component.Licenses = append(component.Licenses, CycloneDXLicense{License: &CycloneDXLicenseChoice{ID: id}})
+				} else {
+					component.Licenses = append(component.Licenses, CycloneDXLicense{License: &CycloneDXLicenseChoice{Name: license}})
+				}
+			}
+		}
+		doc.Components = append(doc.Components, component)
+	}
+	return doc
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
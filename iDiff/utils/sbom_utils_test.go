@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPURL(t *testing.T) {
+	for _, test := range []struct {
+		pkg      SBOMPackage
+		expected string
+	}{
+		{SBOMPackage{Name: "zlib1g", Version: "1:1.2.8.dfsg-5", Type: "deb", Namespace: "debian"}, "pkg:deb/debian/zlib1g@1%3A1.2.8.dfsg-5"},
+		{SBOMPackage{Name: "libc6", Version: "2.24-11+deb9u1", Type: "deb", Namespace: "debian"}, "pkg:deb/debian/libc6@2.24-11%2Bdeb9u1"},
+		{SBOMPackage{Name: "Flask_Login", Version: "0.4.0", Type: "pypi"}, "pkg:pypi/flask-login@0.4.0"},
+		{SBOMPackage{Name: "@babel/core", Version: "7.0.0", Type: "npm"}, "pkg:npm/%40babel/core@7.0.0"},
+	} {
+		if purl := test.pkg.PURL(); purl != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, purl)
+		}
+	}
+}
+
+func TestSPDXLicenseID(t *testing.T) {
+	if id, known := SPDXLicenseID("GPL-2+"); id != "GPL-2.0-or-later" || !known {
+		t.Errorf("Expected known GPL-2.0-or-later but got %s, %t", id, known)
+	}
+	if id, known := SPDXLicenseID("public domain"); id != "LicenseRef-public-domain" || known {
+		t.Errorf("Expected unknown LicenseRef-public-domain but got %s, %t", id, known)
+	}
+	if id, known := SPDXLicenseID("???"); id == "LicenseRef-" || known {
+		t.Errorf("Expected an unknown LicenseRef- identifier for a name without valid characters but got %s, %t", id, known)
+	}
+}
+
+func TestLicenseExpressions(t *testing.T) {
+	perl := []SBOMPackage{{Name: "perl", Version: "5.24.1", Type: "deb", Namespace: "debian", Licenses: []string{"BSD", "GPL-1+ OR Artistic", "(GPL-2+ OR custom) AND zlib"}}}
+	expected := "BSD-3-Clause AND (GPL-1.0-or-later OR Artistic-1.0-Perl) AND ((GPL-2.0-or-later OR LicenseRef-custom) AND Zlib)"
+
+	sbom, _ := NewSBOM(SPDXJSON, "image", perl)
+	doc := sbom.(SPDXDocument)
+	if declared := doc.Packages[0].LicenseDeclared; declared != expected {
+		t.Errorf("Expected license %q but got %q", expected, declared)
+	}
+	if len(doc.ExtractedLicenses) != 1 || doc.ExtractedLicenses[0].LicenseID != "LicenseRef-custom" {
+		t.Errorf("Expected LicenseRef-custom to be extracted but got: %v", doc.ExtractedLicenses)
+	}
+
+	sbom, _ = NewSBOM(CycloneDXJSON, "image", perl)
+	expectedLicenses := []CycloneDXLicense{{Expression: expected}}
+	if licenses := sbom.(CycloneDXDocument).Components[0].Licenses; !reflect.DeepEqual(licenses, expectedLicenses) {
+		t.Errorf("Expected: %v but got: %v", expectedLicenses, licenses)
+	}
+}
+
+var sbomPackages = []SBOMPackage{
+	{Name: "six", Version: "1.10.0", Type: "pypi", Licenses: []string{"MIT"}},
+	{Name: "libc6", Version: "2.24", Type: "deb", Namespace: "debian", Licenses: []string{"LGPL-2.1+", "public domain"}},
+	{Name: "left-pad", Version: "1.1.3", Type: "npm"},
+	{Name: "left-pad", Version: "1.1.3", Type: "npm"},
+}
+
+func TestNewSPDX(t *testing.T) {
+	sbom, err := NewSBOM(SPDXJSON, "gcr.io/test/image:latest", sbomPackages)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	doc := sbom.(SPDXDocument)
+	if doc.SPDXVersion != "SPDX-2.3" || doc.DataLicense != "CC0-1.0" || !strings.HasPrefix(doc.DocumentNamespace, "https://spdx.org/spdxdocs/idiff-gcr.io-test-image-latest-") {
+		t.Errorf("Unexpected document header: %v", doc)
+	}
+	if len(doc.Packages) != 4 || len(doc.Relationships) != 4 {
+		t.Fatalf("Expected 4 packages and relationships but got %d and %d", len(doc.Packages), len(doc.Relationships))
+	}
+	libc := doc.Packages[0]
+	if libc.Name != "libc6" || libc.LicenseDeclared != "LGPL-2.1-or-later AND LicenseRef-public-domain" || libc.ExternalRefs[0].ReferenceLocator != "pkg:deb/debian/libc6@2.24" {
+		t.Errorf("Unexpected package: %v", libc)
+	}
+	if leftPad := doc.Packages[1]; leftPad.LicenseDeclared != "NOASSERTION" || leftPad.SPDXID == doc.Packages[2].SPDXID {
+		t.Errorf("Expected unique SPDX IDs and no license assertion but got %v and %v", leftPad, doc.Packages[2])
+	}
+	expectedExtracted := []SPDXExtractedLicense{{LicenseID: "LicenseRef-public-domain", ExtractedText: "The license named public domain by the package", Name: "public domain"}}
+	if !reflect.DeepEqual(doc.ExtractedLicenses, expectedExtracted) {
+		t.Errorf("Expected: %v but got: %v", expectedExtracted, doc.ExtractedLicenses)
+	}
+}
+
+func TestNewCycloneDX(t *testing.T) {
+	sbom, err := NewSBOM(CycloneDXJSON, "image", sbomPackages)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	doc := sbom.(CycloneDXDocument)
+	if doc.BOMFormat != "CycloneDX" || doc.SpecVersion != "1.5" || !strings.HasPrefix(doc.SerialNumber, "urn:uuid:") || len(doc.SerialNumber) != 45 {
+		t.Errorf("Unexpected document header: %v", doc)
+	}
+	if len(doc.Components) != 3 {
+		t.Fatalf("Expected duplicate components to be merged but got: %v", doc.Components)
+	}
+	expectedLicenses := []CycloneDXLicense{{License: &CycloneDXLicenseChoice{ID: "LGPL-2.1-or-later"}}, {License: &CycloneDXLicenseChoice{Name: "public domain"}}}
+	if libc := doc.Components[0]; libc.PURL != "pkg:deb/debian/libc6@2.24" || libc.BOMRef != libc.PURL || !reflect.DeepEqual(libc.Licenses, expectedLicenses) {
+		t.Errorf("Unexpected component: %v", libc)
+	}
+
+	if _, err := NewSBOM("yaml", "image", sbomPackages); err == nil {
+		t.Errorf("Expected error for unknown format but got none")
+	}
+}
+
+func TestParsePURL(t *testing.T) {
+	for _, pkg := range []SBOMPackage{
+		{Name: "libc6", Version: "2.24-11+deb9u1", Type: "deb", Namespace: "debian"},
+		{Name: "@babel/core", Version: "7.0.0", Type: "npm"},
+		{Name: "six", Version: "1.10.0", Type: "pypi"},
+	} {
+		parsed, err := ParsePURL(pkg.PURL())
+		if err != nil {
+			t.Errorf("Got unexpected error parsing %s: %s", pkg.PURL(), err)
+		} else if !reflect.DeepEqual(parsed, pkg) {
+			t.Errorf("Expected: %v but got: %v", pkg, parsed)
+		}
+	}
+	if pkg, err := ParsePURL("pkg:deb/debian/curl@7.52.1?arch=amd64#usr/bin"); err != nil || pkg.Version != "7.52.1" || pkg.Name != "curl" {
+		t.Errorf("Expected qualifiers and subpath to be dropped but got: %v, %v", pkg, err)
+	}
+	if _, err := ParsePURL("deb/debian/curl@7.52.1"); err == nil {
+		t.Errorf("Expected error for URL without pkg scheme but got none")
+	}
+}
+
+func TestReadSBOM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sbom")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	packages := []SBOMPackage{
+		{Name: "libc6", Version: "2.24", Type: "deb", Namespace: "debian", Licenses: []string{"LGPL-2.1-or-later", "public domain"}},
+		{Name: "six", Version: "1.10.0", Type: "pypi", Licenses: []string{}},
+	}
+	for _, format := range []string{SPDXJSON, CycloneDXJSON} {
+		doc, _ := NewSBOM(format, "image", packages)
+		contents, _ := json.Marshal(doc)
+		path := filepath.Join(dir, format+".json")
+		ioutil.WriteFile(path, contents, 0644)
+
+		if !CheckSBOM(path) {
+			t.Errorf("Expected %s to be recognised as an SBOM", path)
+		}
+		read, err := ReadSBOM(path)
+		if err != nil {
+			t.Errorf("Got unexpected error reading %s: %s", format, err)
+		} else if !reflect.DeepEqual(read, packages) {
+			t.Errorf("Expected %s packages: %v but got: %v", format, packages, read)
+		}
+	}
+
+	other := filepath.Join(dir, "package.json")
+	ioutil.WriteFile(other, []byte(`{"name": "left-pad"}`), 0644)
+	if CheckSBOM(other) {
+		t.Errorf("Expected %s not to be recognised as an SBOM", other)
+	}
+}
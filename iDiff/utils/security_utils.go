@@ -0,0 +1,25 @@
+package utils
+
+// Severities of security findings, from most to least important.
+const (
+	SeverityHigh   = "HIGH"
+	SeverityMedium = "MEDIUM"
+	SeverityLow    = "LOW"
+)
+
+// SecurityDiff stores the security relevant changes found between two images.
+type SecurityDiff struct {
+	Image1   string
+	Image2   string
+	Findings []SecurityFinding
+}
+
+// SecurityFinding describes a single change a reviewer should look at.
+type SecurityFinding struct {
+	Severity string
+	// Category groups findings, e.g. setuid, world-writable, user, group, sudoers, capability or default-user.
+	Category string
+	// Subject is what the finding is about, such as a path or a user name.
+	Subject     string
+	Description string
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// SeriesReport summarises how a series of images evolved, built from the diffs of each consecutive pair.
+type SeriesReport struct {
+	Images         []SeriesImage
+	PackageChanges []PackageChange
+	HistoryChanges []HistoryChange
+	Failures       []SeriesFailure
+}
+
+// SeriesImage stores an image of the series and the total size of its layers in bytes.
+type SeriesImage struct {
+	Image string
+	Size  int64
+	// Error is why the image could not be prepared, if it could not.
+	Error string `json:",omitempty"`
+}
+
+// SeriesFailure records a consecutive pair of images of the series which could not be diffed.
+type SeriesFailure struct {
+	// Index is the position in the series of the second image of the pair.
+	Index  int
+	Image1 string
+	Image2 string
+	Error  string
+}
+
+// PackageChange records a package being added, removed or changing version at an image of the series.
+type PackageChange struct {
+	// Index is the position in the series of the image the change first appears in.
+	Index    int
+	Image    string
+	DiffType string
+	Package  string
+	// Change is one of "added", "removed" or "changed".
+	Change string
+	From   string
+	To     string
+}
+
+// HistoryChange records the Dockerfile history lines added and removed at an image of the series.
+type HistoryChange struct {
+	Index int
+	Image string
+	Adds  []string
+	Dels  []string
+}
+
+// GetImageSize returns the total size in bytes of the layers of an extracted image.
+func GetImageSize(pathToImage string) int64 {
+	var size int64
+	for _, root := range GetLayerRoots(pathToImage) {
+		layerSize, err := GetDirectorySize(root)
+		if err != nil {
+			glog.Warningf("Could not get size of layer %s: %s", root, err)
+		}
+		size += layerSize
+	}
+	return size
+}
+
+// GetSeriesReport builds the report for a series of images from the diffs of each consecutive pair,
+// where diffs[i] holds the results for images[i] and images[i+1], and the pairs which failed.
+func GetSeriesReport(images []SeriesImage, diffs []map[string]DiffResult, failures []SeriesFailure) SeriesReport {
+	report := SeriesReport{
+		Images:         append([]SeriesImage{}, images...),
+		PackageChanges: []PackageChange{},
+		HistoryChanges: []HistoryChange{},
+		Failures:       append([]SeriesFailure{}, failures...),
+	}
+
+	for i, results := range diffs {
+		index := i + 1
+		image := images[index].Image
+		diffTypes := []string{}
+		for diffType := range results {
+			diffTypes = append(diffTypes, diffType)
+		}
+		sort.Strings(diffTypes)
+
+		for _, diffType := range diffTypes {
+			changes := []PackageChange{}
+			switch result := results[diffType].(type) {
+			case *PackageDiffResult:
+				changes = getPackageChanges(result.Diff)
+			case *MultiVersionPackageDiffResult:
+				changes = getMultiVersionPackageChanges(result.Diff)
+			case *HistDiffResult:
+				if len(result.Diff.Adds) > 0 || len(result.Diff.Dels) > 0 {
+					report.HistoryChanges = append(report.HistoryChanges, HistoryChange{
+						Index: index, Image: image, Adds: result.Diff.Adds, Dels: result.Diff.Dels})
+				}
+			}
+			for _, change := range changes {
+				change.Index = index
+				change.Image = image
+				change.DiffType = diffType
+				report.PackageChanges = append(report.PackageChanges, change)
+			}
+		}
+	}
+	return report
+}
+
+func getPackageChanges(diff PackageDiff) []PackageChange {
+	changes := []PackageChange{}
+	for name, info := range diff.Packages1 {
+		changes = append(changes, PackageChange{Package: name, Change: "removed", From: info.Version})
+	}
+	for name, info := range diff.Packages2 {
+		changes = append(changes, PackageChange{Package: name, Change: "added", To: info.Version})
+	}
+	for _, info := range diff.InfoDiff {
+		if info.Info1.Version != info.Info2.Version {
+			changes = append(changes, PackageChange{Package: info.Package, Change: "changed",
+				From: info.Info1.Version, To: info.Info2.Version})
+		}
+	}
+	sortPackageChanges(changes)
+	return changes
+}
+
+func getMultiVersionPackageChanges(diff MultiVersionPackageDiff) []PackageChange {
+	changes := []PackageChange{}
+	for name, infos := range diff.Packages1 {
+		changes = append(changes, PackageChange{Package: name, Change: "removed", From: joinVersions(mapInfos(infos))})
+	}
+	for name, infos := range diff.Packages2 {
+		changes = append(changes, PackageChange{Package: name, Change: "added", To: joinVersions(mapInfos(infos))})
+	}
+	for _, info := range diff.InfoDiff {
+		from, to := joinVersions(info.Info1), joinVersions(info.Info2)
+		if from != to {
+			changes = append(changes, PackageChange{Package: info.Package, Change: "changed", From: from, To: to})
+		}
+	}
+	sortPackageChanges(changes)
+	return changes
+}
+
+func mapInfos(infos map[string]PackageInfo) []PackageInfo {
+	list := []PackageInfo{}
+	for _, info := range infos {
+		list = append(list, info)
+	}
+	return list
+}
+
+// joinVersions lists the distinct versions of the given package installations.
+func joinVersions(infos []PackageInfo) string {
+	seen := map[string]bool{}
+	versions := []string{}
+	for _, info := range infos {
+		if !seen[info.Version] {
+			seen[info.Version] = true
+			versions = append(versions, info.Version)
+		}
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ", ")
+}
+
+func sortPackageChanges(changes []PackageChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Package < changes[j].Package
+	})
+}
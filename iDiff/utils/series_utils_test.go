@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetSeriesReport(t *testing.T) {
+	images := []SeriesImage{{Image: "img:1"}, {Image: "img:2"}, {Image: "img:3"}, {Image: "img:4", Error: "Could not prepare image img:4"}}
+	diffs := []map[string]DiffResult{
+		{
+			"AptDiffer": &PackageDiffResult{DiffType: "AptDiffer", Diff: PackageDiff{
+				Packages1: map[string]PackageInfo{"old": {Version: "1.0"}},
+				Packages2: map[string]PackageInfo{"new": {Version: "2.0"}},
+				InfoDiff: []Info{
+					{Package: "libc", Info1: PackageInfo{Version: "2.19"}, Info2: PackageInfo{Version: "2.24"}},
+					{Package: "same", Info1: PackageInfo{Version: "1", Size: 1}, Info2: PackageInfo{Version: "1", Size: 2}},
+				},
+			}},
+			"HistoryDiffer": &HistDiffResult{DiffType: "HistoryDiffer", Diff: HistDiff{Adds: []string{"RUN b"}, Dels: []string{"RUN a"}}},
+		},
+		{
+			"PipDiffer": &MultiVersionPackageDiffResult{DiffType: "PipDiffer", Diff: MultiVersionPackageDiff{
+				InfoDiff: []MultiVersionInfo{{Package: "six",
+					Info1: []PackageInfo{{Version: "1.9"}},
+					Info2: []PackageInfo{{Version: "1.10"}, {Version: "1.9"}}}},
+			}},
+			"HistoryDiffer": &HistDiffResult{DiffType: "HistoryDiffer", Diff: HistDiff{}},
+		},
+		nil,
+	}
+	failures := []SeriesFailure{{Index: 3, Image1: "img:3", Image2: "img:4", Error: "Could not prepare image img:4"}}
+
+	report := GetSeriesReport(images, diffs, failures)
+	expectedPackages := []PackageChange{
+		{Index: 1, Image: "img:2", DiffType: "AptDiffer", Package: "libc", Change: "changed", From: "2.19", To: "2.24"},
+		{Index: 1, Image: "img:2", DiffType: "AptDiffer", Package: "new", Change: "added", To: "2.0"},
+		{Index: 1, Image: "img:2", DiffType: "AptDiffer", Package: "old", Change: "removed", From: "1.0"},
+		{Index: 2, Image: "img:3", DiffType: "PipDiffer", Package: "six", Change: "changed", From: "1.9", To: "1.10, 1.9"},
+	}
+	if !reflect.DeepEqual(report.PackageChanges, expectedPackages) {
+		t.Errorf("Expected package changes: %v but got: %v", expectedPackages, report.PackageChanges)
+	}
+	expectedHistory := []HistoryChange{{Index: 1, Image: "img:2", Adds: []string{"RUN b"}, Dels: []string{"RUN a"}}}
+	if !reflect.DeepEqual(report.HistoryChanges, expectedHistory) {
+		t.Errorf("Expected history changes: %v but got: %v", expectedHistory, report.HistoryChanges)
+	}
+	if len(report.Images) != 4 || report.Images[2].Image != "img:3" {
+		t.Errorf("Expected 4 images in report but got: %v", report.Images)
+	}
+	if !reflect.DeepEqual(report.Failures, failures) {
+		t.Errorf("Expected failures: %v but got: %v", failures, report.Failures)
+	}
+
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, report, SeriesMarkdownOutput); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	for _, expected := range []string{"| 3 | img:4 | not prepared |", "## Failed diffs", "| 3 | img:3 | img:4 | Could not prepare image img:4 |"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected report to contain %q but got:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestEscapeMarkdownCell(t *testing.T) {
+	if escaped := escapeMarkdownCell("a|b\nc"); escaped != "a\\|b c" {
+		t.Errorf("Expected a\\|b c but got %s", escaped)
+	}
+}
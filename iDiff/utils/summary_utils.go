@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DiffSummary counts the items a differ found added, removed or changed between two images.
+type DiffSummary struct {
+	Added   int
+	Removed int
+	Changed int
+	// SizeDelta is the net change in bytes of the items, for differs which measure sizes.
+	SizeDelta int64
+}
+
+// add accumulates another summary into s.
+func (s *DiffSummary) add(other DiffSummary) {
+	s.Added += other.Added
+	s.Removed += other.Removed
+	s.Changed += other.Changed
+	s.SizeDelta += other.SizeDelta
+}
+
+// DifferSummary is the summary of a single differ's result.
+type DifferSummary struct {
+	Differ string
+	DiffSummary
+}
+
+// ComparisonSummary totals the summaries of the differs run on two images.  Its SizeDelta is
+// the change in size of the images' file systems rather than the sum of the differs' deltas,
+// which would count the same bytes once for each differ.
+type ComparisonSummary struct {
+	DiffSummary
+	Differs []DifferSummary
+}
+
+func (s ComparisonSummary) OutputText() error {
+	return TemplateOutput(s)
+}
+
+// ComparisonOutput is the JSON output of a comparison.  Its summary block lets the totals be
+// read without walking every result.
+type ComparisonOutput struct {
+	Summary ComparisonSummary
+	Diffs   []DiffResult
+}
+
+// SummarizeDiffs totals the summaries of the results, listing them by differ name.
+// sizeDelta is the change in size of the compared images.
+func SummarizeDiffs(results map[string]DiffResult, sizeDelta int64) ComparisonSummary {
+	names := []string{}
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summary := ComparisonSummary{Differs: []DifferSummary{}}
+	for _, name := range names {
+		differSummary := results[name].Summary()
+		summary.add(differSummary)
+		summary.Differs = append(summary.Differs, DifferSummary{Differ: name, DiffSummary: differSummary})
+	}
+	summary.SizeDelta = sizeDelta
+	return summary
+}
+
+var sizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// HumanSize formats a size in bytes with binary units, such as 512 B or 1.5 MiB.
+func HumanSize(size int64) string {
+	if size < 0 {
+		return "-" + HumanSize(-size)
+	}
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, sizeUnits[unit])
+}
+
+// HumanSizeDelta formats a change in size, always signed, such as +1.5 MiB or -512 B.
+func HumanSizeDelta(delta int64) string {
+	if delta < 0 {
+		return HumanSize(delta)
+	}
+	return "+" + HumanSize(delta)
+}
+
+func packageSizes(packages map[string]PackageInfo) int64 {
+	var size int64
+	for _, info := range packages {
+		size += info.Size
+	}
+	return size
+}
+
+func packageListSizes(infos []PackageInfo) int64 {
+	var size int64
+	for _, info := range infos {
+		size += info.Size
+	}
+	return size
+}
+
+func multiVersionPackageSizes(packages map[string]map[string]PackageInfo) int64 {
+	var size int64
+	for _, infos := range packages {
+		size += packageSizes(infos)
+	}
+	return size
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHumanSize(t *testing.T) {
+	for size, expected := range map[int64]string{
+		0:               "0 B",
+		512:             "512 B",
+		1024:            "1.0 KiB",
+		1536 * 1024:     "1.5 MiB",
+		3 << 30:         "3.0 GiB",
+		-2048:           "-2.0 KiB",
+		1 << 62:         "4.0 EiB",
+		1024*1024 - 100: "1023.9 KiB",
+	} {
+		if actual := HumanSize(size); actual != expected {
+			t.Errorf("Expected %d to format as %s but got: %s", size, expected, actual)
+		}
+	}
+	for delta, expected := range map[int64]string{0: "+0 B", 2048: "+2.0 KiB", -512: "-512 B"} {
+		if actual := HumanSizeDelta(delta); actual != expected {
+			t.Errorf("Expected delta %d to format as %s but got: %s", delta, expected, actual)
+		}
+	}
+}
+
+func TestSummarizeDiffs(t *testing.T) {
+	results := map[string]DiffResult{
+		"PipDiffer": PackageDiffResult{DiffType: "PipDiffer", Diff: PackageDiff{
+			Packages1: map[string]PackageInfo{"six": {Version: "1.0", Size: 100}},
+			Packages2: map[string]PackageInfo{"mock": {Version: "2.0", Size: 1000}, "pbr": {Version: "3.0", Size: 10}},
+			InfoDiff:  []Info{{Package: "req", Info1: PackageInfo{Version: "1", Size: 50}, Info2: PackageInfo{Version: "2", Size: 80}}},
+		}},
+		"HistoryDiffer": HistDiffResult{DiffType: "HistoryDiffer", Diff: HistDiff{
+			Adds: []string{"RUN apt-get update"},
+			Dels: []string{"RUN true", "ADD . /app"},
+		}},
+	}
+	expected := ComparisonSummary{
+		DiffSummary: DiffSummary{Added: 3, Removed: 3, Changed: 1, SizeDelta: 4096},
+		Differs: []DifferSummary{
+			{Differ: "HistoryDiffer", DiffSummary: DiffSummary{Added: 1, Removed: 2}},
+			{Differ: "PipDiffer", DiffSummary: DiffSummary{Added: 2, Removed: 1, Changed: 1, SizeDelta: 940}},
+		},
+	}
+	if actual := SummarizeDiffs(results, 4096); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected summary %+v but got: %+v", expected, actual)
+	}
+}
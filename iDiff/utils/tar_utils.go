@@ -2,7 +2,9 @@ package utils
 
 import (
 	"archive/tar"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -18,19 +20,101 @@ type Directory struct {
 	Content []string
 }
 
+// XattrsSuffix is appended to the directory a tar is extracted to in order to name the file recording
+// the extended attributes of its entries, which cannot generally be set without privileges.
+const XattrsSuffix = ".xattrs.json"
+
+const paxXattrPrefix = "SCHILY.xattr."
+
+// MetadataSuffix is appended to the directory a tar is extracted to in order to name the file recording
+// the owner and mode of its entries, which cannot generally be set without privileges.
+const MetadataSuffix = ".metadata.json"
+
+// EntryMetadata is the owner and mode of a tar entry as recorded in the tar.
+type EntryMetadata struct {
+	Uid  int
+	Gid  int
+	Mode os.FileMode
+}
+
+// ExtractLimits bounds what extracting an image may write, guarding against tar bombs.
+// The limits apply to an image tar and all of its layers together.
+type ExtractLimits struct {
+	// MaxSize is the most bytes of file content which may be extracted.
+	MaxSize int64
+	// MaxEntries is the most tar entries which may be extracted.
+	MaxEntries int
+}
+
+// linkFile hardlinks extracted files, and is replaced in tests to exercise the copy fallback.
+var linkFile = os.Link
+
+// DefaultExtractLimits are used for any limit which is not set.
+var DefaultExtractLimits = ExtractLimits{MaxSize: 32 << 30, MaxEntries: 4 << 20}
+
+func (l ExtractLimits) withDefaults() ExtractLimits {
+	if l.MaxSize <= 0 {
+		l.MaxSize = DefaultExtractLimits.MaxSize
+	}
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = DefaultExtractLimits.MaxEntries
+	}
+	return l
+}
+
+// tarExtractor extracts tars while keeping count of what it has written against its limits.
+type tarExtractor struct {
+	limits  ExtractLimits
+	size    int64
+	entries int
+}
+
+func newTarExtractor(limits ExtractLimits) *tarExtractor {
+	return &tarExtractor{limits: limits.withDefaults()}
+}
+
 // UnTar takes in a path to a tar file and writes the untarred version to the provided target.
-// Only untars one level, does not untar nested tars.
+// Only untars one level, does not untar nested tars.  Entries which would be written outside
+// of the target, directly or through a symlink, are rejected.  Device and fifo entries cannot
+// generally be created without privileges, so empty regular files with their permissions stand in for them.
 func UnTar(filename string, path string) error {
-	if _, ok := os.Stat(path); ok != nil {
-		os.MkdirAll(path, 0777)
+	return newTarExtractor(DefaultExtractLimits).untar(filename, path)
+}
+
+func (e *tarExtractor) untar(filename, root string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
+	return e.untarReader(file, filename, root)
+}
 
+// untarArchive extracts a tar which holds the files of an image, such as its layer tars, rather
+// than a file system, so the owner and mode of its entries are not recorded.
+func (e *tarExtractor) untarArchive(filename, root string) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	tr := tar.NewReader(file)
+	return e.extract(file, filename, root, false)
+}
+
+// untarReader extracts the tar read from r, which is named by filename in errors, into root.
+func (e *tarExtractor) untarReader(r io.Reader, filename, root string) error {
+	return e.extract(r, filename, root, true)
+}
+
+// extract extracts the tar read from r into root, recording the extended attributes of its
+// entries and, if recordMetadata is set, their owners and modes beside root.
+func (e *tarExtractor) extract(r io.Reader, filename, root string, recordMetadata bool) error {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	xattrs := map[string]map[string][]byte{}
+	metadata := map[string]EntryMetadata{}
 
 	for {
 		header, err := tr.Next()
@@ -39,73 +123,455 @@ func UnTar(filename string, path string) error {
 			break
 		}
 		if err != nil {
-			glog.Fatalf(err.Error())
+			return fmt.Errorf("Could not read tar %s: %s", filename, err)
 		}
 
-		target := filepath.Join(path, header.Name)
-		mode := header.FileInfo().Mode()
-		switch header.Typeflag {
+		e.entries++
+		if e.entries > e.limits.MaxEntries {
+			return fmt.Errorf("Tar %s exceeds the limit of %d entries", filename, e.limits.MaxEntries)
+		}
+		target, err := tarEntryPath(root, header.Name)
+		if err != nil {
+			return fmt.Errorf("Tar %s: %s", filename, err)
+		}
+		if target == root {
+			continue
+		}
+		if err := makeParentDirs(root, target); err != nil {
+			return fmt.Errorf("Tar %s: %s", filename, err)
+		}
+		recordXattrs(xattrs, header)
+		if recordMetadata {
+			metadata[tarEntryName(header)] = EntryMetadata{Uid: header.Uid, Gid: header.Gid, Mode: header.FileInfo().Mode()}
+		}
+		if err := e.extractEntry(tr, header, root, target); err != nil {
+			return fmt.Errorf("Could not extract %s from tar %s: %s", header.Name, filename, err)
+		}
+	}
+	if err := writeXattrs(root, xattrs); err != nil {
+		return err
+	}
+	return writeMetadata(root, metadata)
+}
 
-		// if its a dir and it doesn't exist create it
-		case tar.TypeDir:
-			if _, err := os.Stat(target); err != nil {
-				if err := os.MkdirAll(target, mode); err != nil {
-					return err
-				}
-				continue
+func (e *tarExtractor) extractEntry(tr *tar.Reader, header *tar.Header, root, target string) error {
+	mode := header.FileInfo().Mode()
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if info, err := os.Lstat(target); err != nil || !info.IsDir() {
+			if err := removeExisting(target); err != nil {
+				return err
 			}
-
-		// if it's a file create it
-		case tar.TypeReg:
-
-			currFile, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
-			if err != nil {
+			if err := os.Mkdir(target, 0700); err != nil {
 				return err
 			}
-			defer currFile.Close()
-			_, err = io.Copy(currFile, tr)
-			if err != nil {
+		}
+		// Set the mode exactly, bypassing the umask, but keep the directory writable for its contents
+		return os.Chmod(target, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)|0700)
+
+	case tar.TypeReg, tar.TypeRegA:
+		if e.size+header.Size > e.limits.MaxSize {
+			return fmt.Errorf("extracting it would exceed the limit of %d bytes", e.limits.MaxSize)
+		}
+		e.size += header.Size
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		return writeTarFile(target, tr, header.Size, mode)
+
+	case tar.TypeSymlink:
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		// The link is only read, never followed, when extracting later entries.
+		return os.Symlink(header.Linkname, target)
+
+	case tar.TypeLink:
+		source, err := tarEntryPath(root, header.Linkname)
+		if err != nil {
+			return err
+		}
+		if err := checkNoSymlinks(root, source); err != nil {
+			return fmt.Errorf("hardlink target %s: %s", header.Linkname, err)
+		}
+		info, err := os.Lstat(source)
+		if err != nil {
+			return fmt.Errorf("hardlink target %s has not been extracted: %s", header.Linkname, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("hardlink target %s is not a regular file", header.Linkname)
+		}
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		if err := linkFile(source, target); err == nil {
+			return nil
+		}
+		// Fall back to a copy where the file system does not support hardlinks.
+		if e.size+info.Size() > e.limits.MaxSize {
+			return fmt.Errorf("copying hardlink target %s would exceed the limit of %d bytes", header.Linkname, e.limits.MaxSize)
+		}
+		e.size += info.Size()
+		src, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		return writeTarFile(target, src, info.Size(), info.Mode())
+
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		return writeTarFile(target, strings.NewReader(""), 0, mode.Perm())
+
+	case tar.TypeXGlobalHeader:
+		return nil
+
+	default:
+		glog.Warningf("Skipping tar entry %s of unsupported type %q", header.Name, header.Typeflag)
+		return nil
+	}
+}
+
+// tarEntryPath returns where an entry named in a tar is extracted to under root,
+// rejecting absolute names and names which escape root.
+func tarEntryPath(root, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("entry %s has an absolute path", name)
+	}
+	clean := filepath.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %s escapes the extraction directory", name)
+	}
+	return filepath.Join(root, clean), nil
+}
+
+// makeParentDirs creates the missing parent directories of target under root, refusing to
+// create anything beneath a symlink, which could point outside of root.
+func makeParentDirs(root, target string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+	current := root
+	for _, component := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, component)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(current, 0755); err != nil {
 				return err
 			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("entry %s would be written through the symlink %s", target, current)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("entry %s would be written beneath the file %s", target, current)
+		}
+	}
+	return nil
+}
+
+// checkNoSymlinks returns an error if path, or any directory between root and path, is a
+// symlink, which could point outside of root.  Components which do not exist yet are not checked.
+func checkNoSymlinks(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of the extraction directory", path)
+	}
+	if rel == "." {
+		return nil
+	}
+	current := root
+	for _, component := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, component)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s would be reached through the symlink %s", path, current)
 		}
 	}
 	return nil
 }
 
+// removeExisting removes whatever an earlier entry left at path, so that it is replaced rather
+// than written through.
+func removeExisting(path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
+func writeTarFile(target string, r io.Reader, size int64, mode os.FileMode) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(file, r, size)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// Set the mode exactly, including setuid and setgid bits, bypassing the umask
+	return os.Chmod(target, mode)
+}
+
+func recordXattrs(xattrs map[string]map[string][]byte, header *tar.Header) {
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		name := tarEntryName(header)
+		if _, ok := xattrs[name]; !ok {
+			xattrs[name] = map[string][]byte{}
+		}
+		xattrs[name][strings.TrimPrefix(key, paxXattrPrefix)] = []byte(value)
+	}
+}
+
+func writeXattrs(path string, xattrs map[string]map[string][]byte) error {
+	if len(xattrs) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(xattrs)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+XattrsSuffix, data, 0644)
+}
+
+// GetXattrs returns the extended attributes recorded when extracting the tar at path, keyed by
+// the path of each entry within the tar.
+func GetXattrs(path string) (map[string]map[string][]byte, error) {
+	xattrs := map[string]map[string][]byte{}
+	data, err := ioutil.ReadFile(path + XattrsSuffix)
+	if os.IsNotExist(err) {
+		return xattrs, nil
+	}
+	if err != nil {
+		return xattrs, err
+	}
+	err = json.Unmarshal(data, &xattrs)
+	return xattrs, err
+}
+
+// tarEntryName returns the absolute path of the entry within the tar's file system.
+func tarEntryName(header *tar.Header) string {
+	return "/" + strings.TrimPrefix(filepath.ToSlash(filepath.Clean(header.Name)), "/")
+}
+
+func writeMetadata(path string, metadata map[string]EntryMetadata) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+MetadataSuffix, data, 0644)
+}
+
+// GetMetadata returns the owners and modes recorded when extracting the tar at path, keyed by
+// the path of each entry within the tar.
+func GetMetadata(path string) (map[string]EntryMetadata, error) {
+	metadata := map[string]EntryMetadata{}
+	data, err := ioutil.ReadFile(path + MetadataSuffix)
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(data, &metadata)
+	return metadata, err
+}
+
 func isTar(path string) bool {
 	return filepath.Ext(path) == ".tar"
 }
 
-// ExtractTar extracts the tar and any nested tar at the given path.
-// After execution the original tar file is removed and the untarred version is in it place.
-func ExtractTar(path string) error {
-	removeTar := false
+// ExtractTar extracts the image tar produced by `docker save` at tarPath into target, and then
+// extracts each of its layer tars in place of the tar.  Tars within the layers are part of the
+// image's file system and are left as they are.  The original tar is left in place.
+// Cancelling ctx stops extraction between tar files.
+func ExtractTar(ctx context.Context, tarPath, target string, limits ExtractLimits) error {
+	return ExtractTarImage(ctx, tarPath, target, "", limits)
+}
 
-	var untarWalkFn func(path string, info os.FileInfo, err error) error
+// ExtractTarImage extracts one image of a tar produced by `docker save` for several images, as
+// ExtractTar does.  The image is selected by one of its repo tags, such as ubuntu:16.04, or by a
+// prefix of its ID.  The selector may only be empty if the tar holds a single image.
+// The manifest.json left in target lists only the selected image, and the layers of the other
+// images are removed.
+func ExtractTarImage(ctx context.Context, tarPath, target, image string, limits ExtractLimits) error {
+	e := newTarExtractor(limits)
+	if err := e.untarArchive(tarPath, target); err != nil {
+		return err
+	}
+	if err := selectTarImage(target, image); err != nil {
+		return fmt.Errorf("%s: %s", tarPath, err)
+	}
 
-	untarWalkFn = func(path string, info os.FileInfo, err error) error {
-		if isTar(path) {
-			target := strings.TrimSuffix(path, filepath.Ext(path))
-			UnTar(path, target)
-			if removeTar {
-				os.Remove(path)
+	layers, err := getLayerTars(target)
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		layerPath, err := tarEntryPath(target, layer)
+		if err != nil {
+			return fmt.Errorf("Layer %s: %s", layer, err)
+		}
+		// The outer tar may hold symlinks, so the layer and the directory it is extracted to
+		// must not be reached through one.
+		layerDir := strings.TrimSuffix(layerPath, filepath.Ext(layerPath))
+		for _, path := range []string{layerPath, layerDir} {
+			if err := checkNoSymlinks(target, path); err != nil {
+				return fmt.Errorf("Layer %s: %s", layer, err)
 			}
-			// remove nested tar files that get copied but not the original tar passed
-			removeTar = true
-			filepath.Walk(target, untarWalkFn)
+		}
+		if info, err := os.Lstat(layerPath); err != nil {
+			return fmt.Errorf("Layer %s: %s", layer, err)
+		} else if !info.Mode().IsRegular() {
+			return fmt.Errorf("Layer %s is not a regular file", layer)
+		}
+		if err := e.untar(layerPath, layerDir); err != nil {
+			return err
+		}
+		if err := os.Remove(layerPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectTarImage trims the manifest.json of an extracted image tar down to the selected image
+// and removes the directories of layers the image does not use.
+func selectTarImage(target, image string) error {
+	manifest, err := readManifest(target)
+	if os.IsNotExist(err) {
+		if image != "" {
+			return fmt.Errorf("Cannot select image %s from a tar without a manifest.json", image)
 		}
 		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not read manifest of image tar: %s", err)
+	}
+	if image == "" && len(manifest) <= 1 {
+		return nil
+	}
+
+	var selected []manifestJSON
+	for _, entry := range manifest {
+		if image == "" || entry.matches(image) {
+			selected = append(selected, entry)
+		}
+	}
+	if len(selected) != 1 {
+		names := []string{}
+		for _, entry := range manifest {
+			names = append(names, entry.name())
+		}
+		switch {
+		case image == "":
+			return fmt.Errorf("Tar holds %d images, select one of %s as <tar>#<image> or with --tar-image", len(manifest), strings.Join(names, ", "))
+		case len(selected) == 0:
+			return fmt.Errorf("No image %s in tar, which holds %s", image, strings.Join(names, ", "))
+		default:
+			return fmt.Errorf("Image %s matches %d images in tar, which holds %s", image, len(selected), strings.Join(names, ", "))
+		}
+	}
+
+	used := map[string]bool{}
+	for _, layer := range selected[0].Layers {
+		used[strings.Split(filepath.ToSlash(filepath.Clean(layer)), "/")[0]] = true
+	}
+	for _, layer := range GetImageLayers(target) {
+		if !used[layer] {
+			if err := os.RemoveAll(filepath.Join(target, layer)); err != nil {
+				return err
+			}
+		}
+	}
+	contents, err := json.Marshal(selected)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(target, "manifest.json"), contents, 0644)
+}
+
+// SplitTarSource splits a tar source of the form <path>#<image> into the path of the tar and
+// the image selected from it.  The image is empty if the source selects none.
+func SplitTarSource(source string) (string, string) {
+	i := strings.LastIndex(source, "#")
+	if i < 0 {
+		return source, ""
+	}
+	if _, err := os.Stat(source); err == nil {
+		// The path of the tar itself contains a #.
+		return source, ""
+	}
+	return source[:i], source[i+1:]
+}
+
+// getLayerTars returns the layer tars of an extracted image tar, as listed by its manifest.json
+// or, for images saved without one, found as <layer>/layer.tar.
+func getLayerTars(target string) ([]string, error) {
+	if manifest, err := readManifest(target); err == nil {
+		layers := []string{}
+		seen := map[string]bool{}
+		for _, image := range manifest {
+			for _, layer := range image.Layers {
+				if !seen[layer] && isTar(layer) {
+					seen[layer] = true
+					layers = append(layers, layer)
+				}
+			}
+		}
+		return layers, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Could not read manifest of image tar: %s", err)
 	}
 
-	return filepath.Walk(path, untarWalkFn)
+	matches, err := filepath.Glob(filepath.Join(target, "*", "layer.tar"))
+	if err != nil {
+		return nil, err
+	}
+	layers := []string{}
+	for _, match := range matches {
+		if info, err := os.Lstat(match); err == nil && info.Mode().IsRegular() {
+			rel, _ := filepath.Rel(target, match)
+			layers = append(layers, rel)
+		}
+	}
+	return layers, nil
 }
 
 func TarToDir(tarPath string, deep bool) (string, string, error) {
-	err := ExtractTar(tarPath)
+	path := strings.TrimSuffix(tarPath, filepath.Ext(tarPath))
+	err := ExtractTar(context.Background(), tarPath, path, DefaultExtractLimits)
 	if err != nil {
 		return "", "", err
 	}
-	path := strings.TrimSuffix(tarPath, filepath.Ext(tarPath))
 	jsonPath := path + ".json"
 	err = DirToJSON(path, jsonPath, deep)
 	if err != nil {
@@ -116,6 +582,22 @@ func TarToDir(tarPath string, deep bool) (string, string, error) {
 
 // DirToJSON records the directory structure starting at the provided path as in a json file.
 func DirToJSON(path string, target string, deep bool) error {
+	directory, err := DirToDirectory(path, deep)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(directory)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(target, data, 0777)
+}
+
+// DirToDirectory records the directory structure starting at the provided path as a Directory.
+// If deep is false only the top level entries are recorded.
+func DirToDirectory(path string, deep bool) (Directory, error) {
 	var directory Directory
 	directory.Root = path
 
@@ -132,7 +614,7 @@ func DirToJSON(path string, target string, deep bool) error {
 	} else {
 		contents, err := ioutil.ReadDir(path)
 		if err != nil {
-			return err
+			return directory, err
 		}
 
 		for _, file := range contents {
@@ -140,16 +622,12 @@ func DirToJSON(path string, target string, deep bool) error {
 			directory.Content = append(directory.Content, fileName)
 		}
 	}
-
-	data, err := json.Marshal(directory)
-	if err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(target, data, 0777)
+	return directory, nil
 }
 
+// CheckTar returns whether the image is an existing tar, optionally followed by #<image>.
 func CheckTar(image string) bool {
+	image, _ = SplitTarSource(image)
 	if strings.TrimSuffix(image, ".tar") == image {
 		return false
 	}
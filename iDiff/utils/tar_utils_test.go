@@ -1,12 +1,16 @@
 package utils
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -70,10 +74,11 @@ func TestIsTar(t *testing.T) {
 }
 
 func TestExtractTar(t *testing.T) {
+	// Tars which are not layers of a saved image are part of the file system and are not extracted.
 	tarPath := "testTars/la-croix3.tar"
 	target := "testTars/la-croix3"
-	expected := "testTars/la-croix3-full"
-	err := ExtractTar(tarPath)
+	expected := "testTars/la-croix3-actual"
+	err := ExtractTar(context.Background(), tarPath, target, DefaultExtractLimits)
 	if err != nil {
 		t.Errorf("Got unexpected error: %s", err)
 	}
@@ -149,3 +154,484 @@ func TestDirToJSON(t *testing.T) {
 		os.Remove(testCase.target)
 	}
 }
+
+func TestUnTarModesAndXattrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarPath := filepath.Join(dir, "layer.tar")
+	f, _ := os.Create(tarPath)
+	tw := tar.NewWriter(f)
+	tw.WriteHeader(&tar.Header{Name: "tmp/", Typeflag: tar.TypeDir, Mode: 01777})
+	tw.WriteHeader(&tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755})
+	tw.WriteHeader(&tar.Header{Name: "bin/ping", Typeflag: tar.TypeReg, Mode: 04755, Size: 4, Format: tar.FormatPAX,
+		PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "\x01\x00\x00\x02"}})
+	tw.Write([]byte("ping"))
+	tw.Close()
+	f.Close()
+
+	target := filepath.Join(dir, "layer")
+	if err := UnTar(tarPath, target); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if info, _ := os.Stat(filepath.Join(target, "tmp")); info.Mode()&(os.ModeSticky|0777) != os.ModeSticky|0777 {
+		t.Errorf("Expected sticky world-writable directory but got mode %s", info.Mode())
+	}
+	if info, _ := os.Stat(filepath.Join(target, "bin/ping")); info.Mode()&os.ModeSetuid == 0 {
+		t.Errorf("Expected setuid file but got mode %s", info.Mode())
+	}
+	xattrs, err := GetXattrs(target)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := map[string]map[string][]byte{"/bin/ping": {"security.capability": []byte("\x01\x00\x00\x02")}}
+	if !reflect.DeepEqual(xattrs, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, xattrs)
+	}
+}
+
+func TestUnTarRecordsMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarPath := filepath.Join(dir, "layer.tar")
+	writeTar(t, tarPath, []*tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0750, Uid: 0, Gid: 42},
+		{Name: "etc/shadow", Typeflag: tar.TypeReg, Mode: 0640, Uid: 0, Gid: 42},
+		{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3},
+		{Name: "home/app/", Typeflag: tar.TypeDir, Mode: 0700, Uid: 1000, Gid: 1000},
+	}, nil)
+
+	target := filepath.Join(dir, "layer")
+	if err := UnTar(tarPath, target); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	metadata, err := GetMetadata(target)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	expected := map[string]EntryMetadata{
+		"/etc":        {Gid: 42, Mode: os.ModeDir | 0750},
+		"/etc/shadow": {Gid: 42, Mode: 0640},
+		"/dev/null":   {Mode: os.ModeDevice | os.ModeCharDevice | 0666},
+		"/home/app":   {Uid: 1000, Gid: 1000, Mode: os.ModeDir | 0700},
+	}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Errorf("Expected: %v but got: %v", expected, metadata)
+	}
+
+	changes, err := GetLayerChanges(target)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if mode := changes.Files["/dev/null"].Mode(); mode != os.ModeDevice|os.ModeCharDevice|0666 {
+		t.Errorf("Expected the recorded mode of /dev/null rather than that of its stand in but got %s", mode)
+	}
+	if file := changes.Files["/home/app"]; file.Metadata == nil || file.Metadata.Uid != 1000 {
+		t.Errorf("Expected the recorded owner of /home/app but got %+v", file.Metadata)
+	}
+}
+
+func writeTar(t *testing.T, tarPath string, headers []*tar.Header, contents map[string]string) {
+	f, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, header := range headers {
+		content := contents[header.Name]
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+}
+
+func TestUnTarRejectsEscapes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		descrip string
+		headers []*tar.Header
+	}{
+		{
+			descrip: "Parent directory traversal",
+			headers: []*tar.Header{{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0644}},
+		},
+		{
+			descrip: "Traversal after a directory",
+			headers: []*tar.Header{{Name: "etc/../../escaped", Typeflag: tar.TypeReg, Mode: 0644}},
+		},
+		{
+			descrip: "Absolute path",
+			headers: []*tar.Header{{Name: filepath.Join(dir, "escaped"), Typeflag: tar.TypeReg, Mode: 0644}},
+		},
+		{
+			descrip: "Write through a symlink",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: dir},
+				{Name: "link/escaped", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+		},
+		{
+			descrip: "Hardlink outside of the root",
+			headers: []*tar.Header{{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "../outside"}},
+		},
+	} {
+		tarPath := filepath.Join(dir, "evil.tar")
+		writeTar(t, tarPath, test.headers, nil)
+		ioutil.WriteFile(filepath.Join(dir, "outside"), []byte("secret"), 0644)
+		target := filepath.Join(dir, "root")
+
+		if err := UnTar(tarPath, target); err == nil {
+			t.Errorf("%s: expected error but got none", test.descrip)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "escaped")); err == nil {
+			t.Errorf("%s: file was written outside of the extraction directory", test.descrip)
+		}
+		os.RemoveAll(target)
+		os.Remove(filepath.Join(dir, "escaped"))
+	}
+}
+
+func TestUnTarRejectsHardlinksThroughSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644)
+
+	tarPath := filepath.Join(dir, "evil.tar")
+	writeTar(t, tarPath, []*tar.Header{
+		{Name: "host", Typeflag: tar.TypeSymlink, Linkname: dir},
+		{Name: "stolen", Typeflag: tar.TypeLink, Linkname: "host/secret"},
+	}, nil)
+	target := filepath.Join(dir, "root")
+	if err := UnTar(tarPath, target); err == nil {
+		t.Errorf("Expected error for a hardlink to a file reached through a symlink but got none")
+	}
+	if _, err := os.Lstat(filepath.Join(target, "stolen")); err == nil {
+		t.Errorf("Expected no link to a file outside of the extraction directory to be created")
+	}
+}
+
+func TestUnTarHardlinkCopyLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Copy hardlinked files, as on file systems without hardlinks.
+	defer func() { linkFile = os.Link }()
+	linkFile = func(string, string) error { return errors.New("hardlinks are not supported") }
+
+	tarPath := filepath.Join(dir, "layer.tar")
+	writeTar(t, tarPath, []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "b", Typeflag: tar.TypeLink, Linkname: "a"},
+		{Name: "c", Typeflag: tar.TypeLink, Linkname: "a"},
+	}, map[string]string{"a": "12345"})
+
+	target := filepath.Join(dir, "layer")
+	if err := newTarExtractor(ExtractLimits{MaxSize: 15}).untar(tarPath, target); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(target, "c")); string(content) != "12345" {
+		t.Errorf("Expected hardlink to be copied from its target but got %q", content)
+	}
+	os.RemoveAll(target)
+	if err := newTarExtractor(ExtractLimits{MaxSize: 14}).untar(tarPath, target); err == nil {
+		t.Errorf("Expected copies of hardlinked files to count against the size limit but got no error")
+	}
+}
+
+func TestUnTarLinksAndSpecialFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarPath := filepath.Join(dir, "layer.tar")
+	writeTar(t, tarPath, []*tar.Header{
+		// Parent directories are created even when the tar does not list them.
+		{Name: "usr/bin/python3.5", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "usr/bin/python3", Typeflag: tar.TypeLink, Linkname: "usr/bin/python3.5"},
+		{Name: "usr/bin/python", Typeflag: tar.TypeSymlink, Linkname: "python3"},
+		{Name: "etc/alternatives", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3},
+		{Name: "run/initctl", Typeflag: tar.TypeFifo, Mode: 0600},
+		// A later entry replaces a symlink rather than writing through it.
+		{Name: "etc/alternatives", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"usr/bin/python3.5": "python", "etc/alternatives": "replaced"})
+
+	target := filepath.Join(dir, "layer")
+	if err := UnTar(tarPath, target); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(target, "usr/bin/python3")); string(content) != "python" {
+		t.Errorf("Expected hardlink to share content with its target but got %q", content)
+	}
+	if link, _ := os.Readlink(filepath.Join(target, "usr/bin/python")); link != "python3" {
+		t.Errorf("Expected symlink to python3 but got %q", link)
+	}
+	if info, err := os.Lstat(filepath.Join(target, "etc/alternatives")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Expected symlink to be replaced by a regular file but got %v, %v", info, err)
+	}
+	for _, special := range []string{"dev/null", "run/initctl"} {
+		if info, err := os.Lstat(filepath.Join(target, special)); err != nil || info.Size() != 0 {
+			t.Errorf("Expected an empty stand in for %s but got %v, %v", special, info, err)
+		}
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarPath := filepath.Join(dir, "image.tar")
+	writeTar(t, tarPath, []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "b", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"a": "12345", "b": "67890"})
+
+	for _, test := range []struct {
+		limits ExtractLimits
+		err    bool
+	}{
+		{limits: ExtractLimits{}},
+		{limits: ExtractLimits{MaxSize: 10, MaxEntries: 2}},
+		{limits: ExtractLimits{MaxSize: 9}, err: true},
+		{limits: ExtractLimits{MaxEntries: 1}, err: true},
+	} {
+		err := ExtractTar(context.Background(), tarPath, filepath.Join(dir, "image"), test.limits)
+		if err != nil && !test.err {
+			t.Errorf("Got unexpected error with limits %v: %s", test.limits, err)
+		} else if err == nil && test.err {
+			t.Errorf("Expected error with limits %v but got none", test.limits)
+		}
+		os.RemoveAll(filepath.Join(dir, "image"))
+	}
+}
+
+func TestExtractTarLayersOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	layerPath := filepath.Join(dir, "layer.tar")
+	writeTar(t, layerPath, []*tar.Header{
+		{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "opt/bundle.tar", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"opt/bundle.tar": "not a tar to extract"})
+	layer, _ := ioutil.ReadFile(layerPath)
+	tarPath := filepath.Join(dir, "image.tar")
+	writeTar(t, tarPath, []*tar.Header{
+		{Name: "manifest.json", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "abc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "abc/layer.tar", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{
+		"manifest.json": `[{"Config":"config.json","Layers":["abc/layer.tar"]}]`,
+		"abc/layer.tar": string(layer),
+	})
+
+	target := filepath.Join(dir, "image")
+	if err := ExtractTar(context.Background(), tarPath, target, DefaultExtractLimits); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "abc/layer.tar")); !os.IsNotExist(err) {
+		t.Errorf("Expected the layer tar to be replaced by its contents")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(target, "abc/layer/opt/bundle.tar"))
+	if err != nil || string(content) != "not a tar to extract" {
+		t.Errorf("Expected the tar within the layer to be left as it is but got %q, %v", content, err)
+	}
+}
+
+func TestExtractTarRejectsSymlinkedLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside := filepath.Join(dir, "outside")
+	os.Mkdir(outside, 0755)
+
+	layerPath := filepath.Join(dir, "layer.tar")
+	writeTar(t, layerPath, []*tar.Header{{Name: "escaped", Typeflag: tar.TypeReg, Mode: 0644}}, map[string]string{"escaped": "escaped"})
+	layer, _ := ioutil.ReadFile(layerPath)
+	manifest := `[{"Config":"config.json","Layers":["abc/layer.tar"]}]`
+
+	for _, test := range []struct {
+		descrip string
+		headers []*tar.Header
+	}{
+		{
+			descrip: "Layer in a symlinked directory",
+			headers: []*tar.Header{
+				{Name: "abc", Typeflag: tar.TypeSymlink, Linkname: outside},
+				{Name: "abc/layer.tar", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+		},
+		{
+			descrip: "Layer extracted into a symlinked directory",
+			headers: []*tar.Header{
+				{Name: "abc/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "abc/layer", Typeflag: tar.TypeSymlink, Linkname: outside},
+				{Name: "abc/layer.tar", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+		},
+		{
+			descrip: "Layer which is a symlink",
+			headers: []*tar.Header{
+				{Name: "abc/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "abc/layer.tar", Typeflag: tar.TypeSymlink, Linkname: layerPath},
+			},
+		},
+	} {
+		tarPath := filepath.Join(dir, "image.tar")
+		headers := append([]*tar.Header{{Name: "manifest.json", Typeflag: tar.TypeReg, Mode: 0644}}, test.headers...)
+		writeTar(t, tarPath, headers, map[string]string{"manifest.json": manifest, "abc/layer.tar": string(layer)})
+		target := filepath.Join(dir, "image")
+
+		if err := ExtractTar(context.Background(), tarPath, target, DefaultExtractLimits); err == nil {
+			t.Errorf("%s: expected error but got none", test.descrip)
+		}
+		if contents, _ := ioutil.ReadDir(outside); len(contents) != 0 {
+			t.Errorf("%s: layer was extracted outside of the extraction directory", test.descrip)
+		}
+		os.RemoveAll(target)
+		os.RemoveAll(outside)
+		os.Mkdir(outside, 0755)
+	}
+}
+
+// writeMultiImageTar writes a tar saved with two images, app:1 and app:2, which share their
+// base layer.
+func writeMultiImageTar(t *testing.T, dir string) string {
+	base := filepath.Join(dir, "base.tar")
+	writeTar(t, base, []*tar.Header{{Name: "base.txt", Typeflag: tar.TypeReg, Mode: 0644}}, map[string]string{"base.txt": "base"})
+	top := filepath.Join(dir, "top.tar")
+	writeTar(t, top, []*tar.Header{{Name: "top.txt", Typeflag: tar.TypeReg, Mode: 0644}}, map[string]string{"top.txt": "top"})
+	baseLayer, _ := ioutil.ReadFile(base)
+	topLayer, _ := ioutil.ReadFile(top)
+
+	id1 := strings.Repeat("a", 64)
+	id2 := strings.Repeat("b", 64)
+	tarPath := filepath.Join(dir, "all.tar")
+	writeTar(t, tarPath, []*tar.Header{
+		{Name: "manifest.json", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: id1 + ".json", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: id2 + ".json", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "base/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "base/layer.tar", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "top/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "top/layer.tar", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{
+		"manifest.json": `[{"Config":"` + id1 + `.json","RepoTags":["app:1"],"Layers":["base/layer.tar"]},` +
+			`{"Config":"` + id2 + `.json","RepoTags":["app:2","docker.io/library/app:latest"],"Layers":["base/layer.tar","top/layer.tar"]}]`,
+		id1 + ".json":    `{"history":[{"created_by":"ADD base.txt /"}]}`,
+		id2 + ".json":    `{"history":[{"created_by":"ADD base.txt /"},{"created_by":"ADD top.txt /"}]}`,
+		"base/layer.tar": string(baseLayer),
+		"top/layer.tar":  string(topLayer),
+	})
+	return tarPath
+}
+
+func TestExtractTarImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tarPath := writeMultiImageTar(t, dir)
+
+	for _, test := range []struct {
+		image  string
+		layers []string
+		err    bool
+	}{
+		{image: "", err: true},
+		{image: "app:3", err: true},
+		{image: "app:1", layers: []string{"base"}},
+		{image: "app:2", layers: []string{"base", "top"}},
+		{image: "app", layers: []string{"base", "top"}},
+		{image: "sha256:" + strings.Repeat("a", 12), layers: []string{"base"}},
+	} {
+		target := filepath.Join(dir, "image")
+		err := ExtractTarImage(context.Background(), tarPath, target, test.image, DefaultExtractLimits)
+		if err != nil {
+			if !test.err {
+				t.Errorf("Got unexpected error selecting %q: %s", test.image, err)
+			}
+		} else if test.err {
+			t.Errorf("Expected error selecting %q but got none", test.image)
+		} else {
+			if layers := GetImageLayers(target); !reflect.DeepEqual(layers, test.layers) {
+				t.Errorf("Expected layers %v selecting %q but got: %v", test.layers, test.image, layers)
+			}
+			if manifest, err := readManifest(target); err != nil || len(manifest) != 1 {
+				t.Errorf("Expected manifest listing the selected image but got: %v, %v", manifest, err)
+			}
+		}
+		os.RemoveAll(target)
+	}
+
+	// A selector in the source takes precedence over the prepper's.
+	for source, expected := range map[string][]string{
+		tarPath + "#app:2": {"ADD base.txt /", "ADD top.txt /"},
+		tarPath:            {"ADD base.txt /"},
+	} {
+		image, err := ImagePrepper{Source: source, WorkDir: dir, TarImage: "app:1"}.GetImage(context.Background())
+		if err != nil {
+			t.Errorf("Got unexpected error preparing %s: %s", source, err)
+			continue
+		}
+		if !reflect.DeepEqual(image.History, expected) {
+			t.Errorf("Expected history %v for %s but got: %v", expected, source, image.History)
+		}
+		os.RemoveAll(image.FSPath)
+	}
+}
+
+func TestSplitTarSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hashed := filepath.Join(dir, "a#b.tar")
+	ioutil.WriteFile(hashed, []byte{}, 0644)
+
+	for source, expected := range map[string][2]string{
+		"all.tar":                    {"all.tar", ""},
+		"all.tar#gcr.io/app:1":       {"all.tar", "gcr.io/app:1"},
+		hashed:                       {hashed, ""},
+		hashed + "#localhost:5000/a": {hashed, "localhost:5000/a"},
+	} {
+		if path, image := SplitTarSource(source); path != expected[0] || image != expected[1] {
+			t.Errorf("Expected %s to split into %v but got: %s, %s", source, expected, path, image)
+		}
+	}
+}
@@ -14,32 +14,86 @@ These entries have been deleted from {{.Diff.Image1}}:{{if not .Diff.Dels}} None
 These entries have been changed between {{.Diff.Image1}} and {{.Diff.Image2}}:{{if not .Diff.Mods}} None{{else}}
 	{{range .Diff.Mods}}{{print .}}
 	{{end}}{{end}}
+{{if .Diff.ContentDiffs}}
+Content changes:
+{{range .Diff.ContentDiffs}}{{if .Binary}}Binary file {{.Path}} differs ({{size .Size1}} -> {{size .Size2}})
+{{else if .Skipped}}Content of {{.Path}} not shown: {{.Skipped}}
+{{else}}{{.Diff}}{{end}}{{end}}{{end}}{{if .Diff.Unmanaged}}
+Changes by owning package:
+{{range .Diff.Packages}}{{.Package}}:{{range .Adds}}
+	+{{.}}{{end}}{{range .Dels}}
+	-{{.}}{{end}}{{range .Mods}}
+	~{{.}}{{end}}
+{{end}}{{with .Diff.Unmanaged}}unmanaged:{{if not (or .Adds .Dels .Mods)}} None{{end}}{{range .Adds}}
+	+{{.}}{{end}}{{range .Dels}}
+	-{{.}}{{end}}{{range .Mods}}
+	~{{.}}{{end}}
+{{end}}{{end}}`
+
+const PluginOutput = `
+-----{{.DiffType}}-----
+
+Entries found only in {{.Diff.Image1}}:{{if not .Diff.Dels}} None{{else}}{{range .Diff.Dels}}{{"\n"}}{{print "-" .}}{{end}}{{end}}
+
+Entries found only in {{.Diff.Image2}}:{{if not .Diff.Adds}} None{{else}}{{range .Diff.Adds}}{{"\n"}}{{print "-" .}}{{end}}{{end}}
+
+Entries changed between {{.Diff.Image1}} and {{.Diff.Image2}}:{{if not .Diff.Mods}} None{{else}}{{range .Diff.Mods}}{{"\n"}}{{print "-" .}}{{end}}{{end}}
+`
+
+const SecurityOutput = `
+-----{{.DiffType}}-----
+
+Security changes from {{.Diff.Image1}} to {{.Diff.Image2}}:{{if not .Diff.Findings}} None{{else}}
+SEVERITY	CATEGORY	SUBJECT	DESCRIPTION{{range .Diff.Findings}}{{"\n"}}{{print "-"}}{{.Severity}}	{{.Category}}	{{.Subject}}	{{.Description}}{{end}}{{end}}
+`
+
+const CertOutput = `
+-----{{.DiffType}}-----
+
+CA certificates added in {{.Diff.Image2}}:{{if not .Diff.Added}} None{{else}}
+SUBJECT	SHA-256 FINGERPRINT	EXPIRES{{range .Diff.Added}}{{"\n"}}{{print "-"}}{{.Subject}}	{{.Fingerprint}}	{{.NotAfter.Format "2006-01-02"}}{{end}}{{end}}
+
+CA certificates removed from {{.Diff.Image1}}:{{if not .Diff.Removed}} None{{else}}
+SUBJECT	SHA-256 FINGERPRINT	EXPIRES{{range .Diff.Removed}}{{"\n"}}{{print "-"}}{{.Subject}}	{{.Fingerprint}}	{{.NotAfter.Format "2006-01-02"}}{{end}}{{end}}
+
+Certificates in {{.Diff.Image2}} expired or expiring within {{.Diff.ExpiryDays}} days:{{if not .Diff.Expiring}} None{{else}}
+SUBJECT	SHA-256 FINGERPRINT	EXPIRES{{range .Diff.Expiring}}{{"\n"}}{{print "-"}}{{.Subject}}	{{.Fingerprint}}	{{.NotAfter.Format "2006-01-02"}}{{end}}{{end}}
+`
+
+const ElfOutput = `
+-----{{.DiffType}}-----
+
+Binaries with changed dependencies:{{if not .Diff.Changed}} None{{else}}
+PATH	NEEDED ({{.Diff.Image1}})	NEEDED ({{.Diff.Image2}}){{range .Diff.Changed}}{{"\n"}}{{print "-"}}{{.Path}}	{{join .Info1.Needed ","}}	{{join .Info2.Needed ","}}{{end}}{{end}}
+
+Binaries with libraries no longer resolvable in {{.Diff.Image2}}:{{if not .Diff.Unresolved}} None{{else}}
+PATH	MISSING{{range .Diff.Unresolved}}{{"\n"}}{{print "-"}}{{.Path}}	{{join .Libraries ","}}{{end}}{{end}}
 `
 
 const SingleVersionOutput = `
 -----{{.DiffType}}-----
 
 Packages found only in {{.Diff.Image1}}:{{if not .Diff.Packages1}} None{{else}}
-NAME	VERSION	SIZE{{range $name, $value := .Diff.Packages1}}{{"\n"}}{{print "-"}}{{$name}}	{{$value.Version}}	{{$value.Size}}B{{end}}{{end}}
+NAME	VERSION	SIZE{{range $name, $value := .Diff.Packages1}}{{"\n"}}{{print "-"}}{{$name}}	{{$value.Version}}	{{size $value.Size}}{{end}}{{end}}
 
 Packages found only in {{.Diff.Image2}}:{{if not .Diff.Packages2}} None{{else}}
-NAME	VERSION	SIZE{{range $name, $value := .Diff.Packages2}}{{"\n"}}{{print "-"}}{{$name}}	{{$value.Version}}	{{$value.Size}}B{{end}}{{end}}
+NAME	VERSION	SIZE	INTRODUCED BY{{range $name, $value := .Diff.Packages2}}{{"\n"}}{{print "-"}}{{$name}}	{{$value.Version}}	{{size $value.Size}}	{{index $.Diff.IntroducedBy $name}}{{end}}{{end}}
 
 Version differences:{{if not .Diff.InfoDiff}} None{{else}}
-PACKAGE	IMAGE1 ({{.Diff.Image1}})	IMAGE2 ({{.Diff.Image2}}){{range .Diff.InfoDiff}}{{"\n"}}{{print "-"}}{{.Package}}	{{.Info1.Version}}, {{.Info1.Size}}B	{{.Info2.Version}}, {{.Info2.Size}}B{{end}}{{end}}
+PACKAGE	IMAGE1 ({{.Diff.Image1}})	IMAGE2 ({{.Diff.Image2}})	INTRODUCED BY{{range .Diff.InfoDiff}}{{"\n"}}{{print "-"}}{{.Package}}	{{.Info1.Version}}, {{size .Info1.Size}}	{{.Info2.Version}}, {{size .Info2.Size}}	{{index $.Diff.IntroducedBy .Package}}{{end}}{{end}}
 `
 
 const MultiVersionOutput = `
 -----{{.DiffType}}-----
 
 Packages found only in {{.Diff.Image1}}:{{if not .Diff.Packages1}} None{{else}}
-NAME	VERSION	SIZE{{range $name, $value := .Diff.Packages1}}{{"\n"}}{{print "-"}}{{$name}}	{{range $key, $info := $value}}{{$info.Version}}	{{$info.Size}}B{{end}}{{end}}{{end}}
+NAME	VERSION	SIZE{{range $name, $value := .Diff.Packages1}}{{"\n"}}{{print "-"}}{{$name}}	{{range $key, $info := $value}}{{$info.Version}}	{{size $info.Size}}{{end}}{{end}}{{end}}
 
 Packages found only in {{.Diff.Image2}}:{{if not .Diff.Packages2}} None{{else}}
-NAME	VERSION	SIZE{{range $name, $value := .Diff.Packages2}}{{"\n"}}{{print "-"}}{{$name}}	{{range $key, $info := $value}}{{$info.Version}}	{{$info.Size}}B{{end}}{{end}}{{end}}
+NAME	VERSION	SIZE	INTRODUCED BY{{range $name, $value := .Diff.Packages2}}{{"\n"}}{{print "-"}}{{$name}}	{{range $key, $info := $value}}{{$info.Version}}	{{size $info.Size}}	{{index $.Diff.IntroducedBy $name $info.Version}}{{end}}{{end}}{{end}}
 
 Version differences:{{if not .Diff.InfoDiff}} None{{else}}
-PACKAGE	IMAGE1 ({{.Diff.Image1}})	IMAGE2 ({{.Diff.Image2}}){{range .Diff.InfoDiff}}{{"\n"}}{{print "-"}}{{.Package}}	{{range .Info1}}{{.Version}}, {{.Size}}B{{end}}	{{range .Info2}}{{.Version}}, {{.Size}}B{{end}}{{end}}{{end}}
+PACKAGE	IMAGE1 ({{.Diff.Image1}})	IMAGE2 ({{.Diff.Image2}})	INTRODUCED BY{{range .Diff.InfoDiff}}{{"\n"}}{{print "-"}}{{$name := .Package}}{{.Package}}	{{range .Info1}}{{.Version}}, {{size .Size}}{{end}}	{{range .Info2}}{{.Version}}, {{size .Size}}{{end}}	{{range .Info2}}{{index $.Diff.IntroducedBy $name .Version}}{{end}}{{end}}{{end}}
 `
 
 const HistoryOutput = `
@@ -48,4 +102,101 @@ const HistoryOutput = `
 Docker history lines found only in {{.Diff.Image1}}:{{if not .Diff.Adds}} None{{else}}{{block "list" .Diff.Adds}}{{"\n"}}{{range .}}{{print "-" .}}{{end}}{{end}}{{end}}
 
 Docker history lines found only in {{.Diff.Image2}}:{{if not .Diff.Dels}} None{{else}}{{block "list2" .Diff.Dels}}{{"\n"}}{{range .}}{{print "-" .}}{{end}}{{end}}{{end}}
+
+Dockerfile steps added, removed or changed:{{if not .Diff.Steps}} None{{else}}
+CHANGE	SIZE CHANGE	STEP{{range .Diff.Steps}}
+{{.Change}}	{{sizeDelta .SizeDelta}}	{{.Description}}{{end}}{{end}}
+`
+
+const EfficiencyDiffOutput = `
+-----{{.DiffType}}-----
+
+IMAGE	EFFICIENCY	WASTED	TOTAL
+-{{.Diff.Image1}}	{{printf "%.4f" .Diff.Efficiency1.Score}}	{{size .Diff.Efficiency1.WastedSize}}	{{size .Diff.Efficiency1.TotalSize}}
+-{{.Diff.Image2}}	{{printf "%.4f" .Diff.Efficiency2.Score}}	{{size .Diff.Efficiency2.WastedSize}}	{{size .Diff.Efficiency2.TotalSize}}
+
+{{if gt .Diff.ScoreDelta 0.0}}{{.Diff.Image2}} is more efficient than {{.Diff.Image1}}{{else if lt .Diff.ScoreDelta 0.0}}{{.Diff.Image2}} is less efficient than {{.Diff.Image1}}{{else}}The images are equally efficient{{end}} (efficiency {{printf "%+.4f" .Diff.ScoreDelta}}, wasted space {{sizeDelta .Diff.WastedSizeDelta}})
+`
+
+const EfficiencyAnalysisOutput = `
+-----{{.AnalyzeType}}-----
+
+Efficiency of {{.Image}}: {{printf "%.4f" .Analysis.Score}} ({{size .Analysis.WastedSize}} wasted of {{size .Analysis.TotalSize}})
+
+Wasted space by layer:{{if not .Analysis.Layers}} None{{else}}
+LAYER	SIZE	OVERWRITTEN	DELETED	CREATED BY{{range .Analysis.Layers}}{{"\n"}}{{print "-"}}{{.Layer}}	{{size .Size}}	{{size .OverwrittenSize}}	{{size .DeletedSize}}	{{.CreatedBy}}{{end}}{{end}}
+
+Duplicated content:{{if not .Analysis.Duplicates}} None{{else}}
+HASH	SIZE	WASTED	FILES{{range .Analysis.Duplicates}}{{"\n"}}{{print "-"}}{{.Hash}}	{{size .Size}}	{{size .WastedSize}}	{{range $i, $file := .Files}}{{if $i}}, {{end}}{{$file.Path}}{{end}}{{end}}{{end}}
+`
+
+const ReproOutput = `
+-----{{.DiffType}}-----
+
+Files not reproducible between {{.Diff.Image1}} and {{.Diff.Image2}}:{{if not .Diff.Files}} None{{else}}
+PATH	REASON	DETAILS{{range .Diff.Files}}{{"\n"}}{{print "-"}}{{.Path}}	{{.Reason}}	{{if ge .Offset 0}}first difference at byte {{.Offset}}{{else if .Hash1}}{{.Hash1}} != {{.Hash2}}{{end}}{{end}}{{end}}
+`
+
+const ListAnalysisOutput = `
+-----{{.AnalyzeType}}-----
+
+Analysis for {{.Image}}:{{if not .Analysis}} None{{else}}{{range .Analysis}}{{"\n"}}{{print "-" .}}{{end}}{{end}}
+`
+
+const SingleVersionPackageAnalysisOutput = `
+-----{{.AnalyzeType}}-----
+
+Packages found in {{.Image}}:{{if not .Analysis}} None{{else}}
+NAME	VERSION	SIZE{{range $name, $value := .Analysis}}{{"\n"}}{{print "-"}}{{$name}}	{{$value.Version}}	{{size $value.Size}}{{end}}{{end}}
+`
+
+const MultiVersionPackageAnalysisOutput = `
+-----{{.AnalyzeType}}-----
+
+Packages found in {{.Image}}:{{if not .Analysis}} None{{else}}
+NAME	VERSION	SIZE	INSTALLATION{{range $name, $value := .Analysis}}{{range $path, $info := $value}}{{"\n"}}{{print "-"}}{{$name}}	{{$info.Version}}	{{size $info.Size}}	{{$path}}{{end}}{{end}}{{end}}
+`
+
+const SeriesMarkdownOutput = `# Image series report
+
+## Images
+
+| # | Image | Size |
+|---|-------|------|
+{{range $i, $image := .Images}}| {{$i}} | {{md $image.Image}} | {{if $image.Error}}not prepared{{else}}{{size $image.Size}}{{end}} |
+{{end}}{{if .Failures}}
+## Failed diffs
+
+| # | Image 1 | Image 2 | Error |
+|---|---------|---------|-------|
+{{range .Failures}}| {{.Index}} | {{md .Image1}} | {{md .Image2}} | {{md .Error}} |
+{{end}}{{end}}
+## Package changes
+{{if not .PackageChanges}}
+None
+{{else}}
+| # | Image | Differ | Package | Change | From | To |
+|---|-------|--------|---------|--------|------|----|
+{{range .PackageChanges}}| {{.Index}} | {{md .Image}} | {{.DiffType}} | {{md .Package}} | {{.Change}} | {{md .From}} | {{md .To}} |
+{{end}}{{end}}
+## History changes
+{{if not .HistoryChanges}}
+None
+{{else}}{{range .HistoryChanges}}
+### {{.Index}}: {{md .Image}}
+{{range .Dels}}
+- removed: ` + "`{{.}}`" + `{{end}}{{range .Adds}}
+- added: ` + "`{{.}}`" + `{{end}}
+{{end}}{{end}}`
+
+const SummaryOutput = `
+-----Summary-----
+
+DIFFER	ADDED	REMOVED	CHANGED	SIZE CHANGE{{range .Differs}}
+-{{.Differ}}	{{.Added}}	{{.Removed}}	{{.Changed}}	{{if .SizeDelta}}{{sizeDelta .SizeDelta}}{{end}}{{end}}
+TOTAL	{{.Added}}	{{.Removed}}	{{.Changed}}	{{sizeDelta .SizeDelta}}
+`
+
+const DifferListOutput = `NAME	FLAG	DEFAULT	ANALYZER	RESULT	DESCRIPTION{{range .Differs}}
+{{.Name}}	{{.Flag}}	{{if .Default}}yes{{else}}no{{end}}	{{if .Analyzer}}yes{{else}}no{{end}}	{{.DiffType}}	{{.Description}}{{end}}
 `